@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"github.com/yushyn-andriy/firefly/token"
@@ -10,6 +11,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -34,6 +36,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 
@@ -52,6 +61,7 @@ type AssignStatement struct {
 
 func (ae *AssignStatement) statementNode()       {}
 func (ae *AssignStatement) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignStatement) Pos() token.Position  { return ae.Token.Pos }
 func (ae *AssignStatement) String() string {
 	var out bytes.Buffer
 
@@ -74,6 +84,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Pos }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -96,6 +107,7 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Pos }
 func (i *Identifier) String() string       { return i.Value }
 
 type ReturnStatement struct {
@@ -107,6 +119,7 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos }
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -129,6 +142,7 @@ type ExpressionStatement struct {
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // the value instead of Value when it does not fit in an int64
 }
 
 type FloatLiteral struct {
@@ -137,7 +151,7 @@ type FloatLiteral struct {
 }
 
 type SelectorExpr struct {
-	Token      token.Token // the first token of the expression
+	Token      token.Token // the '.' token
 	Expression Expression
 	Selector   *Identifier
 	Value      Expression
@@ -145,6 +159,7 @@ type SelectorExpr struct {
 
 func (se *SelectorExpr) expressionNode()      {}
 func (se *SelectorExpr) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectorExpr) Pos() token.Position  { return se.Token.Pos }
 func (se *SelectorExpr) String() string {
 	var out bytes.Buffer
 	out.WriteString(se.Expression.String())
@@ -160,16 +175,19 @@ func (se *SelectorExpr) String() string {
 
 func (il *IntegerLiteral) expressionNode()      {}
 func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
+func (il *IntegerLiteral) Pos() token.Position  { return il.Token.Pos }
 func (il *IntegerLiteral) String() string       { return il.Token.Literal }
 
 func (fl *FloatLiteral) expressionNode()      {}
 func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 
 func (rs *ExpressionStatement) statementNode() {}
 func (rs *ExpressionStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ExpressionStatement) Pos() token.Position { return rs.Token.Pos }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -185,6 +203,7 @@ type PrefixExpression struct {
 
 func (pe *PrefixExpression) expressionNode()      {}
 func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
+func (pe *PrefixExpression) Pos() token.Position  { return pe.Token.Pos }
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -205,6 +224,7 @@ type InfixExpression struct {
 
 func (oe *InfixExpression) expressionNode()      {}
 func (oe *InfixExpression) TokenLiteral() string { return oe.Token.Literal }
+func (oe *InfixExpression) Pos() token.Position  { return oe.Token.Pos }
 func (oe *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -224,6 +244,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string       { return b.Token.Literal }
 
 type IfExpression struct {
@@ -235,6 +256,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -251,6 +273,32 @@ func (ie *IfExpression) String() string {
 	return out.String()
 }
 
+// ConditionalExpression is cond ? a : b, the value of a if cond is
+// truthy and of b otherwise.
+type ConditionalExpression struct {
+	Token       token.Token // the ? token
+	Condition   Expression
+	Consequence Expression
+	Alternative Expression
+}
+
+func (ce *ConditionalExpression) expressionNode()      {}
+func (ce *ConditionalExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *ConditionalExpression) Pos() token.Position  { return ce.Token.Pos }
+func (ce *ConditionalExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ce.Condition.String())
+	out.WriteString(" ? ")
+	out.WriteString(ce.Consequence.String())
+	out.WriteString(" : ")
+	out.WriteString(ce.Alternative.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
@@ -258,6 +306,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() token.Position  { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -275,6 +324,7 @@ type ImportLiteral struct {
 
 func (ms *ImportLiteral) expressionNode()      {}
 func (ms *ImportLiteral) TokenLiteral() string { return ms.Token.Literal }
+func (ms *ImportLiteral) Pos() token.Position  { return ms.Token.Pos }
 func (ms *ImportLiteral) String() string {
 	var out bytes.Buffer
 
@@ -288,14 +338,16 @@ func (ms *ImportLiteral) String() string {
 }
 
 type ClassLiteral struct {
-	Token token.Token // the 'class' token
-	Name  *Identifier // class name
+	Token token.Token  // the 'class' token
+	Name  *Identifier  // class name
+	Bases []Expression // base classes, may be empty
 	// Parameters []*Identifier
 	Body *BlockStatement
 }
 
 func (cl *ClassLiteral) expressionNode()      {}
 func (cl *ClassLiteral) TokenLiteral() string { return cl.Token.Literal }
+func (cl *ClassLiteral) Pos() token.Position  { return cl.Token.Pos }
 func (cl *ClassLiteral) String() string {
 	var out bytes.Buffer
 
@@ -309,6 +361,15 @@ func (cl *ClassLiteral) String() string {
 		out.WriteString(" ")
 		out.WriteString(cl.Name.String())
 	}
+	if len(cl.Bases) > 0 {
+		bases := []string{}
+		for _, b := range cl.Bases {
+			bases = append(bases, b.String())
+		}
+		out.WriteString("(")
+		out.WriteString(strings.Join(bases, ", "))
+		out.WriteString(")")
+	}
 	// out.WriteString("(")
 	// out.WriteString(strings.Join(params, ", "))
 	// out.WriteString(") ")
@@ -321,18 +382,33 @@ type FunctionLiteral struct {
 	Token      token.Token // the 'fn' token
 	Name       *Identifier
 	Parameters []*Identifier
-	Body       *BlockStatement
+	// Defaults holds the default value of each parameter, in the order
+	// of Parameters, and nil for parameters without one.
+	Defaults []Expression
+	Rest     *Identifier // the ...rest parameter, if any
+	Body     *BlockStatement
+	// Source is the body as it was written. The optimizer sets it before
+	// it rewrites Body, so that the function prints the same either way.
+	Source string
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() token.Position  { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range fl.Parameters {
+	for i, p := range fl.Parameters {
+		if i < len(fl.Defaults) && fl.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+fl.Defaults[i].String())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if fl.Rest != nil {
+		params = append(params, token.ELLIPSIS+fl.Rest.String())
+	}
 
 	out.WriteString(fl.TokenLiteral())
 	if fl.Name != nil {
@@ -355,6 +431,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() token.Position  { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -371,6 +448,35 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// KeywordArgument is an argument passed by name at a call site,
+// e.g. b: 3 in f(1, b: 3).
+type KeywordArgument struct {
+	Token token.Token // the name token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ka *KeywordArgument) expressionNode()      {}
+func (ka *KeywordArgument) TokenLiteral() string { return ka.Token.Literal }
+func (ka *KeywordArgument) Pos() token.Position  { return ka.Token.Pos }
+func (ka *KeywordArgument) String() string {
+	return ka.Name.String() + ": " + ka.Value.String()
+}
+
+// SpreadExpression passes the elements of an iterable as separate
+// arguments, e.g. ...args in f(...args).
+type SpreadExpression struct {
+	Token token.Token // the '...' token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode()      {}
+func (se *SpreadExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpreadExpression) Pos() token.Position  { return se.Token.Pos }
+func (se *SpreadExpression) String() string {
+	return se.TokenLiteral() + se.Value.String()
+}
+
 type StringLiteral struct {
 	Token token.Token
 	Value string
@@ -378,6 +484,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Pos }
 func (sl *StringLiteral) String() string       { return sl.Token.Literal }
 
 type ArrayLiteral struct {
@@ -387,6 +494,7 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) expressionNode()      {}
 func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Pos }
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 
@@ -411,6 +519,7 @@ type IndexExpression struct {
 
 func (ie *IndexExpression) expressionNode()      {}
 func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Pos }
 func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
@@ -430,6 +539,7 @@ type HashLiteral struct {
 
 func (hl *HashLiteral) expressionNode()      {}
 func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Pos }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
@@ -445,25 +555,55 @@ func (hl *HashLiteral) String() string {
 	return out.String()
 }
 
+// ForStatement is either a C-style loop with Init, Cond and Post,
+// or a for-in loop over Iter binding each element to Vars.
 type ForStatement struct {
 	Token token.Token // the 'for' token
-	Init  Statement
-	Cond  Expression
-	Post  Statement
+	Init  Statement   // may be nil
+	Cond  Expression  // may be nil, the loop then runs until break
+	Post  Statement   // may be nil
 	Body  *BlockStatement
+
+	Vars []*Identifier // loop variables of a for-in loop, one or two
+	Iter Expression    // collection of a for-in loop, nil otherwise
 }
 
 func (fs *ForStatement) statementNode()       {}
 func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() token.Position  { return fs.Token.Pos }
 func (fs *ForStatement) String() string {
 	var out bytes.Buffer
 
 	out.WriteString(fs.TokenLiteral())
 	out.WriteString("(")
-	out.WriteString(fs.Init.String())
-	out.WriteString(fs.Cond.String())
+	if fs.Iter != nil {
+		vars := []string{}
+		for _, v := range fs.Vars {
+			vars = append(vars, v.String())
+		}
+		out.WriteString(strings.Join(vars, ", "))
+		out.WriteString(" in ")
+		out.WriteString(fs.Iter.String())
+		out.WriteString(")")
+		out.WriteString("{")
+		if fs.Body != nil {
+			out.WriteString(fs.Body.String())
+		}
+		out.WriteString("}")
+		return out.String()
+	}
+	if fs.Init != nil {
+		out.WriteString(fs.Init.String())
+	} else {
+		out.WriteString(";")
+	}
+	if fs.Cond != nil {
+		out.WriteString(fs.Cond.String())
+	}
 	out.WriteString(";")
-	out.WriteString(fs.Post.String())
+	if fs.Post != nil {
+		out.WriteString(fs.Post.String())
+	}
 	out.WriteString(")")
 	out.WriteString("{")
 	if fs.Body != nil {
@@ -473,3 +613,129 @@ func (fs *ForStatement) String() string {
 
 	return out.String()
 }
+
+type WhileStatement struct {
+	Token token.Token // the 'while' token
+	Cond  Expression
+	Body  *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() token.Position  { return ws.Token.Pos }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ws.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(ws.Cond.String())
+	out.WriteString(")")
+	out.WriteString("{")
+	if ws.Body != nil {
+		out.WriteString(ws.Body.String())
+	}
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type BreakStatement struct {
+	Token token.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() token.Position  { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return bs.TokenLiteral() + ";" }
+
+type ContinueStatement struct {
+	Token token.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() token.Position  { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return cs.TokenLiteral() + ";" }
+
+type TryStatement struct {
+	Token   token.Token // the 'try' token
+	Block   *BlockStatement
+	Catches []*CatchClause  // tried in order, may be empty if Finally is set
+	Finally *BlockStatement // may be nil if there are Catches
+}
+
+func (ts *TryStatement) statementNode()       {}
+func (ts *TryStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TryStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *TryStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try {")
+	out.WriteString(ts.Block.String())
+	out.WriteString("}")
+
+	for _, c := range ts.Catches {
+		out.WriteString(" ")
+		out.WriteString(c.String())
+	}
+
+	if ts.Finally != nil {
+		out.WriteString(" finally {")
+		out.WriteString(ts.Finally.String())
+		out.WriteString("}")
+	}
+
+	return out.String()
+}
+
+type CatchClause struct {
+	Token token.Token // the 'catch' token
+	Type  Expression  // exception class to match, nil matches everything
+	Param *Identifier // name the exception is bound to, may be nil
+	Body  *BlockStatement
+}
+
+func (cc *CatchClause) TokenLiteral() string { return cc.Token.Literal }
+func (cc *CatchClause) Pos() token.Position  { return cc.Token.Pos }
+func (cc *CatchClause) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("catch ")
+	if cc.Type != nil || cc.Param != nil {
+		params := []string{}
+		if cc.Type != nil {
+			params = append(params, cc.Type.String())
+		}
+		if cc.Param != nil {
+			params = append(params, cc.Param.String())
+		}
+		out.WriteString("(")
+		out.WriteString(strings.Join(params, " "))
+		out.WriteString(") ")
+	}
+	out.WriteString("{")
+	out.WriteString(cc.Body.String())
+	out.WriteString("}")
+
+	return out.String()
+}
+
+type ThrowStatement struct {
+	Token token.Token // the 'throw' token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode()       {}
+func (ts *ThrowStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *ThrowStatement) Pos() token.Position  { return ts.Token.Pos }
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ts.TokenLiteral() + " ")
+	if ts.Value != nil {
+		out.WriteString(ts.Value.String())
+	}
+	out.WriteString(";")
+
+	return out.String()
+}
@@ -0,0 +1,716 @@
+package builtins
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+var (
+	stdout io.Writer
+	stderr io.Writer
+	stdin  *bufio.Reader
+)
+
+func init() {
+	stdout = os.Stdout
+	stderr = os.Stderr
+	stdin = bufio.NewReader(os.Stdin)
+}
+
+func SetStd(sout, serr io.Writer) {
+	stdout = sout
+	stderr = serr
+}
+
+// SetStdin makes input read its lines from r.
+func SetStdin(r io.Reader) {
+	stdin = bufio.NewReader(r)
+}
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
+
+func init() {
+	registerBuiltin("len", blen)
+	registerBuiltin("first", bfirst)
+
+	registerBuiltin("print", bprint)
+	registerBuiltin("utskrift", bprint)
+
+	registerBuiltin("println", bprintln)
+	registerBuiltin("utskriftln", bprintln)
+
+	registerBuiltin("printf", bprintf)
+
+	registerBuiltin("eprint", beprint)
+	registerBuiltin("futskrift", beprintln)
+
+	registerBuiltin("exit", bexit)
+	registerBuiltin("locals", blocals)
+	registerBuiltin("type", btype)
+	registerBuiltin("builtins", bbuiltins)
+	registerBuiltin("getattr", bgetattr)
+	registerBuiltin("setattr", bsetattr)
+	registerBuiltin("new", bNewClass)
+	registerBuiltin("super", bSuper)
+	registerBuiltin("isinstance", bIsInstance)
+	registerBuiltin("issubclass", bIsSubclass)
+	registerBuiltin("help", bhelp)
+
+	registerBuiltin("pow", bPow)
+	registerBuiltin("range", bRange)
+	registerBuiltin("file", bNewFile)
+	registerBuiltin("input", bInput)
+	registerBuiltin("system", bSystem)
+
+	registerBuiltin("int", bInt)
+	registerBuiltin("float", bFloat)
+	registerBuiltin("string", bString)
+	registerBuiltin("decimal", bDecimal)
+}
+
+// registry holds the builtins in the order they were registered. The
+// position of a builtin is its index in OpGetBuiltin instructions.
+var (
+	registry = []*object.Builtin{}
+	indexes  = map[string]int{}
+)
+
+func registerBuiltin(name string, f object.BuiltinFunction) {
+	indexes[name] = len(registry)
+	registry = append(registry, &object.Builtin{Name: name, Fn: f, Env: nil})
+}
+
+// Lookup returns the builtin called name.
+func Lookup(name string) (*object.Builtin, bool) {
+	index, ok := indexes[name]
+	if !ok {
+		return nil, false
+	}
+	return registry[index], true
+}
+
+// Index returns the index of the builtin called name.
+func Index(name string) (int, bool) {
+	index, ok := indexes[name]
+	return index, ok
+}
+
+// Get returns the builtin at index, or nil if there is none.
+func Get(index int) *object.Builtin {
+	if index < 0 || index >= len(registry) {
+		return nil
+	}
+	return registry[index]
+}
+
+// Names returns the names of all builtins in registration order.
+func Names() []string {
+	names := make([]string, len(registry))
+	for i, b := range registry {
+		names[i] = b.Name
+	}
+	return names
+}
+
+func newError(cls *object.Class, format string, a ...interface{}) *object.Error {
+	return object.NewError(cls, format, a...)
+}
+
+func bFloat(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	obj := args[0]
+	switch arg := obj.(type) {
+	case *object.String:
+		number, err := strconv.ParseFloat(arg.Value, 64)
+		if err != nil {
+			return newError(object.ValueError, "%s", err)
+		}
+		return object.NewFloat(number)
+	case *object.Integer:
+		return object.NewFloat(float64(arg.Value))
+	case *object.BigInteger:
+		number, _ := new(big.Float).SetInt(arg.Value).Float64()
+		return object.NewFloat(number)
+	case *object.Decimal:
+		return object.NewFloat(arg.Float())
+	default:
+		return newError(object.TypeError, "invalid object type %T", arg)
+	}
+}
+
+func bString(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	obj := args[0]
+	switch arg := obj.(type) {
+	case *object.Float:
+		return object.NewString(fmt.Sprintf("%f", arg.Value))
+	case *object.Integer:
+		return object.NewString(fmt.Sprintf("%d", arg.Value))
+	case *object.BigInteger, *object.Decimal:
+		return object.NewString(arg.Inspect())
+	case *object.Instance:
+		s, err := inspect(env, arg, true)
+		if err != nil {
+			return err
+		}
+		return object.NewString(s)
+	default:
+		return newError(object.TypeError, "invalid object type %T", arg)
+	}
+}
+
+func bInt(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	obj := args[0]
+	switch arg := obj.(type) {
+	case *object.String:
+		number, err := strconv.ParseInt(arg.Value, 10, 64)
+		if err == nil {
+			return object.NewInteger(number)
+		}
+		if err.(*strconv.NumError).Err == strconv.ErrRange {
+			if v, ok := new(big.Int).SetString(arg.Value, 10); ok {
+				return object.NewBigInteger(v)
+			}
+		}
+		return newError(object.ValueError, "%s", err)
+	case *object.Integer, *object.BigInteger:
+		return arg
+	case *object.Float:
+		return object.FloatToInteger(arg.Value)
+	case *object.Decimal:
+		return arg.Integer()
+	default:
+		return newError(object.TypeError, "invalid object type %T", arg)
+	}
+}
+
+func bDecimal(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	obj := args[0]
+	switch arg := obj.(type) {
+	case *object.String:
+		d, ok := object.ParseDecimal(arg.Value)
+		if !ok {
+			return newError(object.ValueError, "invalid literal for decimal: %q", arg.Value)
+		}
+		return d
+	case *object.Integer, *object.BigInteger:
+		d, _ := object.ParseDecimal(arg.Inspect())
+		return d
+	case *object.Float:
+		// the shortest digits that give back the float, so decimal(0.1)
+		// is 0.1 rather than the binary fraction closest to it
+		if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+			return newError(object.ValueError, "cannot convert float %s to decimal", arg.Inspect())
+		}
+		d, _ := object.ParseDecimal(strconv.FormatFloat(arg.Value, 'f', -1, 64))
+		return d
+	case *object.Decimal:
+		return arg
+	default:
+		return newError(object.TypeError, "invalid object type %T", arg)
+	}
+}
+
+func bRange(env object.Env, args ...object.Object) object.Object {
+	if len(args) < 1 || len(args) > 3 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1..3",
+			len(args))
+	}
+
+	bounds := []int64{}
+	for _, arg := range args {
+		if _, ok := arg.(*object.BigInteger); ok {
+			return newError(object.OverflowError, "argument to `range` is too large")
+		}
+		i, ok := arg.(*object.Integer)
+		if !ok {
+			return newError(object.TypeError, "argument to `range` must be INTEGER, got %s",
+				arg.Type())
+		}
+		bounds = append(bounds, i.Value)
+	}
+
+	start, stop, step := int64(0), int64(0), int64(1)
+	switch len(bounds) {
+	case 1:
+		stop = bounds[0]
+	case 2:
+		start, stop = bounds[0], bounds[1]
+	case 3:
+		start, stop, step = bounds[0], bounds[1], bounds[2]
+	}
+	if step == 0 {
+		return newError(object.ValueError, "range() step must not be zero")
+	}
+
+	return object.NewRange(start, stop, step)
+}
+
+func bSystem(env object.Env, args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, minimum=1",
+			len(args))
+	}
+
+	strArguments := []string{}
+	for _, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return newError(object.TypeError, "arguments to 'system' must be STRING, got %s",
+				arg.Type())
+		}
+		strArguments = append(strArguments, s.Value)
+	}
+	name, strArguments := strArguments[0], strArguments[1:]
+
+	command := exec.Command(name, strArguments...)
+
+	out, err := command.Output()
+	if err != nil {
+		return newError(object.IOError, "could not run command: %s", err)
+	}
+
+	return object.NewString(string(out))
+}
+
+func bInput(env object.Env, args ...object.Object) object.Object {
+	if len(args) > 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args))
+	}
+
+	if len(args) == 1 {
+		fmt.Fprint(stdout, args[0].Inspect())
+	}
+
+	line, _ := stdin.ReadString('\n')
+	line = strings.ReplaceAll(line, "\n", "")
+
+	return object.NewString(string(line))
+}
+
+func bNewFile(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	var path, mode string
+	switch arg := args[0].(type) {
+	case *object.String:
+		path = arg.Value
+	default:
+		return newError(object.TypeError, "argument to `nclass` not supported, got %s",
+			args[0].Type())
+	}
+	switch arg := args[1].(type) {
+	case *object.String:
+		mode = arg.Value
+	default:
+		return newError(object.TypeError, "argument to `nclass` not supported, got %s",
+			args[0].Type())
+	}
+
+	return object.NewFile(path, mode)
+}
+
+func bNewClass(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	var name string
+	switch arg := args[0].(type) {
+	case *object.String:
+		name = arg.Value
+	default:
+		return newError(object.TypeError, "argument to `nclass` not supported, got %s",
+			args[0].Type())
+	}
+
+	return object.NewClass(&ast.Identifier{Token: token.Token{
+		Type:    token.IDENT,
+		Literal: name,
+	}, Value: name}, nil, nil)
+}
+
+// bSuper returns a proxy for the parent classes of an instance. Without
+// arguments it uses the class the calling method was defined in and the
+// self of that method.
+func bSuper(env object.Env, args ...object.Object) object.Object {
+	var clsObj, selfObj object.Object
+	switch len(args) {
+	case 0:
+		var ok bool
+		if env != nil {
+			clsObj, selfObj, ok = env.Method()
+		}
+		if !ok {
+			return newError(object.RuntimeError, "super(): no arguments outside a method")
+		}
+	case 2:
+		clsObj, selfObj = args[0], args[1]
+	default:
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=0 or 2",
+			len(args))
+	}
+
+	cls, ok := clsObj.(*object.Class)
+	if !ok {
+		return newError(object.TypeError, "super() argument 1 must be CLASS, got %s",
+			clsObj.Type())
+	}
+	self, ok := selfObj.(*object.Instance)
+	if !ok || !self.Class().IsSubclass(cls) {
+		return newError(object.TypeError, "super(type, obj): obj must be an instance of %s",
+			cls.Name.Value)
+	}
+
+	return &object.Super{Class: cls, Self: self}
+}
+
+// classInfo turns the second argument of isinstance and issubclass,
+// a class or an array of classes, into a list of classes.
+func classInfo(name string, obj object.Object) ([]*object.Class, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Class:
+		return []*object.Class{obj}, nil
+	case *object.Array:
+		classes := []*object.Class{}
+		for _, e := range obj.Elements {
+			cls, ok := e.(*object.Class)
+			if !ok {
+				return nil, newError(object.TypeError,
+					"%s() arg 2 must be a class or an array of classes, got %s", name, e.Type())
+			}
+			classes = append(classes, cls)
+		}
+		return classes, nil
+	default:
+		return nil, newError(object.TypeError,
+			"%s() arg 2 must be a class or an array of classes, got %s", name, obj.Type())
+	}
+}
+
+func bIsInstance(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	classes, err := classInfo("isinstance", args[1])
+	if err != nil {
+		return err
+	}
+
+	var cls *object.Class
+	switch obj := args[0].(type) {
+	case *object.Instance:
+		cls = obj.Class()
+	case *object.Exception:
+		for _, c := range classes {
+			if obj.Err.IsInstance(c) {
+				return TRUE
+			}
+		}
+		return FALSE
+	default:
+		return FALSE
+	}
+
+	for _, c := range classes {
+		if cls.IsSubclass(c) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+func bIsSubclass(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	cls, ok := args[0].(*object.Class)
+	if !ok {
+		return newError(object.TypeError, "issubclass() arg 1 must be a class, got %s",
+			args[0].Type())
+	}
+	classes, err := classInfo("issubclass", args[1])
+	if err != nil {
+		return err
+	}
+
+	for _, c := range classes {
+		if cls.IsSubclass(c) {
+			return TRUE
+		}
+	}
+	return FALSE
+}
+
+func bPow(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+
+	// pow(a, b) is a ** b
+	if a, b, ok := object.PromoteToFloat("**", args[0], args[1]); ok {
+		return object.FloatPow(a.Value, b.Value)
+	}
+	if result, ok := object.BigOperation("**", args[0], args[1]); ok {
+		return result
+	}
+	switch a := args[0].(type) {
+	case *object.Integer:
+		if b, ok := args[1].(*object.Integer); ok {
+			return object.Pow(a.Value, b.Value)
+		}
+	case *object.Float:
+		if b, ok := args[1].(*object.Float); ok {
+			return object.FloatPow(a.Value, b.Value)
+		}
+	}
+	return newError(object.TypeError, "both arguments must be INTEGER or FLOAT type got %s, %s",
+		args[0].Type(), args[1].Type())
+}
+
+func blen(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return arg.Len()
+	case *object.Array:
+		return arg.Len()
+	case *object.Range:
+		return arg.Len()
+	case *object.Instance:
+		if fn, ok := object.LookupMethod(arg, object.MAGIC_METHOD_LEN); ok {
+			return env.Call(fn)
+		}
+		return newError(object.TypeError, "object of type '%s' has no len()",
+			arg.Class().Name.Value)
+	default:
+		return newError(object.TypeError, "argument to `len` not supported, got %s",
+			args[0].Type())
+	}
+
+}
+
+func bhelp(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.Builtin:
+		return object.NewString(arg.Doc)
+	case *object.Array:
+		return arg.Len()
+	default:
+		return arg.GetAttr("__doc__")
+	}
+
+}
+
+func bsetattr(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 3 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=3",
+			len(args))
+	}
+	obj := args[0]
+	keyObj := args[1]
+	value := args[2]
+
+	key, ok := keyObj.(*object.String)
+	if !ok {
+		return newError(object.TypeError, "getattr(): attribute name must be string")
+	}
+	return obj.SetAttr(key.Value, value)
+}
+
+func bgetattr(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=2",
+			len(args))
+	}
+	obj := args[0]
+	keyObj := args[1]
+
+	key, ok := keyObj.(*object.String)
+	if !ok {
+		return newError(object.TypeError, "getattr(): attribute name must be string")
+	}
+
+	return obj.GetAttr(key.Value)
+}
+
+func bbuiltins(env object.Env, args ...object.Object) object.Object {
+	arr := object.NewArray(nil)
+	for _, name := range Names() {
+		arr.Elements = append(arr.Elements, object.NewString(name))
+	}
+	return arr
+}
+
+func btype(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	return &object.ObjType{Value: string(args[0].Type())}
+}
+
+func blocals(env object.Env, args ...object.Object) object.Object {
+	if env != nil {
+		return env.Locals()
+	}
+	return NULL
+}
+
+func bfirst(env object.Env, args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+
+	if args[0].Type() != object.ARRAY_OBJ {
+		return newError(object.TypeError, "argument to 'first' must be ARRAY, got %s",
+			args[0].Type())
+	}
+
+	arr := args[0].(*object.Array)
+	if len(arr.Elements) > 0 {
+		return arr.Elements[0]
+	}
+
+	return NULL
+}
+
+func bprintf(env object.Env, args ...object.Object) object.Object {
+	if len(args) < 1 {
+		return newError(object.TypeError, "wrong number of arguments. got=%d, minimum=1",
+			len(args))
+	}
+
+	if args[0].Type() != object.STRING_OBJ {
+		return newError(object.TypeError, "argument to 'first' must be %s, got %s",
+			object.STRING_OBJ, args[0].Type())
+	}
+
+	format := args[0].(*object.String).Value
+	arguments := []any{}
+	for _, arg := range args[1:] {
+		s, err := inspect(env, arg, true)
+		if err != nil {
+			return err
+		}
+		arguments = append(arguments, printfArg{obj: arg, text: s})
+	}
+
+	format = strings.ReplaceAll(format, "\\n", "\n")
+
+	_, err := fmt.Fprintf(stdout, format, arguments...)
+	if err != nil {
+		return newError(object.IOError, "%s", err)
+	}
+
+	return NULL
+}
+
+func bprint(env object.Env, args ...object.Object) object.Object {
+	out, err := inspectArgs(env, args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stdout, out)
+	return NULL
+}
+
+func bprintln(env object.Env, args ...object.Object) object.Object {
+	out, err := inspectArgs(env, args)
+	if err != nil {
+		return err
+	}
+	out += "\n"
+	fmt.Fprint(stdout, out)
+	return NULL
+}
+
+func beprint(env object.Env, args ...object.Object) object.Object {
+	out, err := inspectArgs(env, args)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(stderr, out)
+	return NULL
+}
+
+func beprintln(env object.Env, args ...object.Object) object.Object {
+	out, err := inspectArgs(env, args)
+	if err != nil {
+		return err
+	}
+	out += "\n"
+	fmt.Fprint(stderr, out)
+	return NULL
+}
+
+func bexit(env object.Env, args ...object.Object) object.Object {
+	switch len(args) {
+	case 0:
+		os.Exit(0)
+	case 1:
+		if args[0].Type() != object.INTEGER_OBJ {
+			return newError(object.TypeError, "argument to 'exit' must be INT, got %s",
+				args[0].Type())
+
+		}
+		status := object.Int64(args[0])
+		os.Exit(int(status))
+	default:
+		return newError(object.TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args))
+	}
+	return NULL
+}
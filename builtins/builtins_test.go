@@ -0,0 +1,26 @@
+package builtins
+
+import "testing"
+
+func TestRegistry(t *testing.T) {
+	for i, name := range Names() {
+		index, ok := Index(name)
+		if !ok || index != i {
+			t.Errorf("wrong index for %s. want=%d, got=%d (%t)", name, i, index, ok)
+		}
+		builtin, ok := Lookup(name)
+		if !ok || builtin != Get(i) {
+			t.Errorf("Lookup(%q) does not return the builtin at index %d", name, i)
+		}
+		if builtin.Name != name {
+			t.Errorf("builtin at index %d has wrong name. want=%q, got=%q", i, name, builtin.Name)
+		}
+	}
+
+	if _, ok := Lookup("no_such_builtin"); ok {
+		t.Errorf("Lookup found a builtin that does not exist")
+	}
+	if Get(-1) != nil || Get(len(Names())) != nil {
+		t.Errorf("Get returned a builtin for an index out of range")
+	}
+}
@@ -0,0 +1,168 @@
+package builtins
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+// inspect renders obj for output. Instances are shown through __str__
+// when str is set, and through __repr__ otherwise or when there is no
+// __str__. Elements of arrays and hashes always use __repr__.
+func inspect(env object.Env, obj object.Object, str bool) (string, *object.Error) {
+	return inspectNested(env, obj, str, map[object.Object]bool{})
+}
+
+// inspectNested renders obj like inspect. The arrays and hashes in active
+// are being rendered already, and show as [...] and {...} where they
+// contain themselves.
+func inspectNested(env object.Env, obj object.Object, str bool, active map[object.Object]bool) (string, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Instance:
+		names := []string{object.MAGIC_METHOD_REPR}
+		if str {
+			names = []string{object.MAGIC_METHOD_STR, object.MAGIC_METHOD_REPR}
+		}
+		for _, name := range names {
+			if fn, ok := object.LookupMethod(obj, name); ok {
+				switch res := env.Call(fn).(type) {
+				case *object.Error:
+					return "", res
+				case *object.String:
+					return res.Value, nil
+				default:
+					return "", newError(object.TypeError, "%s returned non-string (type %s)",
+						name, res.Type())
+				}
+			}
+		}
+		return obj.Inspect(), nil
+
+	case *object.Array:
+		if active[obj] {
+			return "[...]", nil
+		}
+		active[obj] = true
+		defer delete(active, obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			s, err := inspectNested(env, e, false, active)
+			if err != nil {
+				return "", err
+			}
+			elements = append(elements, s)
+		}
+		return "[" + strings.Join(elements, ", ") + "]", nil
+
+	case *object.Hash:
+		if active[obj] {
+			return "{...}", nil
+		}
+		active[obj] = true
+		defer delete(active, obj)
+
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			key, err := inspectNested(env, pair.Key, false, active)
+			if err != nil {
+				return "", err
+			}
+			value, err := inspectNested(env, pair.Value, false, active)
+			if err != nil {
+				return "", err
+			}
+			pairs = append(pairs, fmt.Sprintf("%s: %s", key, value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}", nil
+
+	default:
+		return obj.Inspect(), nil
+	}
+}
+
+// inspectArgs renders args separated by single spaces, the way the
+// print builtins show them.
+func inspectArgs(env object.Env, args []object.Object) (string, *object.Error) {
+	var out bytes.Buffer
+	for index, arg := range args {
+		s, err := inspect(env, arg, true)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(s)
+		if index+1 == len(args) {
+			continue
+		}
+		out.WriteString(" ")
+	}
+	return out.String(), nil
+}
+
+// printfArg is an argument of printf. Numbers take the numeric verbs, so
+// that %5d pads an integer and %.2f rounds a decimal, exactly and half
+// to even; with any other verb a value is the text print shows.
+type printfArg struct {
+	obj  object.Object
+	text string
+}
+
+func (a printfArg) Format(f fmt.State, verb rune) {
+	format := fmt.FormatString(f, verb)
+	integer := strings.ContainsRune("bdoxX", verb)
+	float := strings.ContainsRune("eEfFgG", verb)
+
+	switch obj := a.obj.(type) {
+	case *object.Integer:
+		if integer || verb == 'c' {
+			fmt.Fprintf(f, format, obj.Value)
+			return
+		}
+		if float {
+			fmt.Fprintf(f, format, float64(obj.Value))
+			return
+		}
+	case *object.BigInteger:
+		if integer {
+			fmt.Fprintf(f, format, obj.Value)
+			return
+		}
+		if float {
+			fmt.Fprintf(f, format, new(big.Float).SetInt(obj.Value))
+			return
+		}
+	case *object.Float:
+		if float {
+			fmt.Fprintf(f, format, obj.Value)
+			return
+		}
+	case *object.Decimal:
+		if verb == 'f' || verb == 'F' {
+			if prec, ok := f.Precision(); ok {
+				obj = obj.Round(prec)
+			}
+			s := obj.Inspect()
+			if f.Flag('+') && obj.Value.Sign() >= 0 {
+				s = "+" + s
+			}
+			pad := "%"
+			if f.Flag('-') {
+				pad += "-"
+			}
+			if width, ok := f.Width(); ok {
+				pad += strconv.Itoa(width)
+			}
+			fmt.Fprintf(f, pad+"s", s)
+			return
+		}
+		if float {
+			fmt.Fprintf(f, format, obj.Float())
+			return
+		}
+	}
+	fmt.Fprintf(f, format, a.text)
+}
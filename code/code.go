@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"sort"
+
+	"github.com/yushyn-andriy/firefly/token"
 )
 
 type Instructions []byte
@@ -17,6 +20,79 @@ const (
 	OpSub
 	OpMul
 	OpDiv
+	OpTrue
+	OpFalse
+	OpNull
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpAnd
+	OpOr
+	OpMinus
+	OpBang
+	OpJumpNotTruthy
+	OpJump
+	OpGetGlobal
+	OpSetGlobal
+	OpGetLocal
+	OpSetLocal
+	OpArray
+	OpHash
+	OpIndex
+	OpSetIndex
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+	OpGetFree
+	OpSetFree
+	OpCaptureLocal
+	OpCaptureFree
+	OpClass
+	OpGetAttr
+	OpSetAttr
+	OpGetBuiltin
+
+	// superinstructions, which the peephole optimizer makes of the
+	// sequences they are named after
+	OpLessThanJumpNotTruthy
+	OpGreaterThanJumpNotTruthy
+	OpEqualJumpNotTruthy
+	OpNotEqualJumpNotTruthy
+	OpAddLocal
+
+	OpLessEqual
+	OpGreaterEqual
+	OpMod
+	OpPow
+	OpFloorDiv
+	OpBitAnd
+	OpBitOr
+	OpBitXor
+	OpShiftLeft
+	OpShiftRight
+	OpPlus
+	OpBitNot
+
+	OpJumpNotTruthyOrPop
+	OpJumpTruthyOrPop
+
+	OpGetIter
+	OpForIter
+	OpUnpack
+	OpModule
+	OpGetException
+	OpSetupTry
+	OpPopTry
+	OpThrow
+	OpCatch
+
+	OpExtendArray
+	OpExtendHash
+
+	OpSpread
+	OpCallKw
 )
 
 type Definition struct {
@@ -31,6 +107,128 @@ var definitions = map[Opcode]*Definition{
 	OpSub:      {"OpSub", []int{}},
 	OpMul:      {"OpMul", []int{}},
 	OpDiv:      {"OpDiv", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+
+	OpEqual:       {"OpEqual", []int{}},
+	OpNotEqual:    {"OpNotEqual", []int{}},
+	OpGreaterThan: {"OpGreaterThan", []int{}},
+	OpLessThan:    {"OpLessThan", []int{}},
+	OpAnd:         {"OpAnd", []int{}},
+	OpOr:          {"OpOr", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+
+	OpGetGlobal: {"OpGetGlobal", []int{2}},
+	OpSetGlobal: {"OpSetGlobal", []int{2}},
+	OpGetLocal:  {"OpGetLocal", []int{1}},
+	OpSetLocal:  {"OpSetLocal", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+
+	// OpClosure takes the constant index of the function and the number
+	// of captured cells on the stack
+	OpClosure:      {"OpClosure", []int{2, 1}},
+	OpGetFree:      {"OpGetFree", []int{1}},
+	OpSetFree:      {"OpSetFree", []int{1}},
+	OpCaptureLocal: {"OpCaptureLocal", []int{1}},
+	OpCaptureFree:  {"OpCaptureFree", []int{1}},
+
+	// OpClass takes the constant index of the class name and the number
+	// of base classes on the stack
+	OpClass:   {"OpClass", []int{2, 1}},
+	OpGetAttr: {"OpGetAttr", []int{2}},
+	OpSetAttr: {"OpSetAttr", []int{2}},
+
+	OpGetBuiltin: {"OpGetBuiltin", []int{1}},
+
+	// a comparison followed by OpJumpNotTruthy to the operand
+	OpLessThanJumpNotTruthy:    {"OpLessThanJumpNotTruthy", []int{2}},
+	OpGreaterThanJumpNotTruthy: {"OpGreaterThanJumpNotTruthy", []int{2}},
+	OpEqualJumpNotTruthy:       {"OpEqualJumpNotTruthy", []int{2}},
+	OpNotEqualJumpNotTruthy:    {"OpNotEqualJumpNotTruthy", []int{2}},
+
+	// OpAddLocal takes a local and the constant index of the value to
+	// add to it, for OpGetLocal, OpConstant, OpAdd, OpSetLocal. The
+	// source map gives the position of the addition at the offset of
+	// the instruction plus one.
+	OpAddLocal: {"OpAddLocal", []int{1, 2}},
+
+	// operators that came after the superinstructions, numbered after
+	// them so that existing bytecode keeps its meaning
+	OpLessEqual:    {"OpLessEqual", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpPow:          {"OpPow", []int{}},
+	OpFloorDiv:     {"OpFloorDiv", []int{}},
+	OpBitAnd:       {"OpBitAnd", []int{}},
+	OpBitOr:        {"OpBitOr", []int{}},
+	OpBitXor:       {"OpBitXor", []int{}},
+	OpShiftLeft:    {"OpShiftLeft", []int{}},
+	OpShiftRight:   {"OpShiftRight", []int{}},
+	OpPlus:         {"OpPlus", []int{}},
+	OpBitNot:       {"OpBitNot", []int{}},
+
+	// and and or jump to the operand with the value on the stack when
+	// it decides the result, and pop the value otherwise
+	OpJumpNotTruthyOrPop: {"OpJumpNotTruthyOrPop", []int{2}},
+	OpJumpTruthyOrPop:    {"OpJumpTruthyOrPop", []int{2}},
+
+	// OpGetIter replaces a collection with an iterator over it, over
+	// the [key, value] pairs of a hash when the operand, the number of
+	// loop variables, is 2. OpForIter pushes the next element of the
+	// iterator on the stack, or pops the iterator and jumps to the
+	// operand once there are no more. OpUnpack replaces an array with
+	// its operand number of elements, the first one on top.
+	OpGetIter: {"OpGetIter", []int{1}},
+	OpForIter: {"OpForIter", []int{2}},
+	OpUnpack:  {"OpUnpack", []int{1}},
+
+	// OpModule pushes the module named by the constant at the operand,
+	// with the variables of the current function as its attributes
+	OpModule: {"OpModule", []int{2}},
+
+	// OpGetException pushes the built-in exception class at the operand
+	// in object.Exceptions
+	OpGetException: {"OpGetException", []int{1}},
+
+	// OpSetupTry makes errors raised until the matching OpPopTry jump
+	// to the operand, with the stack as it was and the exception on
+	// top. OpThrow raises the value on the stack. OpCatch pops a class
+	// and jumps to the operand unless the exception below it is an
+	// instance of the class.
+	OpSetupTry: {"OpSetupTry", []int{2}},
+	OpPopTry:   {"OpPopTry", []int{}},
+	OpThrow:    {"OpThrow", []int{}},
+	OpCatch:    {"OpCatch", []int{2}},
+
+	// large literals are built in chunks: OpExtendArray appends its
+	// operand number of elements to the array below them, and
+	// OpExtendHash adds the pairs of its operand number of keys and
+	// values to the hash below them
+	OpExtendArray: {"OpExtendArray", []int{2}},
+	OpExtendHash:  {"OpExtendHash", []int{2}},
+
+	// calls with keyword or spread arguments: OpSpread replaces an
+	// iterable with an array of its elements, and OpCallKw calls the
+	// function below its operand number of stack items, which are
+	// arrays of positional arguments and the names of keyword arguments
+	// each followed by the value
+	OpSpread: {"OpSpread", []int{}},
+	OpCallKw: {"OpCallKw", []int{2}},
 }
 
 func Lookup(op byte) (*Definition, error) {
@@ -62,6 +260,8 @@ func Make(op Opcode, operands ...int) []byte {
 		switch width {
 		case 2:
 			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
 		}
 		offset += width
 	}
@@ -74,22 +274,38 @@ func (ins Instructions) String() string {
 
 	i := 0
 	for i < len(ins) {
-		def, err := Lookup(ins[i])
-		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
-			continue
-		}
+		text, width := ins.Format(i)
 
-		operands, read := ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s\n\t", i, text)
 
-		fmt.Fprintf(&out, "%04d %s\n\t", i, ins.fmtInstruction(def, operands))
-
-		i += 1 + read
+		i += width
 	}
 
 	return out.String()
 }
 
+// Format returns the text of the instruction at offset and its width in
+// bytes. Unknown opcodes are reported and skipped one byte at a time; an
+// instruction cut short by the end of ins takes up the rest of it.
+func (ins Instructions) Format(offset int) (string, int) {
+	def, err := Lookup(ins[offset])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err), 1
+	}
+
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if offset+width > len(ins) {
+		return fmt.Sprintf("ERROR: %s truncated, %d of %d bytes",
+			def.Name, len(ins)-offset, width), len(ins) - offset
+	}
+
+	operands, read := ReadOperands(def, ins[offset+1:])
+	return ins.fmtInstruction(def, operands), 1 + read
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -103,6 +319,8 @@ func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 		return fmt.Sprintf("%s", def.Name)
 	case 1:
 		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
 	}
 
 	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
@@ -116,6 +334,8 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 		switch width {
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
 		}
 
 		offset += width
@@ -128,3 +348,46 @@ func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
+
+func ReadUint8(ins Instructions) uint8 { return uint8(ins[0]) }
+
+// SourceMap maps instruction offsets to the source position they were
+// compiled from. Entries are sorted by offset; an entry covers every
+// instruction up to the next one.
+type SourceMap []SourceEntry
+
+type SourceEntry struct {
+	Offset int
+	Pos    token.Position
+}
+
+// Add records that the instructions starting at offset come from pos.
+func (m SourceMap) Add(offset int, pos token.Position) SourceMap {
+	if n := len(m); n > 0 {
+		if m[n-1].Pos == pos {
+			return m
+		}
+		if m[n-1].Offset == offset {
+			m[n-1].Pos = pos
+			return m
+		}
+	}
+	return append(m, SourceEntry{Offset: offset, Pos: pos})
+}
+
+// Lookup returns the source position of the instruction at offset.
+func (m SourceMap) Lookup(offset int) token.Position {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return token.Position{}
+	}
+	return m[i-1].Pos
+}
+
+// Truncate drops the entries of instructions at or after offset.
+func (m SourceMap) Truncate(offset int) SourceMap {
+	for len(m) > 0 && m[len(m)-1].Offset >= offset {
+		m = m[:len(m)-1]
+	}
+	return m
+}
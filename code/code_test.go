@@ -1,6 +1,10 @@
 package code
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/token"
+)
 
 func TestMake(t *testing.T) {
 	tests := []struct {
@@ -56,6 +60,22 @@ func TestInstructionString(t *testing.T) {
 
 }
 
+func TestInstructionStringErrors(t *testing.T) {
+	instructions := Instructions{255}
+	instructions = append(instructions, Make(OpAdd)...)
+	instructions = append(instructions, Make(OpConstant, 513)[:2]...)
+
+	expected := `0000 ERROR: opcode 255 undefined
+	0001 OpAdd
+	0002 ERROR: OpConstant truncated, 2 of 3 bytes
+	`
+
+	if instructions.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
+			expected, instructions.String())
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -85,3 +105,61 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestMakeOneByteOperand(t *testing.T) {
+	instruction := Make(OpGetLocal, 255)
+	expected := []byte{byte(OpGetLocal), 255}
+
+	if len(instruction) != len(expected) {
+		t.Fatalf("instruction has wrong length. want=%d, got=%d",
+			len(expected), len(instruction))
+	}
+	for i, b := range expected {
+		if instruction[i] != b {
+			t.Errorf("wrong byte at pos %d. want=%d, got=%d", i, b, instruction[i])
+		}
+	}
+
+	def, err := Lookup(byte(OpGetLocal))
+	if err != nil {
+		t.Fatalf("definition not found: %q", err)
+	}
+	operands, n := ReadOperands(def, instruction[1:])
+	if n != 1 || operands[0] != 255 {
+		t.Errorf("ReadOperands wrong. got operands=%v, n=%d", operands, n)
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	first := token.Position{Line: 1, Column: 1}
+	second := token.Position{Line: 2, Column: 5}
+
+	var m SourceMap
+	m = m.Add(0, first)
+	m = m.Add(3, first)
+	m = m.Add(4, second)
+
+	if len(m) != 2 {
+		t.Fatalf("entries with the same position were not merged: %v", m)
+	}
+
+	tests := []struct {
+		offset   int
+		expected token.Position
+	}{
+		{0, first},
+		{3, first},
+		{4, second},
+		{10, second},
+	}
+	for _, tt := range tests {
+		if got := m.Lookup(tt.offset); got != tt.expected {
+			t.Errorf("Lookup(%d) wrong. want=%v, got=%v", tt.offset, tt.expected, got)
+		}
+	}
+
+	m = m.Truncate(4)
+	if got := m.Lookup(10); got != first {
+		t.Errorf("Lookup after Truncate wrong. want=%v, got=%v", first, got)
+	}
+}
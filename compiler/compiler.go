@@ -1,26 +1,117 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
 
 	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
 	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/lexer"
 	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/parser"
+	"github.com/yushyn-andriy/firefly/token"
 )
 
 type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	pos token.Position // position of the node being compiled
+
+	// importing holds the modules being compiled, to stop import cycles
+	importing map[string]bool
+
+	// StrictImports makes modules that cannot be read or parsed fail the
+	// compilation, rather than raise an ImportError when the import runs.
+	// Programs built to be deployed want that.
+	StrictImports bool
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
 	instructions code.Instructions
-	constants    []object.Object
+	sourceMap    code.SourceMap
+
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	loops []*loop
+
+	// tries holds the try statements whose handlers are set up at the
+	// instruction being compiled, innermost last
+	tries []*tryBlock
+
+	// pending is the number of values the instructions being compiled
+	// keep below the operands of their expressions: the iterators of
+	// for-in loops, the exception a finally block runs for and the
+	// value a return keeps while it runs finally blocks
+	pending int
+
+	// classBody is set while compiling the body of a class, whose
+	// function literals become methods
+	classBody bool
+}
+
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// loop collects the jumps of the break and continue statements of a
+// loop until their targets are known. It records what was set up when
+// the loop began, which those statements have to undo.
+type loop struct {
+	breaks    []int
+	continues []int
+
+	tries    int
+	pending  int
+	iterator bool // a for-in loop, whose iterator stays for continue
+}
+
+// tryBlock is a try statement with the number of its handlers that are
+// set up and the finally block that has to run when it is left.
+type tryBlock struct {
+	handlers int
+	finally  *ast.BlockStatement
 }
 
 func New() *Compiler {
-	return &Compiler{
+	mainScope := CompilationScope{
 		instructions: code.Instructions{},
-		constants:    []object.Object{},
 	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+		importing:   map[string]bool{},
+	}
+}
+
+// NewWithState creates a compiler that keeps the globals and constants
+// of earlier compilations, which is what the REPL needs.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
 }
 
 func (c *Compiler) Compile(node ast.Node) error {
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.pos
+		c.pos = pos
+		defer func() { c.pos = outer }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -30,12 +121,73 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.ExpressionStatement:
+		if node.Expression == nil {
+			return nil
+		}
 		err := c.Compile(node.Expression)
 		if err != nil {
 			return err
 		}
-		c.emit(code.OpPop)
+		// assignments leave no value behind
+		if !isAssignment(node.Expression) {
+			c.emit(code.OpPop)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.Compile(s)
+			if err != nil {
+				return err
+			}
+		}
+	case *ast.LetStatement:
+		// a function sees the name it is bound to, so that it can
+		// call itself
+		if isFunctionLiteral(node.Value) {
+			c.symbolTable.Define(node.Name.Value)
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		symbol := c.symbolTable.Define(node.Name.Value)
+		c.setSymbol(symbol)
+	case *ast.AssignStatement:
+		// like Environment.Set: rebind the nearest definition
+		// or define the name in the current scope
+		symbol, ok := c.symbolTable.Resolve(node.Name.Value)
+		if !ok && isFunctionLiteral(node.Value) {
+			symbol, ok = c.symbolTable.Define(node.Name.Value), true
+		}
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			symbol = c.symbolTable.Define(node.Name.Value)
+		}
+		c.setSymbol(symbol)
+	case *ast.Identifier:
+		// names that are not defined anywhere yet are builtins or
+		// taken to be globals defined later; reading them before that
+		// fails at run time the way it does in the evaluator
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			if index, ok := builtins.Index(node.Value); ok {
+				c.emit(code.OpGetBuiltin, index)
+				return nil
+			}
+			if index, ok := exceptionIndex(node.Value); ok {
+				c.emit(code.OpGetException, index)
+				return nil
+			}
+			symbol = c.symbolTable.Global().Define(node.Value)
+		}
+		c.loadSymbol(symbol)
 	case *ast.InfixExpression:
+		if node.Operator == "and" || node.Operator == "or" {
+			return c.compileLogical(node)
+		}
+
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
@@ -55,16 +207,979 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpMul)
 		case "/":
 			c.emit(code.OpDiv)
+		case "==":
+			c.emit(code.OpEqual)
+		case "!=":
+			c.emit(code.OpNotEqual)
+		case ">":
+			c.emit(code.OpGreaterThan)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessEqual)
+		case ">=":
+			c.emit(code.OpGreaterEqual)
+		case "%":
+			c.emit(code.OpMod)
+		case "**":
+			c.emit(code.OpPow)
+		case "//":
+			c.emit(code.OpFloorDiv)
+		case "&":
+			c.emit(code.OpBitAnd)
+		case "|":
+			c.emit(code.OpBitOr)
+		case "^":
+			c.emit(code.OpBitXor)
+		case "<<":
+			c.emit(code.OpShiftLeft)
+		case ">>":
+			c.emit(code.OpShiftRight)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+	case *ast.PrefixExpression:
+		err := c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		case "+":
+			c.emit(code.OpPlus)
+		case "~":
+			c.emit(code.OpBitNot)
 		default:
 			return fmt.Errorf("unknown operator %s", node.Operator)
 		}
+	case *ast.IfExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.compileBlockValue(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+		} else {
+			err := c.compileBlockValue(node.Alternative)
+			if err != nil {
+				return err
+			}
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	case *ast.ConditionalExpression:
+		err := c.Compile(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		err = c.Compile(node.Consequence)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(code.OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+		err = c.Compile(node.Alternative)
+		if err != nil {
+			return err
+		}
+		c.changeOperand(jumpPos, len(c.currentInstructions()))
+	case *ast.WhileStatement:
+		start := len(c.currentInstructions())
+
+		err := c.Compile(node.Cond)
+		if err != nil {
+			return err
+		}
+		exitPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+		c.enterLoop()
+		err = c.Compile(node.Body)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpJump, start)
+		c.changeOperand(exitPos, len(c.currentInstructions()))
+		c.leaveLoop(len(c.currentInstructions()), start)
+	case *ast.ForStatement:
+		if node.Iter != nil {
+			return c.compileForInStatement(node)
+		}
+		return c.compileForStatement(node)
+	case *ast.BreakStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("'break' outside loop")
+		}
+		err := c.leaveTries(l.tries)
+		if err != nil {
+			return err
+		}
+		c.popPending(l.pending)
+		l.breaks = append(l.breaks, c.emit(code.OpJump, 9999))
+	case *ast.ContinueStatement:
+		l := c.currentLoop()
+		if l == nil {
+			return fmt.Errorf("'continue' outside loop")
+		}
+		err := c.leaveTries(l.tries)
+		if err != nil {
+			return err
+		}
+		if l.iterator {
+			c.popPending(l.pending + 1)
+		} else {
+			c.popPending(l.pending)
+		}
+		l.continues = append(l.continues, c.emit(code.OpJump, 9999))
+	case *ast.ReturnStatement:
+		err := c.Compile(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		// the value waits on the stack for the finally blocks
+		c.scopes[c.scopeIndex].pending++
+		err = c.leaveTries(0)
+		c.scopes[c.scopeIndex].pending--
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpReturnValue)
+	case *ast.TryStatement:
+		return c.compileTryStatement(node)
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.ImportLiteral:
+		return c.compileImport(node)
+	case *ast.FunctionLiteral:
+		return c.compileFunctionLiteral(node)
+	case *ast.CallExpression:
+		err := c.Compile(node.Function)
+		if err != nil {
+			return err
+		}
+
+		for _, a := range node.Arguments {
+			switch a.(type) {
+			case *ast.KeywordArgument, *ast.SpreadExpression:
+				return c.compileCallKw(node.Arguments)
+			}
+		}
+		for _, a := range node.Arguments {
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpCall, len(node.Arguments))
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInteger{Value: node.Big}
+		}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+	case *ast.StringLiteral:
+		str := object.NewString(node.Value)
+		c.emit(code.OpConstant, c.addConstant(str))
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+	case *ast.ArrayLiteral:
+		return c.compileElements(node.Elements, code.OpArray, code.OpExtendArray)
+	case *ast.HashLiteral:
+		// sort the keys so that the output does not depend on map order
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		elements := make([]ast.Expression, 0, len(keys)*2)
+		for _, k := range keys {
+			elements = append(elements, k, node.Pairs[k])
+		}
+		return c.compileElements(elements, code.OpHash, code.OpExtendHash)
+	case *ast.IndexExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		err = c.Compile(node.Index)
+		if err != nil {
+			return err
+		}
+
+		if node.Right == nil {
+			c.emit(code.OpIndex)
+			return nil
+		}
+
+		err = c.Compile(node.Right)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetIndex)
+	case *ast.SelectorExpr:
+		err := c.Compile(node.Expression)
+		if err != nil {
+			return err
+		}
+		name := c.addConstant(object.NewString(node.Selector.Value))
+
+		if node.Value == nil {
+			c.emit(code.OpGetAttr, name)
+			return nil
+		}
+
+		err = c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpSetAttr, name)
+	case *ast.ClassLiteral:
+		return c.compileClassLiteral(node)
+	default:
+		return fmt.Errorf("cannot compile %T", node)
+	}
+	return nil
+}
+
+// compileForStatement compiles a C-style for loop. Its clauses and body
+// share one block scope, as they share one environment in the evaluator.
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	outer := c.symbolTable
+	c.symbolTable = NewBlockSymbolTable(outer)
+	defer func() { c.symbolTable = outer }()
+
+	if node.Init != nil {
+		err := c.Compile(node.Init)
+		if err != nil {
+			return err
+		}
+	}
+
+	start := len(c.currentInstructions())
+	exitPos := -1
+	if node.Cond != nil {
+		err := c.Compile(node.Cond)
+		if err != nil {
+			return err
+		}
+		exitPos = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	c.enterLoop()
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	post := len(c.currentInstructions())
+	if node.Post != nil {
+		err := c.Compile(node.Post)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpJump, start)
+
+	end := len(c.currentInstructions())
+	if exitPos >= 0 {
+		c.changeOperand(exitPos, end)
+	}
+	c.leaveLoop(end, post)
+
+	return nil
+}
+
+// compileForInStatement compiles a for-in loop, which keeps the iterator
+// over its collection on the stack while it runs. Like the for loop, it
+// gets a block scope, in which the loop variables are assigned.
+func (c *Compiler) compileForInStatement(node *ast.ForStatement) error {
+	outer := c.symbolTable
+	c.symbolTable = NewBlockSymbolTable(outer)
+	defer func() { c.symbolTable = outer }()
+
+	err := c.Compile(node.Iter)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpGetIter, len(node.Vars))
+
+	c.enterLoop()
+	c.currentLoop().iterator = true
+	c.scopes[c.scopeIndex].pending++
+
+	next := c.emit(code.OpForIter, 9999)
+	if len(node.Vars) > 1 {
+		c.emit(code.OpUnpack, len(node.Vars))
+	}
+	for _, v := range node.Vars {
+		c.setSymbol(c.assignedSymbol(v.Value))
+	}
+
+	err = c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpJump, next)
+
+	c.scopes[c.scopeIndex].pending--
+	end := len(c.currentInstructions())
+	c.changeOperand(next, end)
+	c.leaveLoop(end, next)
+
+	return nil
+}
+
+// compileTryStatement compiles a try statement. Its block runs with a
+// handler for the catch clauses and one for the finally block set up,
+// and the finally block is compiled once for leaving the statement
+// normally and once for leaving it with an error, which it raises again
+// afterwards. Break, continue and return run it where they leave.
+func (c *Compiler) compileTryStatement(node *ast.TryStatement) error {
+	t := &tryBlock{finally: node.Finally}
+
+	finallyPos := -1
+	if node.Finally != nil {
+		finallyPos = c.emit(code.OpSetupTry, 9999)
+		t.handlers++
+	}
+	catchPos := -1
+	if len(node.Catches) > 0 {
+		catchPos = c.emit(code.OpSetupTry, 9999)
+		t.handlers++
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.tries = append(scope.tries, t)
+
+	err := c.Compile(node.Block)
+	if err != nil {
+		return err
+	}
+
+	var done []int
+	if catchPos >= 0 {
+		c.emit(code.OpPopTry)
+		t.handlers--
+		done = append(done, c.emit(code.OpJump, 9999))
+
+		c.changeOperand(catchPos, len(c.currentInstructions()))
+		jumps, err := c.compileCatchClauses(node.Catches)
+		if err != nil {
+			return err
+		}
+		done = append(done, jumps...)
+	}
+
+	scope = &c.scopes[c.scopeIndex]
+	scope.tries = scope.tries[:len(scope.tries)-1]
+	for _, pos := range done {
+		c.changeOperand(pos, len(c.currentInstructions()))
+	}
+
+	if node.Finally == nil {
+		return nil
+	}
+	c.emit(code.OpPopTry)
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+	end := c.emit(code.OpJump, 9999)
+
+	c.changeOperand(finallyPos, len(c.currentInstructions()))
+	c.scopes[c.scopeIndex].pending++
+	err = c.Compile(node.Finally)
+	c.scopes[c.scopeIndex].pending--
+	if err != nil {
+		return err
+	}
+	c.emit(code.OpThrow)
+	c.changeOperand(end, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileCatchClauses compiles the clauses of a try statement, which
+// start with the exception on the stack, and returns the jumps that
+// leave them. The exception is raised again if no clause takes it.
+func (c *Compiler) compileCatchClauses(clauses []*ast.CatchClause) ([]int, error) {
+	var jumps []int
+	for _, clause := range clauses {
+		next := -1
+		if clause.Type != nil {
+			err := c.Compile(clause.Type)
+			if err != nil {
+				return nil, err
+			}
+			next = c.emit(code.OpCatch, 9999)
+		}
+
+		if clause.Param != nil {
+			c.setSymbol(c.assignedSymbol(clause.Param.Value))
+		} else {
+			c.emit(code.OpPop)
+		}
+
+		err := c.Compile(clause.Body)
+		if err != nil {
+			return nil, err
+		}
+		jumps = append(jumps, c.emit(code.OpJump, 9999))
+
+		if next >= 0 {
+			c.changeOperand(next, len(c.currentInstructions()))
+		}
+	}
+	c.emit(code.OpThrow)
+
+	return jumps, nil
+}
+
+// leaveTries pops the handlers of the try statements above depth and runs
+// their finally blocks, innermost first, for leaving them with a jump or
+// a return. A finally block runs outside its own statement.
+func (c *Compiler) leaveTries(depth int) error {
+	tries := c.scopes[c.scopeIndex].tries
+	defer func() { c.scopes[c.scopeIndex].tries = tries }()
+
+	for i := len(tries) - 1; i >= depth; i-- {
+		t := tries[i]
+		for j := 0; j < t.handlers; j++ {
+			c.emit(code.OpPopTry)
+		}
+		if t.finally == nil {
+			continue
+		}
+		c.scopes[c.scopeIndex].tries = tries[:i]
+		err := c.Compile(t.finally)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// popPending pops the pending values above depth.
+func (c *Compiler) popPending(depth int) {
+	for i := depth; i < c.scopes[c.scopeIndex].pending; i++ {
+		c.emit(code.OpPop)
+	}
+}
+
+// compileImport compiles the module named by node into a function that
+// runs its statements and returns a module of the variables they set,
+// and binds the module to its name. As in the evaluator, the module is
+// loaded anew by every import and does not see the variables of the
+// importing scope; the names it does not define are looked up among the
+// globals and builtins. A module that cannot be read or parsed raises an
+// ImportError when the import runs, unless StrictImports is set.
+func (c *Compiler) compileImport(node *ast.ImportLiteral) error {
+	name := node.Name.Value
+	if c.importing[name] {
+		return fmt.Errorf("cannot import %s: import cycle", name)
+	}
+
+	path := object.ImportPath(name)
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return c.importFailed(fmt.Sprintf("cannot import %s: %s", name, err))
+	}
+	p := parser.New(lexer.NewFile(path, string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return c.importFailed(fmt.Sprintf("cannot import %s: invalid syntax", name))
+	}
+
+	c.importing[name] = true
+	defer delete(c.importing, name)
+
+	outer := c.symbolTable
+	c.symbolTable = outer.Global()
+	c.enterScope()
+
+	// the functions of the module see all of its variables, whatever
+	// the order they are defined in, as they would at the top level
+	for _, n := range definedNames(program) {
+		c.symbolTable.Define(n)
+	}
+
+	err = c.Compile(program)
+	if err != nil {
+		c.leaveScope()
+		c.symbolTable = outer
+		return err
+	}
+	c.emit(code.OpModule, c.addConstant(object.NewString(name)))
+	c.emit(code.OpReturnValue)
+
+	fn := &object.CompiledFunction{
+		NumLocals:  c.symbolTable.NumLocals(),
+		LocalNames: c.symbolTable.LocalNames(),
+		Name:       name,
+	}
+	fn.Instructions, fn.SourceMap = c.leaveScope()
+	c.symbolTable = outer
+
+	c.emit(code.OpClosure, c.addConstant(fn), 0)
+	c.emit(code.OpCall, 0)
+
+	symbol := c.assignedSymbol(name)
+	c.setSymbol(symbol)
+	c.loadSymbol(symbol)
+
+	return nil
+}
+
+// importFailed reports a module that cannot be imported, as an error of
+// the compilation or as an ImportError raised at run time.
+func (c *Compiler) importFailed(message string) error {
+	if c.StrictImports {
+		return errors.New(message)
+	}
+	return c.compileRaise(object.ImportError, message)
+}
+
+// compileRaise compiles raising an error of the built-in class cls with
+// message.
+func (c *Compiler) compileRaise(cls *object.Class, message string) error {
+	index, ok := exceptionIndex(cls.Name.Value)
+	if !ok {
+		return fmt.Errorf("not a built-in exception: %s", cls.Name.Value)
+	}
+	c.emit(code.OpGetException, index)
+	c.emit(code.OpConstant, c.addConstant(object.NewString(message)))
+	c.emit(code.OpCall, 1)
+	c.emit(code.OpThrow)
+	return nil
+}
+
+// definedNames returns the names the top-level statements of program
+// define.
+func definedNames(program *ast.Program) []string {
+	var names []string
+	for _, s := range program.Statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			names = append(names, s.Name.Value)
+		case *ast.AssignStatement:
+			names = append(names, s.Name.Value)
+		case *ast.ExpressionStatement:
+			switch exp := s.Expression.(type) {
+			case *ast.FunctionLiteral:
+				if exp.Name != nil {
+					names = append(names, exp.Name.Value)
+				}
+			case *ast.ClassLiteral:
+				if exp.Name != nil {
+					names = append(names, exp.Name.Value)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// exceptionIndex returns the index of the built-in exception class called
+// name in object.Exceptions.
+func exceptionIndex(name string) (int, bool) {
+	for i, cls := range object.Exceptions {
+		if cls.Name.Value == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// assignedSymbol returns the symbol assigning to name sets, which like
+// Environment.Set is the nearest definition or a new one in the current
+// scope.
+func (c *Compiler) assignedSymbol(name string) Symbol {
+	symbol, ok := c.symbolTable.Resolve(name)
+	if !ok {
+		symbol = c.symbolTable.Define(name)
+	}
+	return symbol
+}
+
+func isFunctionLiteral(node ast.Expression) bool {
+	_, ok := node.(*ast.FunctionLiteral)
+	return ok
+}
+
+// compileFunctionLiteral compiles the body of node into a constant and
+// emits the instructions that make a closure of it. Like the evaluator,
+// a named literal also binds the function to its name, which the body
+// can use to call itself.
+func (c *Compiler) compileFunctionLiteral(node *ast.FunctionLiteral) error {
+	var name Symbol
+	if node.Name != nil {
+		name = c.symbolTable.Define(node.Name.Value)
+	}
+
+	// default values are computed once, in the enclosing scope
+	numDefaults := 0
+	for _, def := range node.Defaults {
+		if def == nil {
+			continue
+		}
+		err := c.Compile(def)
+		if err != nil {
+			return err
+		}
+		numDefaults++
+	}
+
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.Define(p.Value)
+	}
+	if node.Rest != nil {
+		c.symbolTable.Define(node.Rest.Value)
+	}
+	method := c.scopes[c.scopeIndex-1].classBody
+	var self Symbol
+	if method {
+		self = c.symbolTable.Define("self")
+		// methods keep the class they belong to, for super()
+		c.symbolTable.Resolve(object.MAGIC_ATTR_CLASS)
 	}
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	// the value of the last expression is the result of the call
+	if c.lastInstructionIs(code.OpPop) {
+		c.replaceLastPopWithReturn()
+	}
+	if !c.lastInstructionIs(code.OpReturnValue) {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	numLocals := c.symbolTable.NumLocals()
+	localNames := c.symbolTable.LocalNames()
+	freeNames := c.symbolTable.FreeNames()
+	instructions, sourceMap := c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+
+	fn := &object.CompiledFunction{
+		Instructions:  instructions,
+		SourceMap:     sourceMap,
+		NumLocals:     numLocals,
+		NumParameters: len(node.Parameters),
+		NumDefaults:   numDefaults,
+		Rest:          node.Rest != nil,
+		Method:        method,
+		SelfIndex:     self.Index,
+		LocalNames:    localNames,
+		FreeNames:     freeNames,
+	}
+	if node.Name != nil {
+		fn.Name = node.Name.Value
+	}
+
+	fnIndex := c.addConstant(fn)
+	c.emit(code.OpClosure, fnIndex, len(freeSymbols))
+
+	if node.Name != nil {
+		c.setSymbol(name)
+		c.loadSymbol(name)
+	}
+
 	return nil
 }
 
+// compileClassLiteral compiles a class the way Python builds one: the
+// body is compiled as a function that is called once with the new class
+// as its only argument, __class__, and copies the names it defines onto
+// the class before returning it.
+func (c *Compiler) compileClassLiteral(node *ast.ClassLiteral) error {
+	if node.Name == nil {
+		return fmt.Errorf("class literal without a name")
+	}
+	name := c.symbolTable.Define(node.Name.Value)
+
+	c.enterScope()
+	c.scopes[c.scopeIndex].classBody = true
+
+	class := c.symbolTable.Define(object.MAGIC_ATTR_CLASS)
+
+	err := c.Compile(node.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range c.symbolTable.Locals() {
+		if s == class {
+			continue
+		}
+		c.loadSymbol(class)
+		c.loadSymbol(s)
+		c.emit(code.OpSetAttr, c.addConstant(object.NewString(s.Name)))
+	}
+	c.loadSymbol(class)
+	c.emit(code.OpReturnValue)
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	fn := &object.CompiledFunction{
+		NumLocals:     c.symbolTable.NumLocals(),
+		NumParameters: 1,
+		LocalNames:    c.symbolTable.LocalNames(),
+		FreeNames:     c.symbolTable.FreeNames(),
+		Name:          node.Name.Value,
+	}
+	fn.Instructions, fn.SourceMap = c.leaveScope()
+
+	for _, s := range freeSymbols {
+		c.captureSymbol(s)
+	}
+	c.emit(code.OpClosure, c.addConstant(fn), len(freeSymbols))
+
+	for _, b := range node.Bases {
+		err := c.Compile(b)
+		if err != nil {
+			return err
+		}
+	}
+	c.emit(code.OpClass, c.addConstant(object.NewString(node.Name.Value)), len(node.Bases))
+	c.emit(code.OpCall, 1)
+
+	c.setSymbol(name)
+	c.loadSymbol(name)
+
+	return nil
+}
+
+// compileCallKw compiles the arguments of a call with keyword or spread
+// arguments, in the order they were written, and the call. Each run of
+// positional arguments becomes an array, as does each spread argument;
+// keyword arguments are their name followed by their value.
+func (c *Compiler) compileCallKw(arguments []ast.Expression) error {
+	items, positional := 0, 0
+	flush := func() {
+		if positional > 0 {
+			c.emit(code.OpArray, positional)
+			items++
+			positional = 0
+		}
+	}
+
+	for _, a := range arguments {
+		switch a := a.(type) {
+		case *ast.KeywordArgument:
+			flush()
+			c.emit(code.OpConstant, c.addConstant(object.NewString(a.Name.Value)))
+			err := c.Compile(a.Value)
+			if err != nil {
+				return err
+			}
+			items += 2
+		case *ast.SpreadExpression:
+			flush()
+			err := c.Compile(a.Value)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpSpread)
+			items++
+		default:
+			err := c.Compile(a)
+			if err != nil {
+				return err
+			}
+			positional++
+		}
+	}
+	flush()
+
+	c.emit(code.OpCallKw, items)
+	return nil
+}
+
+// literalChunk bounds the number of elements of an array or hash literal
+// that are on the stack at once, so that large literals fit on it.
+const literalChunk = 256
+
+// compileElements compiles the elements of an array or hash literal and
+// emits op to build it from them. Past literalChunk elements the literal
+// is built from the first chunk and then extended by each next one.
+func (c *Compiler) compileElements(elements []ast.Expression, op, extend code.Opcode) error {
+	start := 0
+	for {
+		end := len(elements)
+		if end-start > literalChunk {
+			end = start + literalChunk
+		}
+		for _, el := range elements[start:end] {
+			err := c.Compile(el)
+			if err != nil {
+				return err
+			}
+		}
+		if start == 0 {
+			c.emit(op, end)
+		} else {
+			c.emit(extend, end-start)
+		}
+		if end == len(elements) {
+			return nil
+		}
+		start = end
+	}
+}
+
+// compileLogical compiles and and or, which evaluate their right operand
+// only when the left one does not decide the result and give the operand
+// that decides it.
+func (c *Compiler) compileLogical(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+
+	op := code.OpJumpNotTruthyOrPop
+	if node.Operator == "or" {
+		op = code.OpJumpTruthyOrPop
+	}
+	jumpPos := c.emit(op, 9999)
+
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+	return nil
+}
+
+// compileBlockValue compiles block so that it leaves the value of its
+// last expression statement on the stack, or null if there is none.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	start := len(c.currentInstructions())
+
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	if len(c.currentInstructions()) > start && c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+	return nil
+}
+
+func (c *Compiler) enterLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = append(scope.loops, &loop{tries: len(scope.tries), pending: scope.pending})
+}
+
+// leaveLoop points the break statements of the innermost loop to end
+// and its continue statements to next.
+func (c *Compiler) leaveLoop(end, next int) {
+	scope := &c.scopes[c.scopeIndex]
+	l := scope.loops[len(scope.loops)-1]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+
+	for _, pos := range l.breaks {
+		c.changeOperand(pos, end)
+	}
+	for _, pos := range l.continues {
+		c.changeOperand(pos, next)
+	}
+}
+
+func (c *Compiler) currentLoop() *loop {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+func (c *Compiler) loadSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpGetFree, s.Index)
+	}
+}
+
+// captureSymbol pushes the cell of a variable a closure captures.
+func (c *Compiler) captureSymbol(s Symbol) {
+	switch s.Scope {
+	case LocalScope:
+		c.emit(code.OpCaptureLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpCaptureFree, s.Index)
+	}
+}
+
+func (c *Compiler) setSymbol(s Symbol) {
+	switch s.Scope {
+	case GlobalScope:
+		c.emit(code.OpSetGlobal, s.Index)
+	case LocalScope:
+		c.emit(code.OpSetLocal, s.Index)
+	case FreeScope:
+		c.emit(code.OpSetFree, s.Index)
+	}
+}
+
+// isAssignment reports whether exp assigns a value instead of producing one.
+func isAssignment(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.IndexExpression:
+		return exp.Right != nil
+	case *ast.SelectorExpr:
+		return exp.Value != nil
+	}
+	return false
+}
+
 func (c *Compiler) addConstant(obj object.Object) int {
 	c.constants = append(c.constants, obj)
 	return len(c.constants) - 1
@@ -73,23 +1188,123 @@ func (c *Compiler) addConstant(obj object.Object) int {
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
 	return pos
 }
 
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction
+
+	scope.instructions = scope.instructions[:last.Position]
+	scope.sourceMap = scope.sourceMap.Truncate(last.Position)
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
 func (c *Compiler) addInstruction(ins []byte) int {
-	posNewInstruction := len(c.instructions)
-	c.instructions = append(c.instructions, ins...)
+	scope := &c.scopes[c.scopeIndex]
+
+	posNewInstruction := len(scope.instructions)
+	scope.instructions = append(scope.instructions, ins...)
+	if c.pos.IsValid() {
+		scope.sourceMap = scope.sourceMap.Add(posNewInstruction, c.pos)
+	}
 	return posNewInstruction
 }
 
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
+	scope := c.scopes[c.scopeIndex]
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return scope.instructions, scope.sourceMap
+}
+
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
-		Instructions: c.instructions,
+		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Globals:      c.symbolTable.Names(),
+		NumLocals:    c.symbolTable.NumLocals(),
+		Locals:       c.symbolTable.LocalNames(),
 	}
 }
 
+// SymbolTable returns the global symbol table, to be handed to the
+// compiler of the next REPL line.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+// Constants returns the constant pool built so far.
+func (c *Compiler) Constants() []object.Object {
+	return c.constants
+}
+
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+
+	// debug information
+	SourceMap code.SourceMap
+	Globals   []string // names of the global slots
+	Locals    []string // names of the local slots of the program
+
+	// NumLocals is the number of local slots the top level of the
+	// program needs for the variables of its block scopes.
+	NumLocals int
 }
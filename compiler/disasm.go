@@ -0,0 +1,143 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+// Disassemble writes a listing of b to w: the constant pool, then the
+// instructions of the top level and of every function constant. Each
+// run of instructions is preceded by the source line it was compiled
+// from. source returns the lines of a file, or nil when they are not
+// available, in which case only the line numbers are shown.
+func Disassemble(w io.Writer, b *Bytecode, source func(filename string) []string) {
+	fmt.Fprintln(w, "== constants ==")
+	for i, c := range b.Constants {
+		fmt.Fprintf(w, "%04d %s\n", i, formatConstant(c))
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "== <module> ==")
+	main := &object.CompiledFunction{
+		Instructions: b.Instructions,
+		SourceMap:    b.SourceMap,
+		LocalNames:   b.Locals,
+	}
+	disassemble(w, b, main, source)
+
+	for i, c := range b.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "== %s (constant %d) ==\n", fn.DisplayName(), i)
+		fmt.Fprintf(w, "locals %v, free %v\n", fn.LocalNames, fn.FreeNames)
+		disassemble(w, b, fn, source)
+	}
+}
+
+func disassemble(
+	w io.Writer,
+	b *Bytecode,
+	fn *object.CompiledFunction,
+	source func(filename string) []string,
+) {
+	ins := fn.Instructions
+	line, filename := 0, ""
+	for i := 0; i < len(ins); {
+		pos := fn.SourceMap.Lookup(i)
+		if pos.IsValid() && (pos.Line != line || pos.Filename != filename) {
+			line, filename = pos.Line, pos.Filename
+			fmt.Fprintf(w, "%s\n", formatSourceLine(pos.Filename, pos.Line, source))
+		}
+
+		text, width := ins.Format(i)
+		if note := annotate(b, fn, ins[i:i+width]); note != "" {
+			text = fmt.Sprintf("%-24s ; %s", text, note)
+		}
+		fmt.Fprintf(w, "    %04d %s\n", i, text)
+		i += width
+	}
+}
+
+// annotate names what the operand of ins refers to, such as the variable
+// of OpGetLocal or the value of OpConstant.
+func annotate(b *Bytecode, fn *object.CompiledFunction, ins code.Instructions) string {
+	def, err := code.Lookup(ins[0])
+	if err != nil || len(def.OperandWidths) == 0 {
+		return ""
+	}
+	width := 1
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	if len(ins) < width {
+		return ""
+	}
+	operands, _ := code.ReadOperands(def, ins[1:])
+	index := operands[0]
+
+	var names []string
+	switch code.Opcode(ins[0]) {
+	case code.OpConstant, code.OpClosure, code.OpGetAttr, code.OpSetAttr, code.OpClass:
+		if index >= len(b.Constants) {
+			return "constant out of range"
+		}
+		if s, ok := b.Constants[index].(*object.String); ok {
+			return strconv.Quote(s.Value)
+		}
+		return b.Constants[index].Inspect()
+	case code.OpGetGlobal, code.OpSetGlobal:
+		names = b.Globals
+	case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+		names = fn.LocalNames
+	case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+		names = fn.FreeNames
+	case code.OpAddLocal:
+		if index < len(fn.LocalNames) && operands[1] < len(b.Constants) {
+			return fmt.Sprintf("%s += %s", fn.LocalNames[index], b.Constants[operands[1]].Inspect())
+		}
+	case code.OpGetBuiltin:
+		if builtin := builtins.Get(index); builtin != nil {
+			return builtin.Name
+		}
+	}
+	if index < len(names) {
+		return names[index]
+	}
+	return ""
+}
+
+func formatSourceLine(filename string, line int, source func(string) []string) string {
+	if filename == "" {
+		filename = "<stdin>"
+	}
+	text := fmt.Sprintf("%s:%d", filename, line)
+
+	if source == nil {
+		return text
+	}
+	if lines := source(filename); line <= len(lines) {
+		text += "  " + lines[line-1]
+	}
+	return text
+}
+
+func formatConstant(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return fmt.Sprintf("%s %s", obj.Type(), strconv.Quote(obj.Value))
+	case *object.CompiledFunction:
+		return fmt.Sprintf("%s %s params=%d defaults=%d rest=%t locals=%d free=%d",
+			obj.Type(), obj.DisplayName(), obj.NumParameters, obj.NumDefaults, obj.Rest,
+			obj.NumLocals, len(obj.FreeNames))
+	default:
+		return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
+	}
+}
@@ -0,0 +1,63 @@
+package compiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+func TestDisassemble(t *testing.T) {
+	input := "let a = 1;\nfn add(x) { x + a }\nprint(add(2));"
+	b := compileFile(t, "main.fl", input)
+
+	var out bytes.Buffer
+	Disassemble(&out, b, func(filename string) []string {
+		if filename != "main.fl" {
+			t.Errorf("source asked for %q", filename)
+		}
+		return strings.Split(input, "\n")
+	})
+
+	for _, want := range []string{
+		"== constants ==",
+		"== <module> ==",
+		"== add (constant ",
+		"locals [x], free []",
+		"main.fl:1  let a = 1;",
+		"main.fl:2  fn add(x) { x + a }",
+		"main.fl:3  print(add(2));",
+		"; a",
+		"; x",
+		"; print",
+		"; <compiled function add>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestDisassembleBadInstructions(t *testing.T) {
+	b := &Bytecode{
+		Instructions: append(code.Make(code.OpConstant, 0), 255),
+		Constants: []object.Object{&object.CompiledFunction{
+			Name:         "broken",
+			Instructions: code.Make(code.OpConstant, 1)[:2],
+		}},
+	}
+
+	var out bytes.Buffer
+	Disassemble(&out, b, nil)
+
+	for _, want := range []string{
+		"0003 ERROR: opcode 255 undefined",
+		"0000 ERROR: OpConstant truncated, 2 of 3 bytes",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
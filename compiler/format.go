@@ -0,0 +1,517 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+// A compiled program is stored in a .flc file laid out as follows. All
+// counts and integers are varints unless noted otherwise.
+//
+//	magic      4 bytes, "\x7fFLC"
+//	version    2 bytes, big endian
+//	checksum   4 bytes, big endian, the CRC-32 (IEEE) of all that follows
+//	filenames  count, then strings; positions refer to them by index
+//	globals    count, then the names of the global slots
+//	main       the top level, encoded like a function constant
+//	constants  count, then one tagged constant each
+//
+// Strings are a length followed by their bytes. Functions carry their
+// debug line table, a source map from instruction offsets to positions.
+//
+// Decode rejects files that do not match their checksum, and programs
+// whose operands refer to anything the program does not have, so that
+// neither corruption nor a hand-made file can crash the VM that way.
+//
+// Version has to change whenever the meaning of existing bytes does: a
+// different layout, renumbered opcodes or reordered builtins, whose
+// indexes are part of the instructions.
+const (
+	Magic   = "\x7fFLC"
+	Version = 2
+)
+
+const (
+	tagInteger byte = iota + 1
+	tagFloat
+	tagString
+	tagBoolean
+	tagNull
+	tagFunction
+	tagBigInteger
+)
+
+const (
+	flagRest byte = 1 << iota
+	flagMethod
+)
+
+// IsBytecode reports whether data starts like a compiled program.
+func IsBytecode(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+// Encode writes b to w in the .flc format.
+func (b *Bytecode) Encode(w io.Writer) error {
+	e := &encoder{files: map[string]int{}}
+
+	e.strings(b.Globals)
+	err := e.function(&object.CompiledFunction{
+		Instructions: b.Instructions,
+		SourceMap:    b.SourceMap,
+		NumLocals:    b.NumLocals,
+		LocalNames:   b.Locals,
+	})
+	if err != nil {
+		return err
+	}
+	e.uint(len(b.Constants))
+	for _, c := range b.Constants {
+		if err := e.constant(c); err != nil {
+			return err
+		}
+	}
+
+	// the filenames are only known once everything else is encoded
+	header := &encoder{}
+	header.buf = append(header.buf, Magic...)
+	header.buf = binary.BigEndian.AppendUint16(header.buf, Version)
+	names := &encoder{}
+	names.strings(e.fileNames)
+	body := append(names.buf, e.buf...)
+	header.buf = binary.BigEndian.AppendUint32(header.buf, crc32.ChecksumIEEE(body))
+
+	if _, err := w.Write(header.buf); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// Decode reads a program in the .flc format.
+func Decode(r io.Reader) (*Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !IsBytecode(data) {
+		return nil, errors.New("not a compiled firefly program")
+	}
+	d := &decoder{data: data, pos: len(Magic)}
+
+	if version := d.uint16(); d.err == nil && version != Version {
+		return nil, fmt.Errorf("unsupported bytecode version %d, want %d", version, Version)
+	}
+	if sum := d.uint32(); d.err == nil && sum != crc32.ChecksumIEEE(d.data[d.pos:]) {
+		return nil, errors.New("invalid bytecode: checksum mismatch")
+	}
+	d.fileNames = d.strings()
+	globals := d.strings()
+	main := d.function()
+
+	constants := make([]object.Object, d.count())
+	for i := range constants {
+		constants[i] = d.constant()
+	}
+	if d.err == nil && d.pos != len(d.data) {
+		d.fail("%d trailing bytes", len(d.data)-d.pos)
+	}
+	d.verify(main, constants, len(globals))
+	for _, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			d.verify(fn, constants, len(globals))
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	return &Bytecode{
+		Instructions: main.Instructions,
+		Constants:    constants,
+		SourceMap:    main.SourceMap,
+		Globals:      globals,
+		Locals:       main.LocalNames,
+		NumLocals:    main.NumLocals,
+	}, nil
+}
+
+type encoder struct {
+	buf       []byte
+	files     map[string]int
+	fileNames []string
+}
+
+func (e *encoder) uint(n int)  { e.buf = binary.AppendUvarint(e.buf, uint64(n)) }
+func (e *encoder) int(n int64) { e.buf = binary.AppendVarint(e.buf, n) }
+func (e *encoder) byte(b byte) { e.buf = append(e.buf, b) }
+func (e *encoder) bytes(b []byte) {
+	e.uint(len(b))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) { e.bytes([]byte(s)) }
+
+func (e *encoder) strings(ss []string) {
+	e.uint(len(ss))
+	for _, s := range ss {
+		e.string(s)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) error {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.byte(tagInteger)
+		e.int(obj.Value)
+	case *object.BigInteger:
+		e.byte(tagBigInteger)
+		e.string(obj.Value.String())
+	case *object.Float:
+		e.byte(tagFloat)
+		e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(obj.Value))
+	case *object.String:
+		e.byte(tagString)
+		e.string(obj.Value)
+	case *object.Boolean:
+		e.byte(tagBoolean)
+		if obj.Value {
+			e.byte(1)
+		} else {
+			e.byte(0)
+		}
+	case *object.Null:
+		e.byte(tagNull)
+	case *object.CompiledFunction:
+		e.byte(tagFunction)
+		return e.function(obj)
+	default:
+		return fmt.Errorf("cannot encode constant of type %s", obj.Type())
+	}
+	return nil
+}
+
+func (e *encoder) function(fn *object.CompiledFunction) error {
+	var flags byte
+	if fn.Rest {
+		flags |= flagRest
+	}
+	if fn.Method {
+		flags |= flagMethod
+	}
+
+	e.string(fn.Name)
+	e.byte(flags)
+	e.uint(fn.NumLocals)
+	e.uint(fn.NumParameters)
+	e.uint(fn.NumDefaults)
+	e.uint(fn.SelfIndex)
+	e.strings(fn.LocalNames)
+	e.strings(fn.FreeNames)
+	e.bytes(fn.Instructions)
+
+	e.uint(len(fn.SourceMap))
+	for _, entry := range fn.SourceMap {
+		e.uint(entry.Offset)
+		e.uint(e.file(entry.Pos.Filename))
+		e.uint(entry.Pos.Line)
+		e.uint(entry.Pos.Column)
+	}
+	return nil
+}
+
+func (e *encoder) file(name string) int {
+	index, ok := e.files[name]
+	if !ok {
+		index = len(e.fileNames)
+		e.files[name] = index
+		e.fileNames = append(e.fileNames, name)
+	}
+	return index
+}
+
+// decoder reads what encoder writes. The first error sticks: later reads
+// return zero values, so callers check d.err once at the end.
+type decoder struct {
+	data      []byte
+	pos       int
+	err       error
+	fileNames []string
+}
+
+func (d *decoder) fail(format string, a ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("invalid bytecode at offset %d: %s", d.pos, fmt.Sprintf(format, a...))
+	}
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.pos {
+		d.fail("unexpected end of data")
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) uint() int {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Uvarint(d.data[d.pos:])
+	if size <= 0 || n > math.MaxInt32 {
+		d.fail("bad unsigned integer")
+		return 0
+	}
+	d.pos += size
+	return int(n)
+}
+
+func (d *decoder) int() int64 {
+	if d.err != nil {
+		return 0
+	}
+	n, size := binary.Varint(d.data[d.pos:])
+	if size <= 0 {
+		d.fail("bad integer")
+		return 0
+	}
+	d.pos += size
+	return n
+}
+
+// count reads the length of a list. Every element takes at least one
+// byte, which bounds what corrupt data can make us allocate.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > len(d.data)-d.pos {
+		d.fail("count %d exceeds the data", n)
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) byte() byte {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) bytes() []byte {
+	return d.next(d.count())
+}
+
+func (d *decoder) string() string { return string(d.bytes()) }
+
+func (d *decoder) strings() []string {
+	ss := make([]string, d.count())
+	for i := range ss {
+		ss[i] = d.string()
+	}
+	return ss
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: d.int()}
+	case tagBigInteger:
+		v, ok := new(big.Int).SetString(d.string(), 10)
+		if !ok {
+			d.fail("malformed integer constant")
+			return object.NULL
+		}
+		return &object.BigInteger{Value: v}
+	case tagFloat:
+		b := d.next(8)
+		if b == nil {
+			return object.NULL
+		}
+		return &object.Float{Value: math.Float64frombits(binary.BigEndian.Uint64(b))}
+	case tagString:
+		return object.NewString(d.string())
+	case tagBoolean:
+		if d.byte() != 0 {
+			return object.TRUE
+		}
+		return object.FALSE
+	case tagNull:
+		return object.NULL
+	case tagFunction:
+		return d.function()
+	default:
+		d.fail("unknown constant tag %d", tag)
+		return object.NULL
+	}
+}
+
+func (d *decoder) function() *object.CompiledFunction {
+	fn := &object.CompiledFunction{Name: d.string()}
+
+	flags := d.byte()
+	fn.Rest = flags&flagRest != 0
+	fn.Method = flags&flagMethod != 0
+	fn.NumLocals = d.uint()
+	fn.NumParameters = d.uint()
+	fn.NumDefaults = d.uint()
+	fn.SelfIndex = d.uint()
+	fn.LocalNames = d.strings()
+	fn.FreeNames = d.strings()
+	fn.Instructions = code.Instructions(d.bytes())
+
+	n := d.count()
+	for i := 0; i < n; i++ {
+		offset := d.uint()
+		file := d.uint()
+		pos := token.Position{Line: d.uint(), Column: d.uint()}
+		if file >= len(d.fileNames) {
+			d.fail("unknown file %d", file)
+			break
+		}
+		pos.Filename = d.fileNames[file]
+		fn.SourceMap = append(fn.SourceMap, code.SourceEntry{Offset: offset, Pos: pos})
+	}
+
+	d.check(fn)
+	return fn
+}
+
+// check rejects functions whose slot counts do not add up. Their
+// instructions are verified once the constants they refer to are known.
+func (d *decoder) check(fn *object.CompiledFunction) {
+	if d.err != nil {
+		return
+	}
+	if fn.NumParameters+boolToInt(fn.Rest) > fn.NumLocals ||
+		fn.NumDefaults > fn.NumParameters ||
+		(fn.Method && fn.SelfIndex >= fn.NumLocals) ||
+		len(fn.LocalNames) != fn.NumLocals {
+		d.fail("inconsistent slots in function %s", fn.DisplayName())
+	}
+}
+
+// verify rejects instructions that do not decode, whose operands refer
+// to constants of the wrong kind or to slots, builtins and exceptions
+// that do not exist, and jumps into the middle of an instruction. It does
+// not verify what the instructions do to the stack; the checksum guards
+// against corruption, and a .flc file is trusted like the source it was
+// compiled from.
+func (d *decoder) verify(fn *object.CompiledFunction, constants []object.Object, numGlobals int) {
+	if d.err != nil {
+		return
+	}
+	fail := func(format string, a ...interface{}) {
+		d.fail("function %s: %s", fn.DisplayName(), fmt.Sprintf(format, a...))
+	}
+
+	ins := fn.Instructions
+	starts := make([]bool, len(ins)+1)
+	var jumps []int
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fail("%s", err)
+			return
+		}
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+width > len(ins) {
+			fail("truncated %s", def.Name)
+			return
+		}
+		starts[i] = true
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+
+		var bad bool
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant:
+			bad = operands[0] >= len(constants)
+		case code.OpAddLocal:
+			bad = operands[0] >= fn.NumLocals || operands[1] >= len(constants)
+		case code.OpClosure:
+			closure, ok := constantAt(constants, operands[0]).(*object.CompiledFunction)
+			bad = !ok || operands[1] != len(closure.FreeNames)
+		case code.OpClass, code.OpGetAttr, code.OpSetAttr, code.OpModule:
+			_, ok := constantAt(constants, operands[0]).(*object.String)
+			bad = !ok
+		case code.OpGetGlobal, code.OpSetGlobal:
+			bad = operands[0] >= numGlobals
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+			bad = operands[0] >= fn.NumLocals
+		case code.OpGetFree, code.OpSetFree, code.OpCaptureFree:
+			bad = operands[0] >= len(fn.FreeNames)
+		case code.OpGetBuiltin:
+			bad = builtins.Get(operands[0]) == nil
+		case code.OpGetException:
+			bad = operands[0] >= len(object.Exceptions)
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop,
+			code.OpLessThanJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+			code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+			code.OpForIter, code.OpSetupTry, code.OpCatch:
+			jumps = append(jumps, operands[0])
+		}
+		if bad {
+			fail("bad operands of %s at %d: %v", def.Name, i, operands)
+			return
+		}
+		i += width
+	}
+	starts[len(ins)] = true
+
+	for _, target := range jumps {
+		if target > len(ins) || !starts[target] {
+			fail("jump to %d is not an instruction", target)
+			return
+		}
+	}
+}
+
+// constantAt returns the constant at index, or nil if there is none.
+func constantAt(constants []object.Object, index int) object.Object {
+	if index >= len(constants) {
+		return nil
+	}
+	return constants[index]
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
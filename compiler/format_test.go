@@ -0,0 +1,184 @@
+package compiler
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/lexer"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/parser"
+)
+
+const formatInput = `let a = 1; let f = 2.5; let s = "text"; let b = 100000000000000000000;
+fn add(x, y = 2, ...rest) { x + y }
+class Point {
+  fn __init__(x) { self.x = x; };
+};
+for (let i = 0; i < 2; i = i + 1) { let c = fn() { i }; }
+Point(add(a)).x`
+
+func compileFile(t *testing.T, filename, input string) *Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.NewFile(filename, input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	comp := New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func encode(t *testing.T, b *Bytecode) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := b.Encode(&buf); err != nil {
+		t.Fatalf("encode failed: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeDecode(t *testing.T) {
+	original := compileFile(t, "main.fl", formatInput)
+	// constants the compiler does not emit yet must survive too
+	original.Constants = append(original.Constants, object.TRUE, object.FALSE, object.NULL,
+		&object.Integer{Value: -1 << 62})
+
+	data := encode(t, original)
+	if !IsBytecode(data) {
+		t.Fatalf("encoded data does not start with the magic header")
+	}
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode failed: %s", err)
+	}
+
+	if err := testInstructions([]code.Instructions{original.Instructions}, decoded.Instructions); err != nil {
+		t.Errorf("testInstructions failed: %s", err)
+	}
+	if decoded.NumLocals != original.NumLocals ||
+		strings.Join(decoded.Locals, ",") != strings.Join(original.Locals, ",") ||
+		strings.Join(decoded.Globals, ",") != strings.Join(original.Globals, ",") {
+		t.Errorf("names differ. want=%v %v, got=%v %v",
+			original.Globals, original.Locals, decoded.Globals, decoded.Locals)
+	}
+	if len(decoded.Constants) != len(original.Constants) {
+		t.Fatalf("wrong number of constants. want=%d, got=%d",
+			len(original.Constants), len(decoded.Constants))
+	}
+	for i, c := range original.Constants {
+		if c.Inspect() != decoded.Constants[i].Inspect() {
+			t.Errorf("constant %d differs. want=%s, got=%s", i, c.Inspect(), decoded.Constants[i].Inspect())
+		}
+	}
+
+	pos := decoded.SourceMap.Lookup(len(decoded.Instructions) - 1)
+	if pos.Filename != "main.fl" || pos.Line != 7 {
+		t.Errorf("wrong position of the last instruction: %s", pos)
+	}
+
+	// everything else, such as the functions, is checked by encoding
+	// the decoded program again
+	if !bytes.Equal(encode(t, decoded), data) {
+		t.Errorf("decoded program encodes differently")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	data := encode(t, compileFile(t, "main.fl", formatInput))
+
+	tests := []struct {
+		data     []byte
+		expected string
+	}{
+		{[]byte("let a = 1;"), "not a compiled firefly program"},
+		{append([]byte(Magic), 0, 99), "unsupported bytecode version 99, want 2"},
+		{append(append([]byte{}, data...), 0), "checksum mismatch"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+
+	// every truncation of a valid file is rejected without panicking
+	for n := 0; n < len(data); n++ {
+		if _, err := Decode(bytes.NewReader(data[:n])); err == nil {
+			t.Errorf("no error for data truncated to %d bytes", n)
+		}
+	}
+}
+
+func TestDecodeCorrupted(t *testing.T) {
+	data := encode(t, compileFile(t, "main.fl", formatInput))
+	r := rand.New(rand.NewSource(1))
+
+	for n := 0; n < 200; n++ {
+		corrupted := append([]byte{}, data...)
+		for i := 0; i < 3; i++ {
+			corrupted[len(Magic)+2+r.Intn(len(corrupted)-len(Magic)-2)] ^= byte(1 + r.Intn(255))
+		}
+		if _, err := Decode(bytes.NewReader(corrupted)); err == nil && !bytes.Equal(corrupted, data) {
+			t.Errorf("no error for corrupted data %d", n)
+		}
+	}
+}
+
+func TestDecodeBadOperands(t *testing.T) {
+	tests := []struct {
+		instructions []code.Instructions
+		constants    []object.Object
+		expected     string
+	}{
+		{[]code.Instructions{code.Make(code.OpConstant, 1)}, []object.Object{object.TRUE},
+			"bad operands of OpConstant at 0: [1]"},
+		{[]code.Instructions{code.Make(code.OpGetGlobal, 0)}, nil,
+			"bad operands of OpGetGlobal at 0: [0]"},
+		{[]code.Instructions{code.Make(code.OpGetLocal, 0)}, nil,
+			"bad operands of OpGetLocal at 0: [0]"},
+		{[]code.Instructions{code.Make(code.OpGetFree, 0)}, nil,
+			"bad operands of OpGetFree at 0: [0]"},
+		{[]code.Instructions{code.Make(code.OpGetBuiltin, 255)}, nil,
+			"bad operands of OpGetBuiltin at 0: [255]"},
+		{[]code.Instructions{code.Make(code.OpGetException, 255)}, nil,
+			"bad operands of OpGetException at 0: [255]"},
+		{[]code.Instructions{code.Make(code.OpGetAttr, 0)}, []object.Object{object.TRUE},
+			"bad operands of OpGetAttr at 0: [0]"},
+		{[]code.Instructions{code.Make(code.OpClosure, 0, 0)}, []object.Object{object.NewString("f")},
+			"bad operands of OpClosure at 0: [0 0]"},
+		{[]code.Instructions{code.Make(code.OpClosure, 0, 1)},
+			[]object.Object{&object.CompiledFunction{Name: "f"}},
+			"bad operands of OpClosure at 0: [0 1]"},
+		{[]code.Instructions{code.Make(code.OpTrue), code.Make(code.OpJump, 2)}, nil,
+			"jump to 2 is not an instruction"},
+		{[]code.Instructions{code.Make(code.OpSetupTry, 5)}, nil,
+			"jump to 5 is not an instruction"},
+	}
+
+	for _, tt := range tests {
+		b := &Bytecode{Instructions: concatInstructions(tt.instructions), Constants: tt.constants}
+		_, err := Decode(bytes.NewReader(encode(t, b)))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want=%q, got=%v", tt.expected, err)
+		}
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	b := &Bytecode{Constants: []object.Object{object.NewArray(nil)}}
+
+	err := b.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "cannot encode constant of type ARRAY" {
+		t.Errorf("wrong error: %v", err)
+	}
+}
@@ -0,0 +1,289 @@
+package compiler
+
+import (
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+// Peephole rewrites the instructions of b and of its functions into
+// equivalent ones that do less work. It looks at a few instructions at a
+// time and
+//
+//   - drops constants that are pushed only to be popped,
+//   - drops a parameter loaded only to be stored back, as in x = x,
+//   - points jumps that land on a jump to the final target,
+//   - drops jumps to the next instruction and code that cannot run,
+//   - fuses comparisons with the conditional jump after them and
+//     x = x + constant on a local into superinstructions.
+//
+// Instructions are only combined when no jump lands between them, and
+// jump operands and source maps are updated to the new offsets. The
+// rewrite is idempotent, so a REPL can run it over a growing constant
+// pool again and again.
+func Peephole(b *Bytecode) {
+	b.Instructions, b.SourceMap = peephole(b.Instructions, b.SourceMap, 0)
+	for _, c := range b.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			fn.Instructions, fn.SourceMap = peephole(fn.Instructions, fn.SourceMap, boundSlots(fn))
+		}
+	}
+}
+
+// boundSlots returns the number of local slots of fn that are always
+// set when it runs: its parameters and, for methods, self.
+func boundSlots(fn *object.CompiledFunction) int {
+	if fn.Method {
+		return fn.SelfIndex + 1
+	}
+	return fn.NumParameters + boolToInt(fn.Rest)
+}
+
+// peephole runs passes until one changes nothing.
+func peephole(ins code.Instructions, sm code.SourceMap, bound int) (code.Instructions, code.SourceMap) {
+	for changed := true; changed; {
+		ins, sm, changed = peepholePass(ins, sm, bound)
+	}
+	return ins, sm
+}
+
+type instruction struct {
+	op       code.Opcode
+	operands []int
+	offset   int // before the pass
+
+	// pos holds the source position of the instruction, followed by
+	// those of the other parts of a superinstruction
+	pos []token.Position
+}
+
+var compareJumps = map[code.Opcode]code.Opcode{
+	code.OpLessThan:    code.OpLessThanJumpNotTruthy,
+	code.OpGreaterThan: code.OpGreaterThanJumpNotTruthy,
+	code.OpEqual:       code.OpEqualJumpNotTruthy,
+	code.OpNotEqual:    code.OpNotEqualJumpNotTruthy,
+}
+
+func isJump(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop,
+		code.OpLessThanJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+		code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy,
+		code.OpForIter, code.OpSetupTry, code.OpCatch:
+		return true
+	}
+	return false
+}
+
+// isPush reports whether op pushes a value and can neither fail nor
+// have any other effect.
+func isPush(op code.Opcode) bool {
+	switch op {
+	case code.OpConstant, code.OpTrue, code.OpFalse, code.OpNull:
+		return true
+	}
+	return false
+}
+
+func peepholePass(ins code.Instructions, sm code.SourceMap, bound int) (code.Instructions, code.SourceMap, bool) {
+	list, ok := decodeInstructions(ins, sm)
+	if !ok {
+		return ins, sm, false
+	}
+	changed := false
+
+	index := make(map[int]int, len(list)+1)
+	for i, in := range list {
+		index[in.offset] = i
+	}
+	index[len(ins)] = len(list)
+	for _, in := range list {
+		if !isJump(in.op) {
+			continue
+		}
+		if _, ok := index[in.operands[0]]; !ok {
+			// a jump into the middle of an instruction: leave it be
+			return ins, sm, false
+		}
+	}
+
+	// jumps to jumps go straight to where the last one goes
+	for _, in := range list {
+		if !isJump(in.op) {
+			continue
+		}
+		target := in.operands[0]
+		for steps := 0; steps < len(list); steps++ {
+			j, ok := index[target]
+			if !ok || j == len(list) || list[j].op != code.OpJump {
+				break
+			}
+			target = list[j].operands[0]
+		}
+		if target != in.operands[0] {
+			in.operands[0] = target
+			changed = true
+		}
+	}
+
+	targets := map[int]bool{}
+	for _, in := range list {
+		if isJump(in.op) {
+			targets[in.operands[0]] = true
+		}
+	}
+
+	// nothing after a jump, return or throw runs until the next jump target
+	live := list[:0:0]
+	dead := false
+	for _, in := range list {
+		if targets[in.offset] {
+			dead = false
+		}
+		if dead {
+			changed = true
+			continue
+		}
+		live = append(live, in)
+		switch in.op {
+		case code.OpJump, code.OpReturnValue, code.OpReturn, code.OpThrow:
+			dead = true
+		}
+	}
+
+	// fits reports whether the n instructions from i exist and no jump
+	// lands inside them
+	fits := func(i, n int) bool {
+		if i+n > len(live) {
+			return false
+		}
+		for _, in := range live[i+1 : i+n] {
+			if targets[in.offset] {
+				return false
+			}
+		}
+		return true
+	}
+	is := func(i int, op code.Opcode) bool { return i < len(live) && live[i].op == op }
+
+	var out []*instruction
+	newIndex := map[int]int{} // offset before the pass to index in out
+	for i := 0; i < len(live); {
+		in := live[i]
+		newIndex[in.offset] = len(out)
+
+		n := 1
+		switch {
+		// a value popped right away, unless it is the last one popped,
+		// which the REPL prints
+		case isPush(in.op) && is(i+1, code.OpPop) && i+2 < len(live) && fits(i, 2):
+			n = 2
+			in = nil
+
+		case in.op == code.OpGetLocal && in.operands[0] < bound &&
+			is(i+1, code.OpSetLocal) && live[i+1].operands[0] == in.operands[0] && fits(i, 2):
+			n = 2
+			in = nil
+
+		case in.op == code.OpJump && in.operands[0] == nextOffset(live, i, len(ins)):
+			in = nil
+
+		case compareJumps[in.op] != 0 && is(i+1, code.OpJumpNotTruthy) && fits(i, 2):
+			n = 2
+			in = &instruction{
+				op:       compareJumps[in.op],
+				operands: live[i+1].operands,
+				pos:      in.pos,
+			}
+
+		case in.op == code.OpGetLocal && is(i+1, code.OpConstant) && is(i+2, code.OpAdd) &&
+			is(i+3, code.OpSetLocal) && live[i+3].operands[0] == in.operands[0] && fits(i, 4):
+			n = 4
+			in = &instruction{
+				op:       code.OpAddLocal,
+				operands: []int{in.operands[0], live[i+1].operands[0]},
+				pos:      []token.Position{in.pos[0], live[i+2].pos[0]},
+			}
+		}
+
+		if n > 1 || in == nil {
+			changed = true
+		}
+		for _, skipped := range live[i+1 : i+n] {
+			newIndex[skipped.offset] = len(out)
+		}
+		if in != nil {
+			out = append(out, in)
+		}
+		i += n
+	}
+	newIndex[len(ins)] = len(out)
+
+	if !changed {
+		return ins, sm, false
+	}
+	newIns, newSM := layout(out, newIndex)
+	return newIns, newSM, true
+}
+
+// nextOffset returns the offset of the instruction after live[i].
+func nextOffset(live []*instruction, i, end int) int {
+	if i+1 < len(live) {
+		return live[i+1].offset
+	}
+	return end
+}
+
+func decodeInstructions(ins code.Instructions, sm code.SourceMap) ([]*instruction, bool) {
+	var list []*instruction
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return nil, false
+		}
+		width := 1
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+width > len(ins) {
+			return nil, false
+		}
+		operands, _ := code.ReadOperands(def, ins[i+1:])
+		in := &instruction{
+			op:       code.Opcode(ins[i]),
+			operands: operands,
+			offset:   i,
+			pos:      []token.Position{sm.Lookup(i)},
+		}
+		if in.op == code.OpAddLocal {
+			in.pos = append(in.pos, sm.Lookup(i+1))
+		}
+		list = append(list, in)
+		i += width
+	}
+	return list, true
+}
+
+// layout encodes out and points its jumps to the new offsets of their
+// targets, which newIndex gives as indexes into out.
+func layout(out []*instruction, newIndex map[int]int) (code.Instructions, code.SourceMap) {
+	offsets := make([]int, len(out)+1)
+	for i, in := range out {
+		offsets[i+1] = offsets[i] + len(code.Make(in.op, in.operands...))
+	}
+
+	ins := code.Instructions{}
+	var sm code.SourceMap
+	for i, in := range out {
+		if isJump(in.op) {
+			in.operands = []int{offsets[newIndex[in.operands[0]]]}
+		}
+		for part, pos := range in.pos {
+			if pos.IsValid() {
+				sm = sm.Add(offsets[i]+part, pos)
+			}
+		}
+		ins = append(ins, code.Make(in.op, in.operands...)...)
+	}
+	return ins, sm
+}
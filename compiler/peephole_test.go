@@ -0,0 +1,187 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+func TestPeephole(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			// the value of the last expression is kept for the REPL
+			input:             "1; 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; if (x < 2) { 10 } else { 20 }",
+			expectedConstants: []interface{}{1, 2, 10, 20},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpSetGlobal, 0),
+				// 0006
+				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
+				// 0012
+				code.Make(code.OpLessThanJumpNotTruthy, 21),
+				// 0015
+				code.Make(code.OpConstant, 2),
+				// 0018
+				code.Make(code.OpJump, 24),
+				// 0021
+				code.Make(code.OpConstant, 3),
+				// 0024
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn(n) { let i = 0; while (i < n) { i = i + 1; } i }",
+			expectedConstants: []interface{}{
+				0,
+				1,
+				[]code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpSetLocal, 1),
+					// 0005
+					code.Make(code.OpGetLocal, 1),
+					// 0007
+					code.Make(code.OpGetLocal, 0),
+					// 0009
+					code.Make(code.OpLessThanJumpNotTruthy, 19),
+					// 0012
+					code.Make(code.OpAddLocal, 1, 1),
+					// 0016
+					code.Make(code.OpJump, 5),
+					// 0019
+					code.Make(code.OpGetLocal, 1),
+					// 0021
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// only parameters are known to be set, b = b may fail
+			input: "fn(a) { let b = a; a = a; b = b; }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpGetLocal, 1),
+					code.Make(code.OpSetLocal, 1),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// nothing runs after a return
+			input: `fn() { return 1; "dead" }`,
+			expectedConstants: []interface{}{
+				1,
+				"dead",
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		err := compiler.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		Peephole(bytecode)
+
+		err = testInstructions(tt.expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("%s: testInstructions failed: %s", tt.input, err)
+		}
+
+		err = testConstants(t, tt.expectedConstants, bytecode.Constants)
+		if err != nil {
+			t.Fatalf("%s: testConstants failed: %s", tt.input, err)
+		}
+
+		// a second run finds nothing left to do
+		again := compiler.Bytecode()
+		again.Instructions = append(code.Instructions{}, bytecode.Instructions...)
+		Peephole(again)
+		err = testInstructions([]code.Instructions{bytecode.Instructions}, again.Instructions)
+		if err != nil {
+			t.Fatalf("%s: second run changed the instructions: %s", tt.input, err)
+		}
+	}
+}
+
+func TestPeepholeJumps(t *testing.T) {
+	ins := concatInstructions([]code.Instructions{
+		// 0000
+		code.Make(code.OpGetGlobal, 0),
+		// 0003
+		code.Make(code.OpJumpNotTruthy, 9),
+		// 0006, jumps to the next live instruction once 0009 is gone
+		code.Make(code.OpJump, 12),
+		// 0009, only reached from 0003
+		code.Make(code.OpJump, 0),
+		// 0012
+		code.Make(code.OpGetGlobal, 1),
+		// 0015
+		code.Make(code.OpPop),
+	})
+	sm := code.SourceMap{}.Add(0, token.Position{Line: 1, Column: 1}).
+		Add(12, token.Position{Line: 2, Column: 1})
+
+	got, gotSM := peephole(ins, sm, 0)
+
+	expected := []code.Instructions{
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpJumpNotTruthy, 0),
+		code.Make(code.OpGetGlobal, 1),
+		code.Make(code.OpPop),
+	}
+	if err := testInstructions(expected, got); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if pos := gotSM.Lookup(6); pos.Line != 2 {
+		t.Errorf("instruction 6 should come from line 2, got %s", pos)
+	}
+
+	// a jump into the middle of an instruction is left alone
+	bad := concatInstructions([]code.Instructions{
+		code.Make(code.OpJump, 4),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpPop),
+	})
+	got, _ = peephole(bad, nil, 0)
+	if err := testInstructions([]code.Instructions{bad}, got); err != nil {
+		t.Fatalf("bad jump was rewritten: %s", err)
+	}
+}
@@ -0,0 +1,147 @@
+package compiler
+
+import "sort"
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable resolves names to the slots they are stored in. Every
+// function gets a table of its own. Block tables, such as the scope of a
+// for loop, do not get slots of their own: they take them from the table
+// of the frame they run in, which is the global table at the top level of
+// a program.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols lists the variables of enclosing functions that a
+	// function table captured, as they are resolved in the enclosing one.
+	FreeSymbols []Symbol
+
+	store          map[string]Symbol
+	numDefinitions int
+	names          []string
+
+	// frame owns the local slots the definitions of this table use
+	frame      *SymbolTable
+	numLocals  int
+	localNames []string
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol)}
+	s.frame = s
+	return s
+}
+
+// NewEnclosedSymbolTable creates the table of a function nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates the table of a block scope nested in outer.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol), Outer: outer}
+	s.frame = outer.frame
+	return s
+}
+
+// Define binds name in s. Defining a name again in the same table reuses
+// its slot.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok {
+		return symbol
+	}
+
+	symbol := Symbol{Name: name}
+	if s.Outer == nil {
+		symbol.Scope = GlobalScope
+		symbol.Index = s.numDefinitions
+		s.numDefinitions++
+		s.names = append(s.names, name)
+	} else {
+		symbol.Scope = LocalScope
+		symbol.Index = s.frame.numLocals
+		s.frame.numLocals++
+		s.frame.localNames = append(s.frame.localNames, name)
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// Resolve looks name up in s and its outer tables. Local variables of an
+// enclosing function become free variables of the function of s.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.Resolve(name)
+	if !ok || symbol.Scope == GlobalScope || s.Outer.frame == s.frame {
+		return symbol, ok
+	}
+	return s.frame.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1}
+	symbol.Scope = FreeScope
+
+	s.store[original.Name] = symbol
+	return symbol
+}
+
+// Locals returns the local variables defined in s itself, leaving out
+// those of nested blocks and free variables, in slot order.
+func (s *SymbolTable) Locals() []Symbol {
+	locals := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == LocalScope {
+			locals = append(locals, symbol)
+		}
+	}
+	sort.Slice(locals, func(i, j int) bool { return locals[i].Index < locals[j].Index })
+	return locals
+}
+
+// Global returns the outermost table of s.
+func (s *SymbolTable) Global() *SymbolTable {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+// Names returns the names of the global slots in slot order.
+func (s *SymbolTable) Names() []string { return s.Global().names }
+
+// NumLocals returns the number of local slots used by the frame of s.
+func (s *SymbolTable) NumLocals() int { return s.frame.numLocals }
+
+// LocalNames returns the names of the local slots of the frame of s.
+func (s *SymbolTable) LocalNames() []string { return s.frame.localNames }
+
+// FreeNames returns the names of the free variables of the frame of s.
+func (s *SymbolTable) FreeNames() []string {
+	names := []string{}
+	for _, symbol := range s.frame.FreeSymbols {
+		names = append(names, symbol.Name)
+	}
+	return names
+}
@@ -0,0 +1,48 @@
+package compiler
+
+import "testing"
+
+func TestDefineAndResolve(t *testing.T) {
+	global := NewSymbolTable()
+	a := global.Define("a")
+	if a != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("wrong symbol for a: %+v", a)
+	}
+	if again := global.Define("a"); again != a {
+		t.Errorf("redefining a in the same scope did not reuse its slot: %+v", again)
+	}
+
+	block := NewBlockSymbolTable(global)
+	b := block.Define("b")
+	if b != (Symbol{Name: "b", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong symbol for b: %+v", b)
+	}
+	shadow := block.Define("a")
+	if shadow != (Symbol{Name: "a", Scope: LocalScope, Index: 1}) {
+		t.Errorf("wrong symbol for shadowing a: %+v", shadow)
+	}
+
+	// a sibling block takes fresh slots from the same frame
+	sibling := NewBlockSymbolTable(global)
+	c := sibling.Define("c")
+	if c.Index != 2 {
+		t.Errorf("sibling block reused a slot: %+v", c)
+	}
+
+	if s, ok := block.Resolve("a"); !ok || s != shadow {
+		t.Errorf("a resolved to %+v in the block", s)
+	}
+	if s, ok := sibling.Resolve("a"); !ok || s != a {
+		t.Errorf("a resolved to %+v in the sibling block", s)
+	}
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("b resolved outside its block")
+	}
+
+	if global.NumLocals() != 3 {
+		t.Errorf("wrong number of locals. want=3, got=%d", global.NumLocals())
+	}
+	if names := global.Names(); len(names) != 1 || names[0] != "a" {
+		t.Errorf("wrong global names: %v", names)
+	}
+}
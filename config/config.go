@@ -12,4 +12,6 @@ type Config struct {
 	Mode         ReplMode
 	Debug        bool
 	CompilerMode bool
+	Optimize     bool   // run the optimizer over the program, FROM_FILE mode only
+	FilePath     string // source file name used in positions, FROM_FILE mode only
 }
@@ -0,0 +1,62 @@
+package evaluator
+
+import (
+	"io"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+// SetStd redirects the output of the print builtins.
+func SetStd(sout, serr io.Writer) {
+	builtins.SetStd(sout, serr)
+}
+
+// optimize, if set, rewrites the modules loaded by import before they
+// are evaluated.
+var optimize func(program *ast.Program)
+
+// SetOptimizer makes imports pass the modules they load through f. A nil
+// f turns this off.
+func SetOptimizer(f func(program *ast.Program)) {
+	optimize = f
+}
+
+// MaxCallDepth is how deep function calls may nest before they fail with
+// a RecursionError, as many as the VM has frames. Without it runaway
+// recursion would overflow the Go stack, which cannot be recovered from.
+const MaxCallDepth = 1024
+
+// environment is the object.Env builtins get from the evaluator: the
+// environment of the call and applyFunction to call back into functions.
+type environment struct {
+	*object.Environment
+}
+
+func (e environment) Locals() *object.Hash { return e.ToHash() }
+
+// Method finds the receiver among the variables of the innermost call
+// only, so that functions nested in a method don't count as one.
+func (e environment) Method() (object.Object, object.Object, bool) {
+	call := e.Function()
+	if call == nil {
+		return nil, nil, false
+	}
+	self, ok := call.GetLocal("self")
+	if !ok {
+		return nil, nil, false
+	}
+	cls, ok := call.Get(object.MAGIC_ATTR_CLASS)
+	return cls, self, ok
+}
+
+func (e environment) Call(fn object.Object, args ...object.Object) object.Object {
+	return call(fn, args...)
+}
+
+// call is applyFunction in the form the object package calls back with,
+// for magic methods, iterators and builtins.
+func call(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
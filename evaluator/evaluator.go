@@ -1,13 +1,11 @@
 package evaluator
 
 import (
-	"fmt"
 	"io"
-	"log"
 	"os"
-	"strings"
 
 	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
 	"github.com/yushyn-andriy/firefly/lexer"
 	"github.com/yushyn-andriy/firefly/object"
 	"github.com/yushyn-andriy/firefly/parser"
@@ -48,30 +46,56 @@ func printParseErrors(out io.Writer, errors []string) {
 	}
 }
 
+// Eval evaluates node in env. Errors that do not carry a source position
+// yet are attributed to node, so the innermost failing node wins.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	obj := eval(node, env)
+	if err, ok := obj.(*object.Error); ok {
+		if !err.Pos.IsValid() {
+			err.Pos = node.Pos()
+		}
+		err.PlaceFrame(node.Pos())
+	}
+	return obj
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
 		return evalProgram(node, env)
 	case *ast.ImportLiteral:
 		name := node.Name.Value
+		if !env.EnterImport(name) {
+			return newError(object.ImportError, "cannot import %s: import cycle", name)
+		}
+		defer env.LeaveImport(name)
 
-		// find better way to do this
-		input, err := readFullFile("./lib/" + name + ".fl")
+		path := object.ImportPath(name)
+		input, err := readFullFile(path)
 		if err != nil {
-			log.Fatal(err)
+			return newError(object.ImportError, "cannot import %s: %s", name, err)
 		}
-		l := lexer.New(string(input))
+		l := lexer.NewFile(path, string(input))
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParseErrors(os.Stderr, p.Errors())
+			return newError(object.ImportError, "cannot import %s: invalid syntax", name)
 		}
 
-		moduleEnv := object.NewEnvironment()
-		Eval(program, moduleEnv)
+		if optimize != nil {
+			optimize(program)
+		}
 
-		// fmt.Println(moduleEnv.Inspect())
+		moduleEnv := env.NewModuleEnvironment()
+		if result := Eval(program, moduleEnv); isError(result) {
+			// the module runs as a call, as it does in the VM
+			if err, ok := result.(*object.Error); ok {
+				err.AddFrame(object.Frame{Function: name})
+			}
+			return result
+		}
 
 		m := object.NewModule(node.Name, moduleEnv)
 		env.Set(name, m)
@@ -88,6 +112,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.ConditionalExpression:
+		return evalConditionalExpression(node, env)
+
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
@@ -95,6 +122,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.TryStatement:
+		return evalTryStatement(node, env)
+
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return object.Throw(val)
+
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -107,6 +144,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(left) {
 			return left
 		}
+		if node.Operator == "and" || node.Operator == "or" {
+			return evalLogicalExpression(node, left, env)
+		}
 
 		right := Eval(node.Right, env)
 		if isError(right) {
@@ -116,6 +156,9 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInteger{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
 	case *ast.FloatLiteral:
@@ -129,7 +172,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		env.Define(node.Name.Value, val)
 
 	case *ast.AssignStatement:
 		val := Eval(node.Value, env)
@@ -146,8 +189,21 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		body := node.Body
 		name := node.Name
 		function := object.NewFunction(name, params, env, body)
+		function.Source = node.Source
+		// defaults are evaluated once, when the function is defined
+		for _, def := range node.Defaults {
+			var val object.Object
+			if def != nil {
+				val = Eval(def, env)
+				if isError(val) {
+					return val
+				}
+			}
+			function.Defaults = append(function.Defaults, val)
+		}
+		function.Rest = node.Rest
 		if name != nil {
-			env.Set(name.String(), function)
+			env.Define(name.String(), function)
 		}
 		return function
 
@@ -155,14 +211,29 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		body := node.Body
 		name := node.Name
 		if name == nil {
-			return nil
+			return newError(object.TypeError, "class literal without a name")
 		}
 		cls := object.NewClass(name, body, env)
 
-		extendedEnv := extendClassEnv(cls, nil)
-		cls.Env = extendedEnv
+		if len(node.Bases) > 0 {
+			bases := []*object.Class{}
+			for _, b := range evalExpressions(node.Bases, env) {
+				if isError(b) {
+					return b
+				}
+				base, ok := b.(*object.Class)
+				if !ok {
+					return newError(object.TypeError, "class %s cannot inherit from %s",
+						name.Value, b.Type())
+				}
+				bases = append(bases, base)
+			}
+			if err := cls.SetBases(bases...); err != nil {
+				return err
+			}
+		}
 
-		err := evalBlockStatement(body, extendedEnv)
+		err := evalBlockStatement(body, cls.Env)
 		if isError(err) {
 			return err
 		}
@@ -172,24 +243,35 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return cls
 	case *ast.ForStatement:
 		loop := &object.ForLoop{
-			Init: node.Init.(*ast.AssignStatement),
+			Init: node.Init,
 			Cond: node.Cond,
-			Post: node.Post.(*ast.AssignStatement),
+			Post: node.Post,
 			Body: node.Body,
+			Vars: node.Vars,
+			Iter: node.Iter,
 		}
 		return runForLoop(loop, env)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.BreakStatement:
+		return &object.Break{Pos: node.Pos()}
+
+	case *ast.ContinueStatement:
+		return &object.Continue{Pos: node.Pos()}
+
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressions(node.Arguments, env)
-
-		if len(args) == 1 && isError(args[0]) {
-			return args[0]
+		args, kwargs, err := evalArguments(node.Arguments, env)
+		if err != nil {
+			return err
 		}
-		return applyFunction(function, args)
+
+		return callFunction(function, args, kwargs)
 
 	case *ast.StringLiteral:
 		return object.NewString(node.Value)
@@ -233,18 +315,70 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 func evalSelectorExpression(node *ast.SelectorExpr, env *object.Environment) object.Object {
 	obj := Eval(node.Expression, env)
+	if isError(obj) {
+		return obj
+	}
 	if node.Value != nil {
 		value := Eval(node.Value, env)
+		if isError(value) {
+			return value
+		}
 		return obj.SetAttr(node.Selector.Value, value)
 	}
 
-	res := obj.GetAttr(node.Selector.Value)
-	switch res := res.(type) {
-	case *object.Function:
-		res.Self = obj
-		return res
+	return obj.GetAttr(node.Selector.Value)
+}
+
+func evalTryStatement(node *ast.TryStatement, env *object.Environment) object.Object {
+	result := Eval(node.Block, env)
+
+	if err, ok := result.(*object.Error); ok {
+		result = evalCatchClauses(node.Catches, err, env)
+	}
+
+	if node.Finally != nil {
+		// an error, return, break or continue inside finally
+		// replaces the pending result
+		final := Eval(node.Finally, env)
+		if isUnwinding(final) {
+			return final
+		}
+	}
+
+	return result
+}
+
+// evalCatchClauses runs the first clause that handles err. The error is
+// returned unchanged when no clause matches.
+func evalCatchClauses(
+	clauses []*ast.CatchClause,
+	err *object.Error,
+	env *object.Environment,
+) object.Object {
+	for _, clause := range clauses {
+		if clause.Type != nil {
+			typ := Eval(clause.Type, env)
+			if isError(typ) {
+				return typ
+			}
+			cls, ok := typ.(*object.Class)
+			if !ok {
+				return newError(object.TypeError,
+					"catching classes that do not derive from Exception is not allowed, got %s",
+					typ.Type())
+			}
+			if !err.IsInstance(cls) {
+				continue
+			}
+		}
+
+		if clause.Param != nil {
+			env.Set(clause.Param.Value, object.NewException(err))
+		}
+		return Eval(clause.Body, env)
 	}
-	return res
+
+	return err
 }
 
 func evalHashLiteral(
@@ -259,16 +393,17 @@ func evalHashLiteral(
 			return key
 		}
 
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("unusable as hash key: %s", key.Type())
-		}
-
 		value := Eval(valueNode, env)
 		if isError(value) {
 			return value
 		}
 
+		// like the VM, the key is checked once the value is known too
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
 		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: value}
 	}
@@ -277,145 +412,231 @@ func evalHashLiteral(
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalStringIndexExpression(left, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalHashIndexExpression(left, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
-	}
+	return object.GetItem(left, index, call)
 }
 
 func evalAssignIndexStatement(left, right, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
-		return evalAssignArrayIndexStatement(left, right, index)
-	case left.Type() == object.HASH_OBJ:
-		return evalAssignHashIndexStatement(left, right, index)
-	default:
-		return newError("index operator not supported: %s", left.Type())
-	}
+	return object.SetItem(left, index, right, call)
 }
 
-func evalAssignHashIndexStatement(hash, value, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
-	}
-	hashObject.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: value}
-	return NULL
-}
+func runForLoop(loop object.Object, env *object.Environment) object.Object {
+	switch loop := loop.(type) {
+	case *object.ForLoop:
+		loop.Env = env
+		extendedEnv := extendForLoopEnv(loop, []object.Object{})
+		if loop.Iter != nil {
+			return runForInLoop(loop, extendedEnv)
+		}
+
+		if loop.Init != nil {
+			initVal := Eval(loop.Init, extendedEnv)
+			if isError(initVal) {
+				return initVal
+			}
+		}
 
-func evalAssignArrayIndexStatement(array, value, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements)) - 1
+		for {
+			if loop.Cond != nil {
+				condExpr := Eval(loop.Cond, extendedEnv)
+				if isError(condExpr) {
+					return condExpr
+				}
+				ok, err := object.Truth(condExpr, call)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					break
+				}
+			}
 
-	if idx < 0 || idx > max {
-		return NULL
+			evaluated := Eval(loop.Body, extendedEnv)
+			if isBreak(evaluated) {
+				break
+			}
+			if isUnwinding(evaluated) && !isContinue(evaluated) {
+				return evaluated
+			}
+
+			if loop.Post != nil {
+				post := Eval(loop.Post, extendedEnv)
+				if isError(post) {
+					return post
+				}
+			}
+		}
+
+		return nil
+	default:
+		return newError(object.RuntimeError, "not a ForLoop: %s", loop.Type())
 	}
-	arrayObject.Elements[idx] = value
-	return NULL
 }
 
-func evalHashIndexExpression(hash, index object.Object) object.Object {
-	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("unusable as hash key: %s", index.Type())
+// runForInLoop binds every element of the loop collection to the loop
+// variables and runs the body. Two variables unpack [key, value] pairs,
+// which is what iterating over a hash produces in that form.
+func runForInLoop(loop *object.ForLoop, env *object.Environment) object.Object {
+	collection := Eval(loop.Iter, env)
+	if isError(collection) {
+		return collection
 	}
-	pair, ok := hashObject.Pairs[key.HashKey()]
-	if !ok {
-		return newError("key does not exists: %s", index.Inspect())
+
+	var iter *object.Iterator
+	if hash, ok := collection.(*object.Hash); ok && len(loop.Vars) == 2 {
+		iter = hash.Items()
+	} else {
+		it, err := object.GetIterator(collection, call)
+		if err != nil {
+			return err
+		}
+		iter = it
 	}
-	return pair.Value
-}
 
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObject := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObject.Elements)) - 1
+	for {
+		element, ok := iter.Next()
+		if !ok {
+			return nil
+		}
+		if isError(element) {
+			return element
+		}
+
+		if err := bindLoopVars(loop.Vars, element, env); err != nil {
+			return err
+		}
 
-	if idx < 0 || idx > max {
-		return newError("index out of range: %d", idx)
+		evaluated := Eval(loop.Body, env)
+		if isBreak(evaluated) {
+			return nil
+		}
+		if isUnwinding(evaluated) && !isContinue(evaluated) {
+			return evaluated
+		}
 	}
-
-	return arrayObject.Elements[idx]
 }
 
-func evalStringIndexExpression(obj, index object.Object) object.Object {
-	stringObject := obj.(*object.String)
-	idx := index.(*object.Integer).Value
-
-	runes := []rune(stringObject.Value)
+func bindLoopVars(vars []*ast.Identifier, element object.Object, env *object.Environment) *object.Error {
+	if len(vars) == 1 {
+		env.Set(vars[0].Value, element)
+		return nil
+	}
 
-	max := int64(len(runes)) - 1
-	if idx < 0 || idx > max {
-		return newError("index out of range: %d", idx)
+	arr, ok := element.(*object.Array)
+	if !ok || len(arr.Elements) != len(vars) {
+		return newError(object.TypeError, "cannot unpack %s into %d variables",
+			element.Inspect(), len(vars))
 	}
-	return object.NewString(string(runes[idx]))
+	for i, v := range vars {
+		env.Set(v.Value, arr.Elements[i])
+	}
+	return nil
 }
 
-func runForLoop(loop object.Object, env *object.Environment) object.Object {
-	switch loop := loop.(type) {
-	case *object.ForLoop:
-		loop.Env = env
-		extendedEnv := extendForLoopEnv(loop, []object.Object{})
-		initVal := Eval(loop.Init, extendedEnv)
-		if isError(initVal) {
-			return initVal
+func evalWhileStatement(node *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(node.Cond, env)
+		if isError(condition) {
+			return condition
+		}
+		ok, err := object.Truth(condition, call)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
 		}
 
-		condExpr := Eval(loop.Cond, extendedEnv)
-		if isError(condExpr) {
-			return condExpr
+		evaluated := Eval(node.Body, env)
+		if isBreak(evaluated) {
+			return nil
 		}
+		if isUnwinding(evaluated) && !isContinue(evaluated) {
+			return evaluated
+		}
+	}
+}
 
-		for isTruthy(condExpr) {
-			evaluated := Eval(loop.Body, extendedEnv)
-			if isError(evaluated) {
-				return evaluated
-			}
+// evalArguments evaluates the arguments of a call. Spread arguments are
+// expanded into positional ones and keyword arguments are kept apart in
+// the order they were written.
+func evalArguments(
+	exps []ast.Expression,
+	env *object.Environment,
+) ([]object.Object, []object.Keyword, *object.Error) {
+	args := []object.Object{}
+	kwargs := []object.Keyword{}
 
-			post := Eval(loop.Post, extendedEnv)
-			if isError(post) {
-				return post
+	for _, e := range exps {
+		switch e := e.(type) {
+		case *ast.KeywordArgument:
+			val := Eval(e.Value, env)
+			if err, ok := val.(*object.Error); ok {
+				return nil, nil, err
 			}
-
-			condExpr = Eval(loop.Cond, extendedEnv)
-			if isError(condExpr) {
-				return condExpr
+			kwargs = append(kwargs, object.Keyword{Name: e.Name.Value, Value: val})
+		case *ast.SpreadExpression:
+			val := Eval(e.Value, env)
+			if err, ok := val.(*object.Error); ok {
+				return nil, nil, err
+			}
+			iter, err := object.GetIterator(val, call)
+			if err != nil {
+				return nil, nil, err
+			}
+			for {
+				element, ok := iter.Next()
+				if !ok {
+					break
+				}
+				if err, ok := element.(*object.Error); ok {
+					return nil, nil, err
+				}
+				args = append(args, element)
 			}
+		default:
+			val := Eval(e, env)
+			if err, ok := val.(*object.Error); ok {
+				return nil, nil, err
+			}
+			args = append(args, val)
 		}
-
-		return nil
-	default:
-		return newError("not a ForLoop: %s", loop.Type())
 	}
+
+	return args, kwargs, nil
 }
 
 func applyFunction(fn object.Object, args []object.Object) object.Object {
+	return callFunction(fn, args, nil)
+}
+
+// callFunction calls fn with positional args and keyword arguments kwargs.
+func callFunction(fn object.Object, args []object.Object, kwargs []object.Keyword) object.Object {
 
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
-		return unwrapReturnValue(evaluated)
+		return evalFunctionCall(fn, nil, args, kwargs)
+	case *object.BoundMethod:
+		switch method := fn.Fn.(type) {
+		case *object.Function:
+			return evalFunctionCall(method, fn.Self, args, kwargs)
+		default:
+			return callFunction(method, append([]object.Object{fn.Self}, args...), kwargs)
+		}
 	case *object.Class:
 		obj := fn.NewInstance(args...)
-		init := obj.GetAttr(object.MAGIC_METHOD_INIT)
-		switch r := init.(type) {
-		case *object.Error:
-		case *object.Function:
-			r.Self = obj
-			applyFunction(r, args)
+		if init, ok := object.LookupMethod(obj, object.MAGIC_METHOD_INIT); ok {
+			res := callFunction(init, args, kwargs)
+			if isError(res) {
+				return res
+			}
+		} else if len(args) > 0 || len(kwargs) > 0 {
+			return newError(object.TypeError, "%s() takes no arguments", fn.Name.Value)
 		}
 		return obj
 	case *object.Builtin:
+		if len(kwargs) > 0 {
+			return object.NoKeywordArguments(fn)
+		}
 		var res object.Object
 		// If fn.Self is not nil that means
 		// that this is a function realization to an object
@@ -429,19 +650,49 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 		}
 		switch res := res.(type) {
 		case *object.Function:
-			if len(args) != len(res.Parameters) {
-				return newError("TypeError: expected %d arguments got %d", len(args), len(res.Parameters))
-			}
-			extendedEnv := extendFunctionEnv(res, args)
-			evaluated := Eval(res.Body, extendedEnv)
-			return unwrapReturnValue(evaluated)
+			return evalFunctionCall(res, nil, args, nil)
 		default:
 			return res
 		}
 	default:
-		return newError("not a function: %s", fn.Type())
+		return newError(object.TypeError, "not a function: %s", fn.Type())
+	}
+
+}
+
+func evalFunctionCall(
+	fn *object.Function,
+	self object.Object,
+	args []object.Object,
+	kwargs []object.Keyword,
+) object.Object {
+	if !fn.Env.EnterCall(MaxCallDepth) {
+		return newError(object.RecursionError, "stack overflow")
+	}
+	defer fn.Env.LeaveCall()
+
+	extendedEnv, err := extendFunctionEnv(fn, self, args, kwargs)
+	if err != nil {
+		return err
 	}
+	evaluated := Eval(fn.Body, extendedEnv)
+	if err, ok := evaluated.(*object.Error); ok {
+		traceCall(err, fn, self)
+	}
+	return unwrapReturnValue(evaluated)
+}
 
+// traceCall records in the stack of err that it left the body of fn,
+// called with the receiver self. Errors raised before the body runs, like
+// those for wrong arguments, are the caller's and get no frame. Where the
+// call was made is filled in by Eval once the error reaches the node that
+// made it.
+func traceCall(err *object.Error, fn *object.Function, self object.Object) {
+	frame := object.Frame{Function: functionName(fn)}
+	if self, ok := self.(*object.Instance); ok {
+		frame.Class = self.Class().Name.Value
+	}
+	err.AddFrame(frame)
 }
 
 func extendForLoopEnv(
@@ -452,36 +703,86 @@ func extendForLoopEnv(
 	return env
 }
 
+// extendFunctionEnv creates the scope of one call of fn. It encloses the
+// environment fn was defined in, so closures see the variables of their
+// defining scope, while parameters and self are always local to the call.
+// Arguments are bound by object.Parameters, as in the VM.
 func extendFunctionEnv(
 	fn *object.Function,
+	self object.Object,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(fn.Env)
-	for paramIdx, param := range fn.Parameters {
-		env.Set(param.Value, args[paramIdx])
+	kwargs []object.Keyword,
+) (*object.Environment, *object.Error) {
+	names := make([]string, len(fn.Parameters))
+	for i, param := range fn.Parameters {
+		names[i] = param.Value
+	}
+	params := object.Parameters{
+		Function: functionName(fn),
+		Names:    names,
+		Defaults: fn.Defaults,
+		Rest:     fn.Rest != nil,
+	}
+	values, rest, err := params.Bind(args, kwargs)
+	if err != nil {
+		return nil, err
 	}
-	if fn.Self != nil {
-		env.Set("self", fn.Self)
+
+	env := object.NewCallEnvironment(fn.Env)
+	for i, name := range names {
+		env.Define(name, values[i])
 	}
-	return env
+	if fn.Rest != nil {
+		env.Define(fn.Rest.Value, object.NewArray(rest))
+	}
+	if self != nil {
+		env.Define("self", self)
+	}
+	return env, nil
 }
 
-func extendClassEnv(
-	cls *object.Class,
-	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(cls.Env)
-	return env
+// functionName returns the name fn is reported under in errors.
+func functionName(fn *object.Function) string {
+	if fn.Name == nil {
+		return "<anonymous>"
+	}
+	return fn.Name.Value
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
-	if returnValue, ok := obj.(*object.ReturnValue); ok {
-		return returnValue.Value
+	switch obj := obj.(type) {
+	case *object.ReturnValue:
+		return obj.Value
+	case *object.Break, *object.Continue:
+		return loopControlError(obj)
 	}
 
 	return obj
 }
 
+// loopControlError reports a break or continue that escaped every loop,
+// at the statement that did.
+func loopControlError(obj object.Object) *object.Error {
+	err := newError(object.RuntimeError, "'%s' outside loop", obj.Inspect())
+	switch obj := obj.(type) {
+	case *object.Break:
+		err.Pos = obj.Pos
+	case *object.Continue:
+		err.Pos = obj.Pos
+	}
+	return err
+}
+
+func isBreak(obj object.Object) bool {
+	_, ok := obj.(*object.Break)
+	return ok
+}
+
+func isContinue(obj object.Object) bool {
+	_, ok := obj.(*object.Continue)
+	return ok
+}
+
 func evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
@@ -507,16 +808,18 @@ func evalIdentifier(
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
-		builtin.Env = env
-		return builtin
+	if builtin, ok := builtins.Lookup(node.Value); ok {
+		// bind a copy so that the shared builtin keeps no environment
+		bound := *builtin
+		bound.Env = environment{env}
+		return &bound
 	}
 
-	if namedFunc, ok := env.Get(node.Value); ok {
-		return namedFunc
+	if cls, ok := object.LookupException(node.Value); ok {
+		return cls
 	}
 
-	return newError("identifier not found: " + node.Value)
+	return newError(object.NameError, "identifier not found: %s", node.Value)
 }
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
@@ -525,7 +828,12 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 		return condition
 	}
 
-	if isTruthy(condition) {
+	ok, err := object.Truth(condition, call)
+	if err != nil {
+		return err
+	}
+
+	if ok {
 		return Eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		return Eval(ie.Alternative, env)
@@ -534,188 +842,54 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 	}
 }
 
-func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
-		return false
-	default:
-		return true
+func evalConditionalExpression(ce *ast.ConditionalExpression, env *object.Environment) object.Object {
+	condition := Eval(ce.Condition, env)
+	if isError(condition) {
+		return condition
 	}
-}
-
-func evalInfixExpression(
-	operator string,
-	left, right object.Object,
-) object.Object {
-	switch {
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
-		return evalIntegerInfixExpression(operator, left, right)
-
-	case left.Type() == object.FLOAT_OBJ && right.Type() == object.FLOAT_OBJ:
-		return evalFloatInfixExpression(operator, left, right)
-
-	case left.Type() == object.INTEGER_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringIntegerInfix(operator, left, right)
-	case right.Type() == object.INTEGER_OBJ && left.Type() == object.STRING_OBJ:
-		return evalStringIntegerInfix(operator, right, left)
-
-	case operator == "==" && left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return nativeBoolToBooleanObject(left == right)
 
-	case operator == "!=" && left.Type() == object.BOOLEAN_OBJ && right.Type() == object.BOOLEAN_OBJ:
-		return nativeBoolToBooleanObject(left != right)
-
-	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
-
-	case operator == "and":
-		return nativeBoolToBooleanObject(object.TRUE == left && object.TRUE == right)
-
-	case operator == "or":
-		return nativeBoolToBooleanObject(object.TRUE == left || object.TRUE == right)
-
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
-			left.Type(), operator, right.Type())
+	ok, err := object.Truth(condition, call)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
+	if ok {
+		return Eval(ce.Consequence, env)
 	}
+	return Eval(ce.Alternative, env)
 }
 
-func evalStringInfixExpression(
-	operator string,
-	left, right object.Object,
-) object.Object {
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-
-	switch operator {
-	case "+":
-		return object.NewString(leftVal + rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
-	}
+func isTruthy(obj object.Object) bool {
+	return object.IsTruthy(obj)
 }
 
-func evalStringIntegerInfix(
-	operator string,
-	left, right object.Object,
+// evalLogicalExpression evaluates the right operand of and and or only
+// when left does not decide the result, and returns the operand that
+// decides it, so 0 and f() is 0 without calling f, and "" or "x" is "x".
+func evalLogicalExpression(
+	node *ast.InfixExpression,
+	left object.Object,
+	env *object.Environment,
 ) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.String).Value
-
-	switch operator {
-	case "*":
-		return object.NewString(strings.Repeat(rightVal, int(leftVal)))
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
+	truthy, err := object.Truth(left, call)
+	if err != nil {
+		return err
 	}
-}
-func evalIntegerInfixExpression(
-	operator string,
-	left, right object.Object,
-) object.Object {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
+	if truthy == (node.Operator == "or") {
+		return left
 	}
+	return Eval(node.Right, env)
 }
 
-func evalFloatInfixExpression(
+func evalInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	leftVal := left.(*object.Float).Value
-	rightVal := right.(*object.Float).Value
-
-	switch operator {
-	case "+":
-		return &object.Float{Value: leftVal + rightVal}
-	case "-":
-		return &object.Float{Value: leftVal - rightVal}
-	case "*":
-		return &object.Float{Value: leftVal * rightVal}
-	case "/":
-		return &object.Float{Value: leftVal / rightVal}
-	case "<":
-		return nativeBoolToBooleanObject(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBooleanObject(leftVal > rightVal)
-	case "==":
-		return nativeBoolToBooleanObject(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBooleanObject(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s",
-			left.Type(), operator, right.Type())
-	}
+	return object.Infix(operator, left, right, call)
 }
 
 func evalPrefixExpression(operator string, right object.Object) object.Object {
-	switch operator {
-	case "!":
-		return evalBangOperatorExpression(right)
-	case "-":
-		return evalMinusPrefixOperatorExpression(right)
-	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
-	}
-}
-
-func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	switch obj := right.(type) {
-	case *object.Integer:
-		return &object.Integer{Value: -obj.Value}
-	case *object.Float:
-		return &object.Float{Value: -obj.Value}
-	default:
-		return newError("unknown operator: -%s", right.Type())
-	}
-}
-
-func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
-	}
+	return object.Prefix(operator, right, call)
 }
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -736,6 +910,8 @@ func evalProgram(program *ast.Program, env *object.Environment) object.Object {
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return loopControlError(result)
 		}
 	}
 
@@ -763,18 +939,28 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 	for _, statement := range block.Statements {
 		result = Eval(statement, env)
-		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
-				return result
-			}
+		if isUnwinding(result) {
+			return result
 		}
 	}
 	return result
 }
 
-func newError(format string, a ...interface{}) *object.Error {
-	return &object.Error{Message: fmt.Sprintf(format, a...)}
+// isUnwinding reports whether obj stops the execution of the enclosing
+// block: a return value, an error, break or continue.
+func isUnwinding(obj object.Object) bool {
+	if obj == nil {
+		return false
+	}
+	switch obj.Type() {
+	case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+		return true
+	}
+	return false
+}
+
+func newError(cls *object.Class, format string, a ...interface{}) *object.Error {
+	return object.NewError(cls, format, a...)
 }
 
 func isError(obj object.Object) bool {
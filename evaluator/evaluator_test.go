@@ -1,7 +1,13 @@
 package evaluator
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"math"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 
 	"github.com/yushyn-andriy/firefly/lexer"
@@ -31,6 +37,23 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", 2},
+		{"7 % -3", -2},
+		{"7 // 2", 3},
+		{"-7 // 2", -4},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"+5", 5},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 + 2 << 1", 6},
+		{"pow(3, 3)", 27},
 	}
 
 	for _, tt := range tests {
@@ -60,6 +83,21 @@ func TestEvalFloatExpression(t *testing.T) {
 		{"3.0 * 3.0 * 3.0 + 10.0", 37.0},
 		{"3.0 * (3.0 * 3.0) + 10.0", 37.0},
 		{"(5.0 + 10.0 * 2.0 + 15.0 / 3.0) * 2.0 + -10.0", 50.0},
+		{"7.5 % 2.0", 1.5},
+		{"-7.5 % 2.0", 0.5},
+		{"7.5 // 2.0", 3.0},
+		{"-7.5 // 2.0", -4.0},
+		{"2.0 ** 0.5", math.Sqrt2},
+		{"2 ** -1", 0.5},
+		{"+1.5", 1.5},
+		{"1 + 2.5", 3.5},
+		{"2.5 - 1", 1.5},
+		{"3 * 0.5", 1.5},
+		{"3 / 2.0", 1.5},
+		{"7 % 2.5", 2.0},
+		{"7.0 // 2", 3.0},
+		{"4 ** 0.5", 2.0},
+		{"pow(2, 0.5)", math.Sqrt2},
 	}
 
 	for _, tt := range tests {
@@ -68,6 +106,62 @@ func TestEvalFloatExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegersAndDecimals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		typ      object.ObjectType
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808", object.INTEGER_OBJ},
+		{"-9223372036854775808 - 1", "-9223372036854775809", object.INTEGER_OBJ},
+		{"-(-9223372036854775808)", "9223372036854775808", object.INTEGER_OBJ},
+		{"-9223372036854775808 / -1", "9223372036854775808", object.INTEGER_OBJ},
+		{"4294967296 * 4294967296", "18446744073709551616", object.INTEGER_OBJ},
+		{"2 ** 64", "18446744073709551616", object.INTEGER_OBJ},
+		{"1 << 64", "18446744073709551616", object.INTEGER_OBJ},
+		{"100000000000000000000", "100000000000000000000", object.INTEGER_OBJ},
+		{"100000000000000000000 // -7", "-14285714285714285715", object.INTEGER_OBJ},
+		{"100000000000000000000 % -7", "-5", object.INTEGER_OBJ},
+		{"~(2 ** 64)", "-18446744073709551617", object.INTEGER_OBJ},
+		{"(2 ** 64) >> 60", "16", object.INTEGER_OBJ},
+		{"2 ** 64 - 2 ** 64", "0", object.INTEGER_OBJ},
+		{"2 ** 64 + 0.5", "1.8446744073709552e+19", object.FLOAT_OBJ},
+		{`int("18446744073709551616")`, "18446744073709551616", object.INTEGER_OBJ},
+		{"int(2.0 ** 64)", "18446744073709551616", object.INTEGER_OBJ},
+
+		{`decimal("1.10") + decimal("2.20")`, "3.30", object.DECIMAL_OBJ},
+		{`decimal("0.1") + decimal("0.2") == decimal("0.3")`, "true", object.BOOLEAN_OBJ},
+		{`decimal("19.99") * 3`, "59.97", object.DECIMAL_OBJ},
+		{`1 - decimal("0.01")`, "0.99", object.DECIMAL_OBJ},
+		{`decimal(1) / 3`, "0.3333333333333333333333333333", object.DECIMAL_OBJ},
+		{`decimal(2) / 3`, "0.6666666666666666666666666667", object.DECIMAL_OBJ},
+		{`decimal("1.00") / 4`, "0.25", object.DECIMAL_OBJ},
+		{`decimal("6.0") / 2`, "3.0", object.DECIMAL_OBJ},
+		{`decimal("-7.5") // 2`, "-4", object.DECIMAL_OBJ},
+		{`decimal("-7.5") % 2`, "0.5", object.DECIMAL_OBJ},
+		{`decimal("1.5") ** 2`, "2.25", object.DECIMAL_OBJ},
+		{`decimal(2) ** -2`, "0.25", object.DECIMAL_OBJ},
+		{`-decimal("2.50")`, "-2.50", object.DECIMAL_OBJ},
+		{`decimal("2.5") > 2`, "true", object.BOOLEAN_OBJ},
+		{`decimal("2.0") == 2`, "true", object.BOOLEAN_OBJ},
+		{`decimal(0.1)`, "0.1", object.DECIMAL_OBJ},
+		{`decimal(2 ** 64) + decimal("0.5")`, "18446744073709551616.5", object.DECIMAL_OBJ},
+		{`int(decimal("-7.9"))`, "-7", object.INTEGER_OBJ},
+		{`float(decimal("2.5"))`, "2.5", object.FLOAT_OBJ},
+		{`string(decimal("1.50"))`, "1.50", object.STRING_OBJ},
+		{`{decimal("1.0"): "one"}[1]`, "one", object.STRING_OBJ},
+		{`{2 ** 64: "big"}[decimal("18446744073709551616.00")]`, "big", object.STRING_OBJ},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Type() != tt.typ || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: expected %s %s, got %s %s", tt.input,
+				tt.typ, tt.expected, evaluated.Type(), evaluated.Inspect())
+		}
+	}
+}
+
 func TestEvalSelectorExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -116,6 +210,17 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"1.1 != 1.1", false},
 		{"1.1 == 2.2", false},
 		{"1.1 != 2.1", true},
+		{"1 <= 1", true},
+		{"2 <= 1", false},
+		{"1 >= 1", true},
+		{"1 >= 2", false},
+		{"1.5 <= 1.5", true},
+		{"1.5 >= 2.5", false},
+		{"5 % 2 == 1", true},
+		{"1 == 1.0", true},
+		{"1.5 != 1", true},
+		{"2 > 1.5", true},
+		{"1.5 <= 1", false},
 
 		{"false and false", false},
 		{"false and true", false},
@@ -213,6 +318,12 @@ func TestBangOperator(t *testing.T) {
 		{"!!true", true},
 		{"!!false", false},
 		{"!!5", true},
+		{"!0", true},
+		{`!""`, true},
+		{"![]", true},
+		{"!{}", true},
+		{"!0.5", false},
+		{`!"a"`, false},
 	}
 
 	for _, tt := range tests {
@@ -221,6 +332,55 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	// calls counts the calls of f, to see which operands are evaluated
+	prelude := "let calls = 0; let f = fn(v) { calls = calls + 1; v };\n"
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"1 and 2", 2},
+		{"0 and 2", 0},
+		{"1 or 2", 1},
+		{"0 or 2", 2},
+		{`"" or "x"`, "x"},
+		{`"a" and "b"`, "b"},
+		{"[] or 3", 3},
+		{"{} or 4", 4},
+		{"(if (false) { 1 }) or 5", 5},
+		{"(if (false) { 1 }) and 5", nil},
+		{"false or 0", 0},
+		{"0 and f(1); calls", 0},
+		{"1 or f(1); calls", 0},
+		{"1 and f(1); calls", 1},
+		{"0 or f(1); calls", 1},
+		{"f(0) and f(1) and f(2); calls", 1},
+		{"f(0) or f(1) or f(2); calls", 2},
+		{"let x = if (false) { 1 }; x and x.f()", nil},
+		{"if (0 or []) { 1 } else { 2 }", 2},
+		{`if ("a" and 1) { 1 } else { 2 }`, 1},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(prelude + tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -229,6 +389,14 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (true) { 10 }", 10},
 		{"if (false) { 10 }", nil},
 		{"if (1) { 10 }", 10},
+		{"if (0) { 10 }", nil},
+		{`if ("") { 10 } else { 20 }`, 20},
+		{"if ([]) { 10 } else { 20 }", 20},
+		{"if ([0]) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+		{"if (1 > 2) { 10 } else if (0) { 20 } else if ([1]) { 30 } else { 40 }", 30},
 		{"if (1 < 2) { 10 }", 10},
 		{"if (1 > 2) { 10 }", nil},
 		{"if (1 > 2) { 10 } else { 20 }", 20},
@@ -245,6 +413,36 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 }
 
+func TestConditionalExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"true ? 1 : 2", 1},
+		{"0 ? 1 : 2", 2},
+		{`"" ? 1 : 2`, 2},
+		{"1 > 2 ? 1 : 2 > 1 ? 3 : 4", 3},
+		{"let f = fn(n) { return n < 0 ? -n : n; }; f(-5) + f(5)", 10},
+		{"let max = fn(a, b) { a > b ? a : b }; max(3, max(7, 4))", 7},
+		{"len([1, 2] ? [3] : [])", 1},
+		{`{"k": 1 < 2 ? 5 : 6}["k"]`, 5},
+		{"false ? 1 : (if (false) { 1 })", nil},
+		// only the branch taken is evaluated
+		{"let n = 0; let f = fn() { n = n + 1; n }; true ? f() : f(); n", 1},
+		{"1 ? 2 : 1 / 0", 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -334,6 +532,99 @@ func TestErrorHandling(t *testing.T) {
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			`"ab" * 9999999999`,
+			"repeated string is too long",
+		},
+		{
+			"fn f(n) { f(n + 1) }; f(0)",
+			"stack overflow",
+		},
+		{
+			`"abc".upper(1)`,
+			"wrong number of arguments. got=1, want=0",
+		},
+		{
+			"5 % 0",
+			"integer modulo by zero",
+		},
+		{
+			"5 // 0",
+			"integer division by zero",
+		},
+		{
+			"5.0 % 0.0",
+			"float modulo by zero",
+		},
+		{
+			"1 / 0.0",
+			"float division by zero",
+		},
+		{
+			"1 & 1.0",
+			"type mismatch: INTEGER & FLOAT",
+		},
+		{
+			`int(float("inf"))`,
+			"cannot convert float +Inf to integer",
+		},
+		{
+			"2 ** 10000000",
+			"integer is too large",
+		},
+		{
+			`decimal("1.5") / 0`,
+			"decimal division by zero",
+		},
+		{
+			`decimal("1.5") + 1.5`,
+			"type mismatch: DECIMAL + FLOAT",
+		},
+		{
+			`decimal(2) ** decimal("0.5")`,
+			"decimal can only be raised to an integer power",
+		},
+		{
+			`decimal("1,5")`,
+			`invalid literal for decimal: "1,5"`,
+		},
+		{
+			"0 ** -1",
+			"0.0 cannot be raised to a negative power",
+		},
+		{
+			"1 << -1",
+			"negative shift count",
+		},
+		{
+			"7 << 9223372036854775807",
+			"integer is too large",
+		},
+		{
+			"class { }()",
+			"class literal without a name",
+		},
+		{
+			"1.5 & 1.0",
+			"unknown operator: FLOAT & FLOAT",
+		},
+		{
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		},
+		{
+			`+"a"`,
+			"unknown operator: +STRING",
+		},
+		{
+			// errors have attributes too, they must not be read as values
+			"let m = undefinedvar.message; m",
+			"identifier not found: undefinedvar",
+		},
+		{
+			"class A { }; let a = A(); a.v = undefinedvar; 1",
+			"identifier not found: undefinedvar",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -350,6 +641,20 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestCallDepthPerEvaluation(t *testing.T) {
+	// each evaluation nests calls just short of MaxCallDepth, which
+	// only fails if the evaluations count each other's calls
+	input := fmt.Sprintf("fn f(n) { if (n > 1) { f(n - 1) } else { n } }; f(%d)", MaxCallDepth-1)
+
+	results := make(chan object.Object)
+	for i := 0; i < 4; i++ {
+		go func() { results <- testEval(input) }()
+	}
+	for i := 0; i < 4; i++ {
+		testIntegerObject(t, <-results, 1)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -427,6 +732,15 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestParametersShadowGlobals(t *testing.T) {
+	input := `
+	let x = 1;
+	let f = fn(x) { x = x + 10; x };
+	f(5) + x`
+
+	testIntegerObject(t, testEval(input), 16)
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 let newAdder = fn(x) {
@@ -647,3 +961,793 @@ func TestHashIndexExpressions(t *testing.T) {
 func almostEqual(a, b float64) bool {
 	return math.Abs(a-b) <= float64EqualityThreshold
 }
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+	}{
+		{"5 + true;", "1:3"},
+		{"x = 1;\nfoobar", "2:1"},
+		{"let f = fn(a) {\n  a + true;\n};\nf(1);", "2:5"},
+		{`[1, 2][3]`, "1:7"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position for %q. expected=%q, got=%q",
+				tt.input, tt.expectedPos, errObj.Pos.String())
+		}
+	}
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `fn inner(a) {
+  return a[3];
+}
+class Box {
+  fn get(a) { return inner(a); };
+};
+fn outer() {
+  b = Box();
+  return b.get([1, 2]);
+}
+outer();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expectedFrames := []string{"inner", "Box.get", "outer"}
+	if len(errObj.Stack) != len(expectedFrames) {
+		t.Fatalf("wrong number of frames. want=%d, got=%d",
+			len(expectedFrames), len(errObj.Stack))
+	}
+	for i, name := range expectedFrames {
+		if errObj.Stack[i].Name() != name {
+			t.Errorf("frame %d has wrong name. want=%q, got=%q",
+				i, name, errObj.Stack[i].Name())
+		}
+	}
+
+	expected := `Traceback (most recent call last):
+  File "<stdin>", line 11, column 6, in <module>
+  File "<stdin>", line 9, column 15, in outer
+  File "<stdin>", line 5, column 27, in Box.get
+  File "<stdin>", line 2, column 11, in inner
+IndexError: index out of range: 3
+`
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, errObj.Traceback())
+	}
+
+	trace, ok := errObj.GetAttr("trace").(*object.Array)
+	if !ok {
+		t.Fatalf("trace is not Array. got=%T", errObj.GetAttr("trace"))
+	}
+	if len(trace.Elements) != 4 {
+		t.Errorf("trace has wrong number of lines. got=%d", len(trace.Elements))
+	}
+}
+
+func TestMagicMethodStackTrace(t *testing.T) {
+	input := `class E {
+  fn __add__(o) { return o[1]; };
+};
+e = E();
+if (true) { e + []; }`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := `Traceback (most recent call last):
+  File "<stdin>", line 5, column 15, in <module>
+  File "<stdin>", line 2, column 27, in E.__add__
+IndexError: index out of range: 1
+`
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, errObj.Traceback())
+	}
+}
+
+func TestArgumentErrorStackTrace(t *testing.T) {
+	// the callee never ran, so the error is raised in its caller
+	input := `fn f() { }
+fn g() { return f(1); }
+g();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	expected := `Traceback (most recent call last):
+  File "<stdin>", line 3, column 2, in <module>
+  File "<stdin>", line 2, column 18, in g
+TypeError: f() takes 0 positional arguments but 1 was given
+`
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, errObj.Traceback())
+	}
+}
+
+func TestTryCatchFinally(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`r = 0; try { r = 1; } catch (e) { r = 2; }; r`, 1},
+		{`r = 0; try { int("abc"); r = 1; } catch (e) { r = 2; }; r`, 2},
+		{`r = 0; try { throw "x"; } catch { r = 3; }; r`, 3},
+		{`r = 0; try { r = 1; } finally { r = r + 10; }; r`, 11},
+		{`r = 0; try { throw "x"; } catch (e) { r = 1; } finally { r = r + 10; }; r`, 11},
+		{`let f = fn() { try { return 1; } finally { return 2; } }; f()`, 2},
+		{`let f = fn() { try { throw "x"; } catch (e) { return 5; } }; f()`, 5},
+		{`try { throw "boom"; } catch (e) { e.message }`, "boom"},
+		{`try { [1][5]; } catch (e) { e.message }`, "index out of range: 5"},
+		{`try { foobar; } catch (e) { e.type }`, "NameError"},
+		{`try { try { throw "in"; } catch (e) { throw e; } } catch (e) { e.message }`, "in"},
+		{`try { throw 42; } catch (e) { e.message }`, "42"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestUncaughtThrow(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`throw "boom";`, "boom"},
+		{`try { throw "a"; } catch (e) { throw "b"; }`, "b"},
+		{`try { 1; } finally { throw "c"; }`, "c"},
+		{`try { throw "a"; } finally { 1; }`, "a"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestCatchByType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { [1][5]; } catch (IndexError e) { e.type }`, "IndexError"},
+		{`try { {}["a"]; } catch (LookupError e) { e.type }`, "KeyError"},
+		{`try { 1 / 0; } catch (ArithmeticError e) { e.type }`, "ZeroDivisionError"},
+		{`try { 1 / 0; } catch (KeyError e) { 1 } catch (ZeroDivisionError e) { 2 }`, 2},
+		{`try { foobar; } catch (TypeError e) { 1 } catch (e) { 2 }`, 2},
+		{`try { int("x"); } catch (Exception e) { e.type }`, "ValueError"},
+		{`try { "a".foo; } catch (AttributeError e) { e.message }`, "'STRING' object has no attribute 'foo'"},
+		{`try { throw TypeError("bad"); } catch (TypeError e) { e.message }`, "bad"},
+		{`class MyErr(ValueError) { }; try { throw MyErr("mine"); } catch (ValueError e) { e.type }`, "MyErr"},
+		{`class MyErr(ValueError) { }; try { throw MyErr("mine"); } catch (MyErr e) { e.message }`, "mine"},
+		{`class MyErr(Exception) { let code = 7; }; try { throw MyErr("x"); } catch (MyErr e) { e.code }`, 7},
+		{`class MyErr(Exception) { }; try { throw MyErr; } catch (MyErr e) { e.type }`, "MyErr"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestUncaughtByType(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedType string
+	}{
+		{`try { 1 / 0; } catch (KeyError e) { 1 }`, "ZeroDivisionError"},
+		{`let a = [1]; a[3] = 2;`, "IndexError"},
+		{`try { 1; } catch (5 e) { 1 }`, ""},
+		{`try { throw "x"; } catch (5 e) { 1 }`, "TypeError"},
+		{`class A(5) { }`, "TypeError"},
+		{`import "nosuchmodule"`, "ImportError"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if tt.expectedType == "" {
+			if ok {
+				t.Errorf("unexpected error for %q: %s", tt.input, errObj.Inspect())
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.TypeName() != tt.expectedType {
+			t.Errorf("wrong error type. expected=%q, got=%q", tt.expectedType, errObj.TypeName())
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let s = 0; for (i = 0; i < 5; i = i + 1) { s = s + i; }; s`, 10},
+		{`let s = 0; let i = 0; while (i < 5) { s = s + i; i = i + 1; }; s`, 10},
+		{`let i = 0; while (true) { i = i + 1; if (i == 3) { break; } }; i`, 3},
+		{`let s = 0; for (i = 0; i < 10; i = i + 1) { if (i == 4) { break; } s = s + i; }; s`, 6},
+		{`let s = 0; for (i = 0; i < 5; i = i + 1) { if (i == 2) { continue; } s = s + i; }; s`, 8},
+		{`let s = 0; let i = 0; while (i < 5) { i = i + 1; if (i == 2) { continue; } s = s + i; }; s`, 13},
+		{`let i = 0; for (;;) { i = i + 1; if (i > 6) { break; } }; i`, 7},
+		{`let s = 0; for (i = 0; i < 3; i = i + 1) { for (j = 0; j < 3; j = j + 1) { if (j == 1) { break; } s = s + 1; } }; s`, 3},
+		{`let f = fn() { let i = 0; while (true) { i = i + 1; if (i == 4) { return i * 10; } } }; f()`, 40},
+		{`let i = 0; while (i < 3) { try { i = i + 1; continue; } finally { i = i + 10; } }; i`, 11},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	// the parser rejects these programs; the evaluator still reports
+	// them for trees that did not come from it
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedColumn  int
+	}{
+		{`break;`, "'break' outside loop", 1},
+		{`let f = fn() { continue; }; f()`, "'continue' outside loop", 16},
+		{`let f = fn() { if (true) { break; } }; while (true) { f(); }`, "'break' outside loop", 28},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Pos.Column != tt.expectedColumn {
+			t.Errorf("%s: error at column %d, want %d", tt.input, errObj.Pos.Column, tt.expectedColumn)
+		}
+	}
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let s = 0; for (x in [1, 2, 3]) { s = s + x; }; s`, 6},
+		{`let s = ""; for (c in "abc") { s = c + s; }; s`, "cba"},
+		{`let s = ""; for (k in {"b": 2, "a": 1}) { s = s + k; }; s`, "ab"},
+		{`let s = 0; for (k, v in {"a": 1, "b": 2}) { s = s + v; }; s`, 3},
+		{`let s = ""; for (k in {99999999999999999999: 0, 1: 0, 18446744073709551616: 0, -2: 0}) { s = s + string(k) + " "; }; s`, "-2 1 18446744073709551616 99999999999999999999 "},
+		{`let s = ""; for (k, v in {"a": "x", "b": "y"}) { s = s + k + v; }; s`, "axby"},
+		{`let s = 0; for (i in range(5)) { s = s + i; }; s`, 10},
+		{`let s = 0; for (i in range(2, 5)) { s = s + i; }; s`, 9},
+		{`let s = 0; for (i in range(10, 0, -3)) { s = s + i; }; s`, 22},
+		{`len(range(1, 10, 2))`, 5},
+		{`let s = 0; for (a, b in [[1, 2], [3, 4]]) { s = s + a * b; }; s`, 14},
+		{`let s = 0; for (x in [1, 2, 3, 4]) { if (x == 2) { continue; } if (x == 4) { break; } s = s + x; }; s`, 4},
+		{`let f = fn() { for (x in [5, 6, 7]) { if (x == 6) { return x; } } }; f()`, 6},
+		{`
+		class Counter {
+			fn __init__(n) { self.n = n; self.i = 0; }
+			fn __iter__() { return self; }
+			fn __next__() {
+				if (self.i == self.n) { throw StopIteration(); }
+				self.i = self.i + 1;
+				return self.i;
+			}
+		};
+		let s = 0;
+		for (x in Counter(4)) { s = s + x; };
+		s`, 10},
+		{`
+		class Bag {
+			fn __init__() { self.items = [1, 2, 3]; }
+			fn __iter__() { return self.items; }
+		};
+		let s = 0;
+		for (x in Bag()) { s = s + x; };
+		s`, 6},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestForInErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`for (x in 5) { x }`, "'INTEGER' object is not iterable"},
+		{`class A { }; for (x in A()) { x }`, "'A' object is not iterable"},
+		{`for (a, b in [1, 2]) { a }`, "cannot unpack 1 into 2 variables"},
+		{`range(1, 2, 0)`, "range() step must not be zero"},
+		{`range("a")`, "argument to `range` must be INTEGER, got STRING"},
+		{`
+		class Bad {
+			fn __iter__() { return self; }
+			fn __next__() { throw ValueError("broken"); }
+		};
+		for (x in Bad()) { x }`, "broken"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestForInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\r\nthree"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	input := fmt.Sprintf(`
+	let f = file(%q, "r");
+	f.open();
+	let lines = "";
+	for (line in f) { lines = lines + line + "|"; };
+	f.close();
+	lines`, path)
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "one|two|three|" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+const vectorClass = `
+class Vec {
+	fn __init__(x, y) { self.x = x; self.y = y; }
+	fn __add__(other) { return Vec(self.x + other.x, self.y + other.y); }
+	fn __sub__(other) { return Vec(self.x - other.x, self.y - other.y); }
+	fn __mul__(k) { return Vec(self.x * k, self.y * k); }
+	fn __rmul__(k) { return Vec(self.x * k, self.y * k); }
+	fn __eq__(other) { return self.x == other.x and self.y == other.y; }
+	fn __lt__(other) { return self.x * self.x + self.y * self.y < other.x * other.x + other.y * other.y; }
+	fn __neg__() { return Vec(-self.x, -self.y); }
+	fn __pos__() { return Vec(+self.x, +self.y); }
+	fn __mod__(k) { return Vec(self.x % k, self.y % k); }
+	fn __rpow__(k) { return Vec(k ** self.x, k ** self.y); }
+	fn __le__(other) { return self < other or self == other; }
+	fn __getitem__(i) { if (i == 0) { return self.x; } return self.y; }
+	fn __setitem__(i, v) { if (i == 0) { self.x = v; } else { self.y = v; } }
+	fn __str__() { return "(" + string(self.x) + ", " + string(self.y) + ")"; }
+	fn __repr__() { return "Vec" + string(self); }
+	fn __bool__() { return self.x != 0 or self.y != 0; }
+};
+`
+
+func TestOperatorOverloading(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`(Vec(1, 2) + Vec(3, 4)).x`, 4},
+		{`(Vec(1, 2) - Vec(3, 5)).y`, -3},
+		{`(Vec(1, 2) * 3).y`, 6},
+		{`(3 * Vec(1, 2)).x`, 3},
+		{`Vec(1, 2) == Vec(1, 2)`, true},
+		{`Vec(1, 2) != Vec(1, 2)`, false},
+		{`Vec(1, 2) != Vec(2, 1)`, true},
+		{`Vec(1, 1) < Vec(2, 2)`, true},
+		{`Vec(3, 3) > Vec(2, 2)`, true},
+		{`(-Vec(1, 2)).x`, -1},
+		{`(+Vec(1, 2)).y`, 2},
+		{`(Vec(5, 7) % 4).y`, 3},
+		{`(2 ** Vec(3, 4)).y`, 16},
+		{`Vec(1, 2) <= Vec(1, 2)`, true},
+		{`Vec(3, 3) >= Vec(2, 2)`, true},
+		{`Vec(7, 8)[1]`, 8},
+		{`let v = Vec(7, 8); v[0] = 9; v.x`, 9},
+		{`string(Vec(1, 2))`, "(1, 2)"},
+		{`!Vec(0, 0)`, true},
+		{`if (Vec(0, 0)) { 1 } else { 2 }`, 2},
+		{`(Vec(0, 0) or Vec(3, 4)).x`, 3},
+		{`(Vec(1, 0) and 5)`, 5},
+		{`let v = Vec(1, 2); v == v`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(vectorClass + tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestOperatorOverloadingErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`class A { }; A() + 1`, "type mismatch: INSTANCE + INTEGER"},
+		{`class A { }; A()[0]`, "'A' object is not subscriptable"},
+		{`class A { }; let a = A(); a[0] = 1`, "'A' object does not support item assignment"},
+		{`class A { fn __bool__() { return 1; } }; if (A()) { 1 }`, "__bool__ should return BOOLEAN, returned INTEGER"},
+		{`class A { fn __str__() { return 1; } }; string(A())`, "__str__ returned non-string (type INTEGER)"},
+		{`class A { fn __add__(o) { throw ValueError("nope"); } }; A() + A()`, "nope"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestPrintUsesMagicMethods(t *testing.T) {
+	var out bytes.Buffer
+	SetStd(&out, &out)
+	defer SetStd(os.Stdout, os.Stderr)
+
+	testEval(vectorClass + `println(Vec(1, 2), [Vec(3, 4)]); printf("%s\n", Vec(5, 6));`)
+
+	expected := "(1, 2) [Vec(3, 4)]\n(5, 6)\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestPrintfVerbs(t *testing.T) {
+	var out bytes.Buffer
+	SetStd(&out, &out)
+	defer SetStd(os.Stdout, os.Stderr)
+
+	testEval(`printf("%s %d|%5d|%x %.2f %.2f|%-7.2f|%s %d\n",
+		1, 2, 3, 255, 1.5, decimal("2.675"), decimal(-1), decimal("0.10"), 2 ** 64);`)
+
+	expected := "1 2|    3|ff 1.50 2.68|-1.00  |0.10 18446744073709551616\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestInheritance(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`class A { fn f() { return 1; } }; class B(A) { }; B().f()`, 1},
+		{`class A { let x = 5; }; class B(A) { }; B.x`, 5},
+		{`class A { fn f() { return 1; } }; class B(A) { fn f() { return 2; } }; B().f()`, 2},
+		{`class A { fn f() { return 1; } }; class B(A) { fn f() { return super().f() + 10; } }; B().f()`, 11},
+		{`
+		class A { fn __init__(x) { self.x = x; } };
+		class B(A) { fn __init__(x, y) { super().__init__(x); self.y = y; } };
+		let b = B(1, 2);
+		b.x + b.y`, 3},
+		{`
+		class A { fn who() { return "A"; } };
+		class B(A) { fn who() { return "B" + super().who(); } };
+		class C(A) { fn who() { return "C" + super().who(); } };
+		class D(B, C) { fn who() { return "D" + super().who(); } };
+		D().who()`, "DBCA"},
+		{`
+		class A { fn who() { return "A"; } };
+		class B(A) { fn who() { return "B" + super(B, self).who(); } };
+		B().who()`, "BA"},
+		{`
+		class MyErr(ValueError) {
+			fn __init__(msg, code) { super().__init__(msg); self.code = code; }
+		};
+		try { throw MyErr("bad", 3); } catch (ValueError e) { e.message + string(e.code) }`, "bad3"},
+		{`class A { }; class B(A) { }; isinstance(B(), A)`, true},
+		{`class A { }; class B(A) { }; isinstance(A(), B)`, false},
+		{`class A { }; class B { }; isinstance(A(), [B, A])`, true},
+		{`isinstance(5, Exception)`, false},
+		{`try { 1 / 0; } catch (e) { isinstance(e, ArithmeticError) }`, true},
+		{`class A { }; class B(A) { }; issubclass(B, A)`, true},
+		{`class A { }; class B(A) { }; issubclass(A, B)`, false},
+		{`issubclass(KeyError, [IndexError, LookupError])`, true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("String has wrong value. want=%q, got=%q", expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestInheritanceErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`class A { }; class B(A) { }; class C(A, B) { }`, "cannot create a consistent method resolution order for C"},
+		{`class A(1) { }`, "class A cannot inherit from INTEGER"},
+		{`super()`, "super(): no arguments outside a method"},
+		{`class P { fn m() { return 1; } }; class Q(P) { fn m() { let f = fn() { return super().m(); }; return f(); } }; Q().m()`,
+			"super(): no arguments outside a method"},
+		{`class A { fn f() { return super().f(); } }; A().f()`, "'super' object has no attribute 'f'"},
+		{`class A { }; class B { }; super(B, A())`, "super(type, obj): obj must be an instance of B"},
+		{`issubclass(1, Exception)`, "issubclass() arg 1 must be a class, got INTEGER"},
+		{`isinstance(1, 2)`, "isinstance() arg 2 must be a class or an array of classes, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestBoundMethods(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`
+		class C { fn __init__(v) { self.v = v; } fn get() { return self.v; } };
+		let a = C(1);
+		let b = C(2);
+		let fa = a.get;
+		let fb = b.get;
+		fa() + fb() * 10`, 21},
+		{`
+		class C { fn __init__(v) { self.v = v; } fn get() { return self.v; } fn getter() { return self.get; } };
+		let g = C(7).getter();
+		C(8);
+		g()`, 7},
+		{`
+		class C { fn __init__(v) { self.v = v; } fn get() { return self.v; } };
+		let h = {"m": C(3).get};
+		C(4).get();
+		h["m"]()`, 3},
+		{`
+		class C { fn __init__(v) { self.v = v; } fn adder() { return fn(x) { x + self.v }; } };
+		let add = C(10).adder();
+		C(20).adder();
+		add(1)`, 11},
+		{`class C { fn get() { return 1; } }; let c = C(); c.get.__self__ == c`, true},
+		{`class C { }; let c = C(); c.f = fn() { 5 }; c.f()`, 5},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		}
+	}
+}
+
+func TestClosureScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let x = 1; let f = fn() { let x = 2; x }; f() + x * 10`, 12},
+		{`let make = fn() { let c = 0; fn() { c = c + 1; c } }; let inc = make(); inc(); inc()`, 2},
+		{`let make = fn() { let c = 0; fn() { c = c + 1; c } }; let a = make(); let b = make(); a(); a(); b()`, 1},
+		{`let n = 5; let h = {"add": fn(x) { x + n }}; h["add"](1)`, 6},
+		{`let f = fn() { fn g() { 3 }; g() }; f()`, 3},
+		{`fn g() { 1 }; let f = fn() { fn g() { 2 }; g() }; f() * 10 + g()`, 21},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`fn f(a, b = 2) { a * 10 + b }; f(1)`, 12},
+		{`fn f(a, b = 2) { a * 10 + b }; f(1, 3)`, 13},
+		{`fn f(a, b = 2) { a * 10 + b }; f(b: 5, a: 4)`, 45},
+		{`let d = 1; fn f(a = d) { a }; d = 2; f()`, 1},
+		{`fn f(...args) { len(args) }; f()`, 0},
+		{`fn f(a, ...rest) { a + len(rest) }; f(10, 1, 2, 3)`, 13},
+		{`fn f(a, b, c) { a * 100 + b * 10 + c }; let xs = [1, 2]; f(...xs, 3)`, 123},
+		{`fn f(a, b, c) { a * 100 + b * 10 + c }; f(...range(2), c: 9)`, 19},
+		{`fn f(...xs) { xs[1] }; if (f(..."abc") == "b") { 1 } else { 0 }`, 1},
+		{`class P { fn __init__(x, y = 0) { self.x = x; self.y = y; } }; let p = P(y: 5, x: 1); p.x * 10 + p.y`, 15},
+		{`class C { fn m(a, b = 1) { a + b } }; C().m(b: 2, a: 3)`, 5},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArityErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{`fn g(a, b) { a }; g(1)`, "g() missing 1 required argument: 'b'"},
+		{`fn g(a, b) { a }; g()`, "g() missing 2 required arguments: 'a', 'b'"},
+		{`fn g(a, b) { a }; g(1, 2, 3)`, "g() takes 2 positional arguments but 3 were given"},
+		{`fn(a) { a }(1, 2)`, "<anonymous>() takes 1 positional argument but 2 were given"},
+		{`fn g(a) { a }; g(1, b: 2)`, "g() got an unexpected keyword argument 'b'"},
+		{`fn g(a) { a }; g(1, a: 2)`, "g() got multiple values for argument 'a'"},
+		{`fn g(a) { a }; g(...1)`, "'INTEGER' object is not iterable"},
+		{`class C { fn __init__(x) { } }; C()`, "__init__() missing 1 required argument: 'x'"},
+		{`class C { }; C(1)`, "C() takes no arguments"},
+		{`len(x: [])`, "len() takes no keyword arguments"},
+		{`"a b".split(1)`, "separator must be STRING, got INTEGER"},
+		{`system(1)`, "arguments to 'system' must be STRING, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Class != object.TypeError {
+			t.Errorf("wrong error class for %q. got=%s", tt.input, errObj.TypeName())
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+// fuzzUnsafe matches the programs FuzzEval does not run: loops may not
+// end, and these builtins leave the process, run commands, touch files
+// or wait for input.
+var fuzzUnsafe = regexp.MustCompile(`\b(while|for|import|exit|system|file|input|range)\b`)
+
+// FuzzEval runs any input through the lexer, the parser and, if it
+// parses, the evaluator, none of which may panic.
+func FuzzEval(f *testing.F) {
+	for _, seed := range []string{
+		`let x = 1; x + 2.5`,
+		`fn f(n) { if (n < 2) { return n; } f(n - 1) + f(n - 2) }; f(10)`,
+		`fn f() { f() }; f()`,
+		`"ab" * -1; "ab" * 99999999999; 5 / 0`,
+		`class A { fn __init__(self, x) { self.x = x; } }; A(1).x`,
+		`try { throw ValueError("v") } catch (ValueError e) { e.message } finally { 1 }`,
+		`[1, 2][5]; {}[[]]; {[]: 1}`,
+		`fn(a, b = 2, ...c) { c }(1, b: 3)`,
+		`let s = "abc"; s.upper().reverse()`,
+		`super(); new(); getattr(1); setattr(); type(); len()`,
+		`print(1, "a", [], {}, fn() {}, 1.5, true, null)`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 || fuzzUnsafe.MatchString(input) {
+			return
+		}
+
+		SetStd(io.Discard, io.Discard)
+		defer SetStd(os.Stdout, os.Stderr)
+		Eval(program, object.NewEnvironment())
+	})
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/yushyn-andriy/firefly/token"
 )
@@ -11,15 +12,29 @@ type Lexer struct {
 	position     int
 	readPosition int
 	ch           byte
+
+	filename string
+	line     int // line of ch
+	column   int // column of ch
 }
 
 func New(input string) *Lexer {
-	l := Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile creates a lexer whose token positions refer to filename.
+func NewFile(filename, input string) *Lexer {
+	l := Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
 	return &l
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -28,6 +43,11 @@ func (l *Lexer) readChar() {
 
 	l.position = l.readPosition
 	l.readPosition += 1
+	l.column += 1
+}
+
+func (l *Lexer) pos() token.Position {
+	return token.Position{Filename: l.filename, Line: l.line, Column: l.column}
 }
 
 func (l *Lexer) NextToken() token.Token {
@@ -35,6 +55,8 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.skipWhitespace()
 
+	pos := l.pos()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -58,13 +80,45 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '/' {
+			tok = l.readTwoCharToken(token.FLOOR_DIV)
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			tok = l.readTwoCharToken(token.POWER)
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.LT_EQ)
+		case '<':
+			tok = l.readTwoCharToken(token.SHIFT_LEFT)
+		default:
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		switch l.peekChar() {
+		case '=':
+			tok = l.readTwoCharToken(token.GT_EQ)
+		case '>':
+			tok = l.readTwoCharToken(token.SHIFT_RIGHT)
+		default:
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		tok = newToken(token.AMPERSAND, l.ch)
+	case '|':
+		tok = newToken(token.PIPE, l.ch)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -86,11 +140,19 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RBRACKET, l.ch)
 	case ':':
 		tok = newToken(token.COLON, l.ch)
+	case '?':
+		tok = newToken(token.QUESTION, l.ch)
 	case '#':
 		tok = newToken(token.COMMENT, l.ch)
 		l.skipLine()
 	case '.':
-		tok = newToken(token.DOT, l.ch)
+		if strings.HasPrefix(l.input[l.position:], token.ELLIPSIS) {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: token.ELLIPSIS}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -98,6 +160,7 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			intPart := l.readNumber()
@@ -114,6 +177,7 @@ func (l *Lexer) NextToken() token.Token {
 				tok.Type = token.INT
 				tok.Literal = intPart
 			}
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -122,6 +186,7 @@ func (l *Lexer) NextToken() token.Token {
 
 	l.readChar()
 
+	tok.Pos = pos
 	return tok
 }
 
@@ -175,6 +240,14 @@ func (l *Lexer) skipLine() {
 	}
 }
 
+// readTwoCharToken consumes the current character and returns a token of
+// tokenType made of it and the next one.
+func (l *Lexer) readTwoCharToken(tokenType token.TokenType) token.Token {
+	ch := l.ch
+	l.readChar()
+	return token.Token{Type: tokenType, Literal: string(ch) + string(l.ch)}
+}
+
 func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
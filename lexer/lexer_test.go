@@ -19,8 +19,29 @@ func TestIdentifiersNextToken(t *testing.T) {
 	==
 	!=
 	.
+	...
 	or
 	and
+	try
+	catch
+	finally
+	throw
+	while
+	break
+	continue
+	in
+	<=
+	>=
+	%
+	**
+	//
+	&
+	|
+	^
+	~
+	<<
+	>>
+	?
 	`
 
 	tests := []struct {
@@ -38,8 +59,29 @@ func TestIdentifiersNextToken(t *testing.T) {
 		{token.EQ, "=="},
 		{token.NOT_EQ, "!="},
 		{token.DOT, "."},
+		{token.ELLIPSIS, "..."},
 		{token.OR, "or"},
 		{token.AND, "and"},
+		{token.TRY, "try"},
+		{token.CATCH, "catch"},
+		{token.FINALLY, "finally"},
+		{token.THROW, "throw"},
+		{token.WHILE, "while"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.IN, "in"},
+		{token.LT_EQ, "<="},
+		{token.GT_EQ, ">="},
+		{token.PERCENT, "%"},
+		{token.POWER, "**"},
+		{token.FLOOR_DIV, "//"},
+		{token.AMPERSAND, "&"},
+		{token.PIPE, "|"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.SHIFT_LEFT, "<<"},
+		{token.SHIFT_RIGHT, ">>"},
+		{token.QUESTION, "?"},
 	}
 
 	lexer := New(input)
@@ -316,3 +358,79 @@ let a2
 	}
 	// t.Fatal("not implemented")
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  fn add(a, b) {
+	"str" # comment
+}`
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"fn", 2, 3},
+		{"add", 2, 6},
+		{"(", 2, 9},
+		{"a", 2, 10},
+		{",", 2, 11},
+		{"b", 2, 13},
+		{")", 2, 14},
+		{"{", 2, 16},
+		{"str", 3, 2},
+		{"#", 3, 8},
+		{"}", 4, 1},
+		{"", 4, 2},
+	}
+
+	l := NewFile("test.fl", input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos.Filename != "test.fl" {
+			t.Fatalf("tests[%d] - filename wrong. expected=%q, got=%q",
+				i, "test.fl", tok.Pos.Filename)
+		}
+		if tok.Pos.Line != tt.expectedLine || tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Pos.Line, tok.Pos.Column)
+		}
+	}
+}
+
+// FuzzLexer checks that the lexer gets through any input: every token
+// but EOF consumes input, so there can be no more tokens than bytes.
+func FuzzLexer(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"let x = 5;\nfn add(a, b) { a + b }",
+		`"unterminated`,
+		"1. 2.5 3..4 ...",
+		"# comment only",
+		"\x00 after nul",
+		"é ~ ` @ $",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		for i := 0; ; i++ {
+			if i > len(input) {
+				t.Fatalf("more tokens than bytes in %q", input)
+			}
+			if tok := l.NextToken(); tok.Type == token.EOF {
+				return
+			}
+		}
+	})
+}
@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"os/user"
+	"path/filepath"
+	"strings"
 
 	"github.com/yushyn-andriy/firefly/config"
 	"github.com/yushyn-andriy/firefly/repl"
@@ -14,11 +16,22 @@ import (
 var (
 	debug = flag.Bool("d", false, "debug mode")
 	comp  = flag.Bool("c", false, "compiler mode")
+	opt   = flag.Bool("O", false, "optimize the program before running it")
 )
 
 func main() {
 	flag.Parse()
 	args := flag.Args()
+
+	if len(args) > 0 && args[0] == "build" {
+		build(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "disasm" {
+		disasm(args[1:])
+		return
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -28,12 +41,14 @@ func main() {
 		Debug:        *debug,
 		Mode:         config.INTERACTIVE,
 		CompilerMode: *comp,
+		Optimize:     *opt,
 	}
 
 	if len(args) > 0 {
 		conf.Mode = config.FROM_FILE
 
 		filePath := args[0]
+		conf.FilePath = filePath
 		file, err := os.Open(filePath)
 		if err != nil {
 			log.Fatalf("%s", err)
@@ -45,3 +60,44 @@ func main() {
 		repl.Start(os.Stdin, os.Stdout, conf)
 	}
 }
+
+// build implements `firefly build [-o output] file.fl`, which compiles
+// file.fl to file.flc. Running a .flc file executes it on the VM.
+func build(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	output := fs.String("o", "", "output file, the source name with .flc by default")
+	optimize := fs.Bool("O", false, "optimize the program before compiling it")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: firefly build [-O] [-o output] file.fl")
+		os.Exit(2)
+	}
+	src := fs.Arg(0)
+
+	dst := *output
+	if dst == "" {
+		dst = strings.TrimSuffix(src, filepath.Ext(src)) + ".flc"
+	}
+
+	if err := repl.Build(src, dst, *optimize); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
+
+// disasm implements `firefly disasm [-O] file`, which prints the bytecode
+// of a source or .flc file.
+func disasm(args []string) {
+	fs := flag.NewFlagSet("disasm", flag.ExitOnError)
+	optimize := fs.Bool("O", false, "optimize source files before compiling them")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: firefly disasm [-O] file.fl|file.flc")
+		os.Exit(2)
+	}
+
+	if err := repl.Disasm(fs.Arg(0), os.Stdout, *optimize); err != nil {
+		log.Fatalf("%s", err)
+	}
+}
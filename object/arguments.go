@@ -0,0 +1,126 @@
+package object
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keyword is an argument passed by name.
+type Keyword struct {
+	Name  string
+	Value Object
+}
+
+// Parameters describes what a function takes, so that both engines bind
+// the arguments of a call to it the same way.
+type Parameters struct {
+	Function string   // the name errors report the function under
+	Names    []string // the parameters, without the rest parameter
+	// Defaults holds the default value of each parameter, nil for those
+	// without one. It may be shorter than Names.
+	Defaults []Object
+	Rest     bool // a rest parameter follows the others
+}
+
+// Bind binds args and kwargs to p the way Python binds them: positionally
+// first, then by keyword, then from the defaults. It returns the value of
+// each parameter and the extra positional arguments, which go to the rest
+// parameter.
+func (p Parameters) Bind(args []Object, kwargs []Keyword) ([]Object, []Object, *Error) {
+	if len(args) > len(p.Names) && !p.Rest {
+		return nil, nil, TooManyArguments(p.Function, len(p.Names), len(args))
+	}
+
+	values := make([]Object, len(p.Names))
+	rest := []Object{}
+	for i, arg := range args {
+		if i < len(values) {
+			values[i] = arg
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+
+	for _, kw := range kwargs {
+		i := p.index(kw.Name)
+		if i < 0 {
+			return nil, nil, NewError(TypeError, "%s() got an unexpected keyword argument '%s'",
+				p.Function, kw.Name)
+		}
+		if values[i] != nil {
+			return nil, nil, NewError(TypeError, "%s() got multiple values for argument '%s'",
+				p.Function, kw.Name)
+		}
+		values[i] = kw.Value
+	}
+
+	missing := []string{}
+	for i, name := range p.Names {
+		if values[i] != nil {
+			continue
+		}
+		if i < len(p.Defaults) && p.Defaults[i] != nil {
+			values[i] = p.Defaults[i]
+			continue
+		}
+		missing = append(missing, name)
+	}
+	if len(missing) > 0 {
+		return nil, nil, MissingArguments(p.Function, missing)
+	}
+	return values, rest, nil
+}
+
+func (p Parameters) index(name string) int {
+	for i, n := range p.Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// TooManyArguments is the error for a call of function, which takes
+// want positional arguments, with the given number of them.
+func TooManyArguments(function string, want, given int) *Error {
+	return NewError(TypeError, "%s() takes %d positional %s but %d %s given",
+		function, want, Plural(want, "argument"), given, Plural(given, "was", "were"))
+}
+
+// MissingArguments is the error for a call of function that leaves the
+// parameters names without a value.
+func MissingArguments(function string, names []string) *Error {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = fmt.Sprintf("'%s'", name)
+	}
+	return NewError(TypeError, "%s() missing %d required %s: %s",
+		function, len(names), Plural(len(names), "argument"), strings.Join(quoted, ", "))
+}
+
+// NoKeywordArguments is the error for passing keyword arguments to fn,
+// which is not a function defined in the language: either a builtin or
+// no function at all.
+func NoKeywordArguments(fn Object) *Error {
+	builtin, ok := fn.(*Builtin)
+	if !ok {
+		return NewError(TypeError, "not a function: %s", fn.Type())
+	}
+	name := builtin.Name
+	if name == "" {
+		name = "builtin function"
+	}
+	return NewError(TypeError, "%s() takes no keyword arguments", name)
+}
+
+// Plural picks the singular or plural form of a word for n. With a single
+// form given the plural is made by adding an s.
+func Plural(n int, forms ...string) string {
+	if n == 1 {
+		return forms[0]
+	}
+	if len(forms) > 1 {
+		return forms[1]
+	}
+	return forms[0] + "s"
+}
@@ -0,0 +1,226 @@
+package object
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// The operations below take more than the Go operator of the same name.
+// The evaluator and the VM share them so that both engines compute the
+// same results. As in Python, division with // rounds toward negative
+// infinity and the remainder of % takes the sign of the divisor.
+//
+// Integers that overflow 64 bits do not wrap around but become big
+// integers: 9223372036854775807 + 1 is 9223372036854775808.
+
+// floatOperators are the operators that take mixed integer and float
+// operands, by turning the integer into a float.
+var floatOperators = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "%": true, "**": true, "//": true,
+	"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true,
+}
+
+// PromoteToFloat returns the operands of operator as floats when one of
+// them is an integer and the other a float, so that 1 + 2.0 is 3.0 and
+// 1 == 1.0 is true. It reports false for any other operands.
+func PromoteToFloat(operator string, left, right Object) (*Float, *Float, bool) {
+	if !floatOperators[operator] {
+		return nil, nil, false
+	}
+	if l, ok := left.(*Float); ok {
+		if r, ok := integerToFloat(right); ok {
+			return l, r, true
+		}
+	} else if r, ok := right.(*Float); ok {
+		if l, ok := integerToFloat(left); ok {
+			return l, r, true
+		}
+	}
+	return nil, nil, false
+}
+
+func integerToFloat(obj Object) (*Float, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return &Float{Value: float64(obj.Value)}, true
+	case *BigInteger:
+		return &Float{Value: bigToFloat(obj.Value)}, true
+	}
+	return nil, false
+}
+
+// FloatToInteger truncates f toward zero, failing for infinities and
+// NaN.
+func FloatToInteger(f float64) Object {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return NewError(ValueError, "cannot convert float %s to integer",
+			strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	// -2**63 is an int64, 2**63 is not
+	if f < -(1<<63) || f >= 1<<63 {
+		v, _ := big.NewFloat(f).Int(nil)
+		return NewBigInteger(v)
+	}
+	return NewInteger(int64(f))
+}
+
+// Add returns a + b for integers.
+func Add(a, b int64) Object {
+	c := a + b
+	if (c > a) != (b > 0) {
+		return NewBigInteger(new(big.Int).Add(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: c}
+}
+
+// Sub returns a - b for integers.
+func Sub(a, b int64) Object {
+	c := a - b
+	if (c < a) != (b > 0) {
+		return NewBigInteger(new(big.Int).Sub(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: c}
+}
+
+// Mul returns a * b for integers.
+func Mul(a, b int64) Object {
+	c, ok := mul64(a, b)
+	if !ok {
+		return NewBigInteger(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)))
+	}
+	return &Integer{Value: c}
+}
+
+// mul64 returns a * b and whether it did not overflow.
+func mul64(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	c := a * b
+	if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) || c/b != a {
+		return 0, false
+	}
+	return c, true
+}
+
+// Div returns a / b for integers, rounded toward zero.
+func Div(a, b int64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "integer division by zero")
+	}
+	if a == math.MinInt64 && b == -1 {
+		return Neg(a)
+	}
+	return &Integer{Value: a / b}
+}
+
+// Neg returns -a for an integer.
+func Neg(a int64) Object {
+	if a == math.MinInt64 {
+		return NewBigInteger(new(big.Int).Neg(big.NewInt(a)))
+	}
+	return &Integer{Value: -a}
+}
+
+// FloorDiv returns a // b for integers.
+func FloorDiv(a, b int64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "integer division by zero")
+	}
+	if a == math.MinInt64 && b == -1 {
+		return Neg(a)
+	}
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return &Integer{Value: q}
+}
+
+// Mod returns a % b for integers.
+func Mod(a, b int64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "integer modulo by zero")
+	}
+	r := a % b
+	if r != 0 && ((r < 0) != (b < 0)) {
+		r += b
+	}
+	return &Integer{Value: r}
+}
+
+// Pow returns a ** b for integers. A negative exponent gives a float.
+func Pow(a, b int64) Object {
+	if b < 0 {
+		return FloatPow(float64(a), float64(b))
+	}
+	result, base := int64(1), a
+	for e := b; e > 0; e >>= 1 {
+		var ok bool
+		if e&1 == 1 {
+			if result, ok = mul64(result, base); !ok {
+				return bigPow(big.NewInt(a), big.NewInt(b))
+			}
+		}
+		if e > 1 {
+			if base, ok = mul64(base, base); !ok {
+				return bigPow(big.NewInt(a), big.NewInt(b))
+			}
+		}
+	}
+	return &Integer{Value: result}
+}
+
+// Shift returns a << b or a >> b, as operator says.
+func Shift(operator string, a, b int64) Object {
+	if b < 0 {
+		return NewError(ValueError, "negative shift count")
+	}
+	if operator == "<<" {
+		if b >= 63 || (a<<uint64(b))>>uint64(b) != a {
+			return bigShift(operator, big.NewInt(a), big.NewInt(b))
+		}
+		return &Integer{Value: a << uint64(b)}
+	}
+	return &Integer{Value: a >> uint64(b)}
+}
+
+// FloatDiv returns a / b for floats.
+func FloatDiv(a, b float64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "float division by zero")
+	}
+	return &Float{Value: a / b}
+}
+
+// FloatFloorDiv returns a // b for floats.
+func FloatFloorDiv(a, b float64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "float floor division by zero")
+	}
+	return &Float{Value: math.Floor(a / b)}
+}
+
+// FloatMod returns a % b for floats.
+func FloatMod(a, b float64) Object {
+	if b == 0 {
+		return NewError(ZeroDivisionError, "float modulo by zero")
+	}
+	r := math.Mod(a, b)
+	if r != 0 && ((r < 0) != (b < 0)) {
+		r += b
+	}
+	return &Float{Value: r}
+}
+
+// FloatPow returns a ** b for floats.
+func FloatPow(a, b float64) Object {
+	switch {
+	case a == 0 && b < 0:
+		return NewError(ZeroDivisionError, "0.0 cannot be raised to a negative power")
+	case a < 0 && b != math.Trunc(b):
+		return NewError(ValueError, "negative number cannot be raised to a fractional power")
+	}
+	return &Float{Value: math.Pow(a, b)}
+}
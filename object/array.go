@@ -2,7 +2,6 @@ package object
 
 import (
 	"bytes"
-	"fmt"
 	"strings"
 )
 
@@ -24,17 +23,48 @@ func NewArray(elements []Object) *Array {
 func (ao *Array) initialize() {}
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
-func (ao *Array) Inspect() string {
+func (ao *Array) Inspect() string  { return inspectNested(ao, map[Object]bool{}) }
+
+// inspectNested renders obj like Inspect. The arrays and hashes in active
+// are being rendered already, and show as [...] and {...} where they
+// contain themselves, as they do in Python.
+func inspectNested(obj Object, active map[Object]bool) string {
 	var out bytes.Buffer
 
-	elements := []string{}
-	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
-	}
+	switch obj := obj.(type) {
+	case *Array:
+		if active[obj] {
+			return "[...]"
+		}
+		active[obj] = true
+		defer delete(active, obj)
+
+		elements := []string{}
+		for _, e := range obj.Elements {
+			elements = append(elements, inspectNested(e, active))
+		}
+
+		out.WriteString("[")
+		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString("]")
+	case *Hash:
+		if active[obj] {
+			return "{...}"
+		}
+		active[obj] = true
+		defer delete(active, obj)
 
-	out.WriteString("[")
-	out.WriteString(strings.Join(elements, ", "))
-	out.WriteString("]")
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, inspectNested(pair.Key, active)+": "+inspectNested(pair.Value, active))
+		}
+
+		out.WriteString("{")
+		out.WriteString(strings.Join(pairs, ", "))
+		out.WriteString("}")
+	default:
+		return obj.Inspect()
+	}
 
 	return out.String()
 }
@@ -42,8 +72,12 @@ func (ao *Array) Len() Object {
 	return &Integer{Value: int64(len(ao.Elements))}
 }
 func (ao *Array) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", ao.Inspect(), key)}
+	return attributeError(ao, key)
 }
 func (ao *Array) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", ao.Inspect(), key)}
+	return attributeError(ao, key)
+}
+
+func (ao *Array) Iter() *Iterator {
+	return sliceIterator(ao.Elements)
 }
@@ -0,0 +1,261 @@
+package object
+
+import (
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// MaxIntegerBits bounds the size of big integers and decimals, so that
+// a runaway 7 ** 7 ** 7 ** 7 fails rather than exhausting memory.
+const MaxIntegerBits = 1 << 20
+
+// BigInteger is an integer out of the range of int64. Operations on
+// Integer that overflow give a BigInteger, and operations on BigInteger
+// whose result fits in an int64 give an Integer again, so that every
+// value has exactly one representation. Both have the type INTEGER.
+type BigInteger struct {
+	Value *big.Int
+}
+
+// NewBigInteger returns v as an Integer if it fits in an int64 and as a
+// BigInteger otherwise.
+func NewBigInteger(v *big.Int) Object {
+	if v.IsInt64() {
+		return NewInteger(v.Int64())
+	}
+	if v.BitLen() > MaxIntegerBits {
+		return NewError(OverflowError, "integer is too large")
+	}
+	return &BigInteger{Value: v}
+}
+
+func (b *BigInteger) Type() ObjectType { return INTEGER_OBJ }
+func (b *BigInteger) Inspect() string  { return b.Value.String() }
+func (b *BigInteger) HashKey() HashKey { return bigHashKey(b.Value) }
+
+func (b *BigInteger) SetAttr(key string, value Object) Object {
+	return attributeError(b, key)
+}
+
+func (b *BigInteger) GetAttr(key string) Object {
+	return attributeError(b, key)
+}
+
+// Neg returns -b.
+func (b *BigInteger) Neg() Object {
+	return NewBigInteger(new(big.Int).Neg(b.Value))
+}
+
+// Invert returns ~b.
+func (b *BigInteger) Invert() Object {
+	return NewBigInteger(new(big.Int).Not(b.Value))
+}
+
+func bigHashKey(v *big.Int) HashKey {
+	h := fnv.New64a()
+	if v.Sign() < 0 {
+		h.Write([]byte{'-'})
+	}
+	h.Write(v.Bytes())
+
+	return HashKey{Type: INTEGER_OBJ, Value: h.Sum64()}
+}
+
+// Int64 returns the value of an Integer or BigInteger. Big integers are
+// out of the range of any count or index and are clamped to the range
+// of int64.
+func Int64(obj Object) int64 {
+	switch obj := obj.(type) {
+	case *Integer:
+		return obj.Value
+	case *BigInteger:
+		if obj.Value.Sign() < 0 {
+			return math.MinInt64
+		}
+		return math.MaxInt64
+	}
+	return 0
+}
+
+// bigValue returns the value of an Integer or BigInteger. The result
+// must not be modified.
+func bigValue(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value), true
+	case *BigInteger:
+		return obj.Value, true
+	}
+	return nil, false
+}
+
+// BigOperation returns left operator right when either operand is a big
+// integer or a decimal and the other one an integer or a decimal, and
+// reports false for any other operands, which are left to the caller.
+// An integer and a decimal give a decimal.
+func BigOperation(operator string, left, right Object) (Object, bool) {
+	var result Object
+	switch {
+	case left.Type() == DECIMAL_OBJ || right.Type() == DECIMAL_OBJ:
+		l, ok := toDecimal(left)
+		if !ok {
+			return nil, false
+		}
+		r, ok := toDecimal(right)
+		if !ok {
+			return nil, false
+		}
+		result = decimalOperation(operator, l, r)
+
+	case isBig(left) || isBig(right):
+		l, ok := bigValue(left)
+		if !ok {
+			return nil, false
+		}
+		r, ok := bigValue(right)
+		if !ok {
+			return nil, false
+		}
+		result = bigOperation(operator, l, r)
+
+	default:
+		return nil, false
+	}
+
+	if result == nil {
+		return NewError(TypeError, "unknown operator: %s %s %s",
+			left.Type(), operator, right.Type()), true
+	}
+	return result, true
+}
+
+func isBig(obj Object) bool {
+	_, ok := obj.(*BigInteger)
+	return ok
+}
+
+// bigOperation returns a operator b, or nil for an unknown operator.
+func bigOperation(operator string, a, b *big.Int) Object {
+	switch operator {
+	case "+":
+		return NewBigInteger(new(big.Int).Add(a, b))
+	case "-":
+		return NewBigInteger(new(big.Int).Sub(a, b))
+	case "*":
+		if a.BitLen()+b.BitLen() > MaxIntegerBits+1 {
+			return NewError(OverflowError, "integer is too large")
+		}
+		return NewBigInteger(new(big.Int).Mul(a, b))
+	case "/":
+		if b.Sign() == 0 {
+			return NewError(ZeroDivisionError, "integer division by zero")
+		}
+		return NewBigInteger(new(big.Int).Quo(a, b))
+	case "//":
+		if b.Sign() == 0 {
+			return NewError(ZeroDivisionError, "integer division by zero")
+		}
+		return NewBigInteger(bigFloorDiv(a, b))
+	case "%":
+		if b.Sign() == 0 {
+			return NewError(ZeroDivisionError, "integer modulo by zero")
+		}
+		return NewBigInteger(bigMod(a, b))
+	case "**":
+		return bigPow(a, b)
+	case "&":
+		return NewBigInteger(new(big.Int).And(a, b))
+	case "|":
+		return NewBigInteger(new(big.Int).Or(a, b))
+	case "^":
+		return NewBigInteger(new(big.Int).Xor(a, b))
+	case "<<", ">>":
+		return bigShift(operator, a, b)
+	case "<":
+		return nativeBool(a.Cmp(b) < 0)
+	case ">":
+		return nativeBool(a.Cmp(b) > 0)
+	case "<=":
+		return nativeBool(a.Cmp(b) <= 0)
+	case ">=":
+		return nativeBool(a.Cmp(b) >= 0)
+	case "==":
+		return nativeBool(a.Cmp(b) == 0)
+	case "!=":
+		return nativeBool(a.Cmp(b) != 0)
+	}
+	return nil
+}
+
+// bigFloorDiv returns a // b, rounded toward negative infinity like
+// FloorDiv. big.Int.Div rounds so that the remainder is never negative,
+// which differs for negative divisors.
+func bigFloorDiv(a, b *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(a, b, new(big.Int))
+	if r.Sign() != 0 && (r.Sign() < 0) != (b.Sign() < 0) {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+// bigMod returns a % b, which takes the sign of b like Mod.
+func bigMod(a, b *big.Int) *big.Int {
+	r := new(big.Int).Rem(a, b)
+	if r.Sign() != 0 && (r.Sign() < 0) != (b.Sign() < 0) {
+		r.Add(r, b)
+	}
+	return r
+}
+
+func bigPow(a, b *big.Int) Object {
+	if b.Sign() < 0 {
+		return FloatPow(bigToFloat(a), bigToFloat(b))
+	}
+	// -1, 0 and 1 stay small whatever the exponent; for any other base
+	// the result has at least (bits of a - 1) * b bits
+	if a.CmpAbs(big.NewInt(1)) <= 0 {
+		if a.Sign() < 0 && b.Bit(0) == 0 {
+			return NewInteger(1)
+		}
+		return NewBigInteger(a)
+	}
+	if !b.IsInt64() || b.Int64() > MaxIntegerBits ||
+		int64(a.BitLen()-1)*b.Int64() > MaxIntegerBits {
+		return NewError(OverflowError, "integer is too large")
+	}
+	return NewBigInteger(new(big.Int).Exp(a, b, nil))
+}
+
+func bigShift(operator string, a, b *big.Int) Object {
+	if b.Sign() < 0 {
+		return NewError(ValueError, "negative shift count")
+	}
+	if operator == ">>" {
+		// shifting by more than the bits of a leaves 0 or -1
+		n := uint(a.BitLen() + 1)
+		if b.IsInt64() && b.Int64() < int64(n) {
+			n = uint(b.Int64())
+		}
+		return NewBigInteger(new(big.Int).Rsh(a, n))
+	}
+	if a.Sign() == 0 {
+		return NewInteger(0)
+	}
+	if !b.IsInt64() || b.Int64() > MaxIntegerBits || int64(a.BitLen())+b.Int64() > MaxIntegerBits {
+		return NewError(OverflowError, "integer is too large")
+	}
+	return NewBigInteger(new(big.Int).Lsh(a, uint(b.Int64())))
+}
+
+func bigToFloat(v *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+func nativeBool(b bool) *Boolean {
+	if b {
+		return TRUE
+	}
+	return FALSE
+}
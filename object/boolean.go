@@ -21,8 +21,34 @@ func (b *Boolean) HashKey() HashKey {
 	return HashKey{Type: b.Type(), Value: value}
 }
 func (b *Boolean) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", b.Inspect(), key)}
+	return attributeError(b, key)
 }
 func (b *Boolean) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", b.Inspect(), key)}
+	return attributeError(b, key)
+}
+
+// IsTruthy reports whether obj counts as true in a condition and for
+// and, or and !. false, null, zero and empty strings, arrays and hashes
+// count as false, everything else as true. Instances that define
+// __bool__ are left to the engines.
+func IsTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null:
+		return false
+	case *Integer:
+		return obj.Value != 0
+	case *Float:
+		return obj.Value != 0
+	case *Decimal:
+		return obj.Value.Sign() != 0
+	case *String:
+		return obj.Value != ""
+	case *Array:
+		return len(obj.Elements) != 0
+	case *Hash:
+		return len(obj.Pairs) != 0
+	}
+	return true
 }
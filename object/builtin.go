@@ -1,12 +1,28 @@
 package object
 
-import "fmt"
+// Env is what a builtin sees of the engine that calls it: the variables
+// of the calling scope, and a way to call functions, which builtins need
+// to reach the magic methods of instances. Both the evaluator and the VM
+// implement it.
+type Env interface {
+	Get(name string) (Object, bool)
+	// Method returns the class and the receiver of the method making the
+	// call. ok is false outside a method, in functions nested in one too.
+	Method() (cls Object, self Object, ok bool)
+	Locals() *Hash
+	Call(fn Object, args ...Object) Object
+}
+
+// CallFunc calls fn with args the way the engine running the program
+// does. The object package uses it to run the methods of instances.
+type CallFunc func(fn Object, args ...Object) Object
 
-type BuiltinFunction func(env *Environment, args ...Object) Object
+type BuiltinFunction func(env Env, args ...Object) Object
 
 type Builtin struct {
+	Name string
 	Fn   BuiltinFunction
-	Env  *Environment
+	Env  Env // nil when the caller supplies its own
 	Self Object
 	Doc  string
 }
@@ -14,8 +30,8 @@ type Builtin struct {
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
 func (b *Builtin) Inspect() string  { return "builtin function" }
 func (b *Builtin) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", b.Inspect(), key)}
+	return attributeError(b, key)
 }
 func (b *Builtin) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", b.Inspect(), key)}
+	return attributeError(b, key)
 }
@@ -7,9 +7,14 @@ import (
 )
 
 type Class struct {
-	Name *ast.Identifier
-	Body *ast.BlockStatement
-	Env  *Environment
+	Name  *ast.Identifier
+	Body  *ast.BlockStatement
+	Env   *Environment // class namespace, enclosed by the defining scope
+	Bases []*Class
+
+	// MRO is the method resolution order: the class itself followed
+	// by its ancestors in the order attributes are looked up.
+	MRO []*Class
 
 	dict map[string]Object
 }
@@ -23,7 +28,8 @@ func NewClass(
 
 	cls.Name = name
 	cls.Body = body
-	cls.Env = env
+	cls.Env = NewEnclosedEnvironment(env)
+	cls.MRO = []*Class{cls}
 	cls.dict = make(map[string]Object)
 
 	cls.initialize()
@@ -33,9 +39,80 @@ func NewClass(
 
 func (c *Class) initialize() {
 	// initialize attributes
-	c.Env.Set(MAGIC_ATTR_NAME, NewString(c.Name.Value))
+	c.Env.Define(MAGIC_ATTR_NAME, NewString(c.Name.Value))
 	// TODO: add doc string parsing
-	c.Env.Set(MAGIC_ATTR_DOC, NewString(""))
+	c.Env.Define(MAGIC_ATTR_DOC, NewString(""))
+	// methods find the class they were defined in through __class__,
+	// which is what super() needs
+	c.Env.Define(MAGIC_ATTR_CLASS, c)
+}
+
+// SetBases makes c inherit from bases and computes its MRO with the C3
+// linearization Python uses. It fails when the bases cannot be ordered
+// consistently, e.g. when a class is listed before its own subclass.
+func (c *Class) SetBases(bases ...*Class) *Error {
+	seqs := [][]*Class{}
+	for _, base := range bases {
+		seqs = append(seqs, base.MRO)
+	}
+	seqs = append(seqs, bases)
+
+	mro, ok := c3Merge(seqs)
+	if !ok {
+		return NewError(TypeError,
+			"cannot create a consistent method resolution order for %s", c.Name.Value)
+	}
+
+	c.Bases = bases
+	c.MRO = append([]*Class{c}, mro...)
+	return nil
+}
+
+// c3Merge merges the linearizations in seqs, always taking the first head
+// that does not appear in the tail of any sequence.
+func c3Merge(seqs [][]*Class) ([]*Class, bool) {
+	result := []*Class{}
+	for {
+		nonEmpty := [][]*Class{}
+		for _, seq := range seqs {
+			if len(seq) > 0 {
+				nonEmpty = append(nonEmpty, seq)
+			}
+		}
+		if len(nonEmpty) == 0 {
+			return result, true
+		}
+		seqs = nonEmpty
+
+		var head *Class
+		for _, seq := range seqs {
+			if !inTail(seq[0], seqs) {
+				head = seq[0]
+				break
+			}
+		}
+		if head == nil {
+			return nil, false
+		}
+
+		result = append(result, head)
+		for i, seq := range seqs {
+			if seq[0] == head {
+				seqs[i] = seq[1:]
+			}
+		}
+	}
+}
+
+func inTail(cls *Class, seqs [][]*Class) bool {
+	for _, seq := range seqs {
+		for _, c := range seq[1:] {
+			if c == cls {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (c *Class) Type() ObjectType {
@@ -47,15 +124,33 @@ func (c *Class) SetAttr(key string, value Object) Object {
 	return NULL
 }
 func (c *Class) GetAttr(key string) Object {
-	v, ok := c.dict[key]
-	if !ok {
-		v, ok := c.Env.Get(key)
-		if !ok {
-			return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", c.Inspect(), key)}
-		}
+	if v, ok := c.lookup(key, 0); ok {
 		return v
 	}
-	return v
+	return attributeError(c, key)
+}
+
+// lookup searches the MRO of c for key, starting at index start.
+func (c *Class) lookup(key string, start int) (Object, bool) {
+	for _, cls := range c.MRO[start:] {
+		if v, ok := cls.dict[key]; ok {
+			return v, true
+		}
+		if v, ok := cls.Env.GetLocal(key); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// IsSubclass reports whether c is other or derives from it.
+func (c *Class) IsSubclass(other *Class) bool {
+	for _, cls := range c.MRO {
+		if cls == other {
+			return true
+		}
+	}
+	return false
 }
 
 func (c *Class) NewInstance(args ...Object) *Instance {
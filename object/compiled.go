@@ -0,0 +1,98 @@
+package object
+
+import (
+	"fmt"
+
+	"github.com/yushyn-andriy/firefly/code"
+)
+
+// CompiledFunction is the bytecode of a function literal. It is a constant
+// of the program; the VM turns it into a Closure when the literal runs.
+type CompiledFunction struct {
+	Instructions code.Instructions
+	SourceMap    code.SourceMap
+	Name         string // empty for anonymous functions
+
+	NumLocals     int
+	NumParameters int
+	// NumDefaults is the number of trailing parameters with a default
+	// value; the values themselves are computed when the closure is made.
+	NumDefaults int
+	Rest        bool // a rest parameter follows the others
+
+	// Method is set for functions defined in a class body. Calls through
+	// a bound method store the receiver in the local slot SelfIndex.
+	Method    bool
+	SelfIndex int
+
+	// LocalNames holds the names of the local slots, parameters first,
+	// and FreeNames those of the captured variables.
+	LocalNames []string
+	FreeNames  []string
+}
+
+// DisplayName returns the name the function is reported under.
+func (cf *CompiledFunction) DisplayName() string {
+	if cf.Name == "" {
+		return "<anonymous>"
+	}
+	return cf.Name
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("<compiled function %s>", cf.DisplayName())
+}
+func (cf *CompiledFunction) SetAttr(key string, value Object) Object {
+	return attributeError(cf, key)
+}
+func (cf *CompiledFunction) GetAttr(key string) Object {
+	return attributeError(cf, key)
+}
+
+// Closure is a compiled function together with the variables it captured
+// and the values of its default parameters.
+type Closure struct {
+	Fn       *CompiledFunction
+	Free     []*Cell
+	Defaults []Object
+
+	dict map[string]Object // attributes, such as __doc__
+}
+
+// Type is FUNCTION, as for the functions of the evaluator: programs do
+// not see how a function was run.
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("<function %s>", c.Fn.DisplayName())
+}
+func (c *Closure) SetAttr(key string, value Object) Object {
+	if c.dict == nil {
+		c.dict = make(map[string]Object)
+	}
+	c.dict[key] = value
+	return NULL
+}
+func (c *Closure) GetAttr(key string) Object {
+	v, ok := c.dict[key]
+	if !ok {
+		return attributeError(c, key)
+	}
+	return v
+}
+
+// Cell holds a variable captured by a closure. The variable's slot and
+// every closure that captured it share the cell, so assignments on
+// either side are seen by the other, as with environments.
+type Cell struct {
+	Value Object // nil while the variable is unset
+}
+
+func (c *Cell) Type() ObjectType { return CELL_OBJ }
+func (c *Cell) Inspect() string  { return fmt.Sprintf("<cell %p>", c) }
+func (c *Cell) SetAttr(key string, value Object) Object {
+	return attributeError(c, key)
+}
+func (c *Cell) GetAttr(key string) Object {
+	return attributeError(c, key)
+}
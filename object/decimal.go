@@ -0,0 +1,311 @@
+package object
+
+import (
+	"hash/fnv"
+	"math/big"
+	"strings"
+)
+
+// DecimalPrecision is the number of significant digits a decimal
+// division that does not come out exact is rounded to.
+const DecimalPrecision = 28
+
+// Decimal is an exact base 10 number, the integer Value divided by 10 to
+// the power of Scale. Decimals are made by the decimal builtin, and an
+// integer in an operation with a decimal is turned into one.
+//
+// Addition, subtraction, multiplication and comparisons are exact, and
+// so is division when the quotient has a finite expansion; otherwise it
+// is rounded half to even to DecimalPrecision significant digits. As
+// for integers, // rounds toward negative infinity and % takes the sign
+// of the divisor. The scale is kept, so 1.10 + 2.20 is 3.30.
+type Decimal struct {
+	Value *big.Int
+	Scale int // digits after the decimal point, never negative
+}
+
+// NewDecimal returns value / 10**scale.
+func NewDecimal(value *big.Int, scale int) Object {
+	if scale < 0 {
+		value = new(big.Int).Mul(value, pow10(-scale))
+		scale = 0
+	}
+	if value.BitLen() > MaxIntegerBits || scale > MaxIntegerBits {
+		return NewError(OverflowError, "decimal is too large")
+	}
+	return &Decimal{Value: value, Scale: scale}
+}
+
+// ParseDecimal parses a number like 12, -0.5 or 3.250.
+func ParseDecimal(s string) (*Decimal, bool) {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 {
+		return nil, false
+	}
+	scale := 0
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		scale = len(digits) - i - 1
+		digits = digits[:i] + digits[i+1:]
+	}
+	if digits == "" || len(digits) > MaxIntegerBits/4 || strings.Trim(digits, "0123456789") != "" {
+		return nil, false
+	}
+	value, _ := new(big.Int).SetString(digits, 10)
+	if strings.HasPrefix(s, "-") {
+		value.Neg(value)
+	}
+	return &Decimal{Value: value, Scale: scale}, true
+}
+
+func (d *Decimal) Type() ObjectType { return DECIMAL_OBJ }
+func (d *Decimal) Inspect() string {
+	s := new(big.Int).Abs(d.Value).String()
+	if d.Scale > 0 {
+		if len(s) <= d.Scale {
+			s = strings.Repeat("0", d.Scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.Scale] + "." + s[len(s)-d.Scale:]
+	}
+	if d.Value.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// HashKey makes equal numbers equal keys, whatever their scale and
+// whether they are decimals or integers.
+func (d *Decimal) HashKey() HashKey {
+	n := d.reduce()
+	if n.Scale == 0 {
+		if n.Value.IsInt64() {
+			return NewInteger(n.Value.Int64()).HashKey()
+		}
+		return bigHashKey(n.Value)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(n.Inspect()))
+
+	return HashKey{Type: d.Type(), Value: h.Sum64()}
+}
+
+func (d *Decimal) SetAttr(key string, value Object) Object {
+	return attributeError(d, key)
+}
+
+func (d *Decimal) GetAttr(key string) Object {
+	return attributeError(d, key)
+}
+
+// Neg returns -d.
+func (d *Decimal) Neg() Object {
+	return &Decimal{Value: new(big.Int).Neg(d.Value), Scale: d.Scale}
+}
+
+// Integer returns d truncated toward zero.
+func (d *Decimal) Integer() Object {
+	return NewBigInteger(new(big.Int).Quo(d.Value, pow10(d.Scale)))
+}
+
+// Float returns the float closest to d.
+func (d *Decimal) Float() float64 {
+	f, _, _ := big.ParseFloat(d.Inspect(), 10, 53, big.ToNearestEven)
+	v, _ := f.Float64()
+	return v
+}
+
+// Round returns d rounded half to even to places digits after the
+// decimal point.
+func (d *Decimal) Round(places int) *Decimal {
+	if places >= d.Scale {
+		return &Decimal{Value: new(big.Int).Mul(d.Value, pow10(places-d.Scale)), Scale: places}
+	}
+	return &Decimal{Value: roundQuo(d.Value, pow10(d.Scale-places)), Scale: places}
+}
+
+// reduce returns d without trailing zeros after the decimal point.
+func (d *Decimal) reduce() *Decimal {
+	value, scale := new(big.Int).Set(d.Value), d.Scale
+	ten, r := big.NewInt(10), new(big.Int)
+	for scale > 0 && value.Sign() != 0 {
+		q, _ := new(big.Int).QuoRem(value, ten, r)
+		if r.Sign() != 0 {
+			break
+		}
+		value, scale = q, scale-1
+	}
+	if value.Sign() == 0 {
+		scale = 0
+	}
+	return &Decimal{Value: value, Scale: scale}
+}
+
+// toDecimal returns an Integer, BigInteger or Decimal as a Decimal.
+func toDecimal(obj Object) (*Decimal, bool) {
+	switch obj := obj.(type) {
+	case *Decimal:
+		return obj, true
+	case *Integer:
+		return &Decimal{Value: big.NewInt(obj.Value)}, true
+	case *BigInteger:
+		return &Decimal{Value: obj.Value}, true
+	}
+	return nil, false
+}
+
+// align returns the values of a and b at the larger of their scales.
+func align(a, b *Decimal) (x, y *big.Int, scale int) {
+	switch {
+	case a.Scale < b.Scale:
+		return new(big.Int).Mul(a.Value, pow10(b.Scale-a.Scale)), b.Value, b.Scale
+	case a.Scale > b.Scale:
+		return a.Value, new(big.Int).Mul(b.Value, pow10(a.Scale-b.Scale)), a.Scale
+	}
+	return a.Value, b.Value, a.Scale
+}
+
+// decimalOperation returns a operator b, or nil for an unknown operator.
+func decimalOperation(operator string, a, b *Decimal) Object {
+	switch operator {
+	case "*":
+		if a.Value.BitLen()+b.Value.BitLen() > MaxIntegerBits+1 {
+			return NewError(OverflowError, "decimal is too large")
+		}
+		return NewDecimal(new(big.Int).Mul(a.Value, b.Value), a.Scale+b.Scale)
+	case "/":
+		if b.Value.Sign() == 0 {
+			return NewError(ZeroDivisionError, "decimal division by zero")
+		}
+		return decimalDiv(a, b)
+	case "**":
+		return decimalPow(a, b)
+	}
+
+	x, y, scale := align(a, b)
+	switch operator {
+	case "+":
+		return NewDecimal(new(big.Int).Add(x, y), scale)
+	case "-":
+		return NewDecimal(new(big.Int).Sub(x, y), scale)
+	case "//":
+		if y.Sign() == 0 {
+			return NewError(ZeroDivisionError, "decimal floor division by zero")
+		}
+		return NewDecimal(bigFloorDiv(x, y), 0)
+	case "%":
+		if y.Sign() == 0 {
+			return NewError(ZeroDivisionError, "decimal modulo by zero")
+		}
+		return NewDecimal(bigMod(x, y), scale)
+	case "<":
+		return nativeBool(x.Cmp(y) < 0)
+	case ">":
+		return nativeBool(x.Cmp(y) > 0)
+	case "<=":
+		return nativeBool(x.Cmp(y) <= 0)
+	case ">=":
+		return nativeBool(x.Cmp(y) >= 0)
+	case "==":
+		return nativeBool(x.Cmp(y) == 0)
+	case "!=":
+		return nativeBool(x.Cmp(y) != 0)
+	}
+	return nil
+}
+
+// decimalDiv returns a / b for b other than zero. An exact quotient
+// keeps no more digits after the point than it needs or than a has
+// beyond b, so 1.00 / 4 is 0.25 and 6.0 / 2 is 3.0.
+func decimalDiv(a, b *Decimal) Object {
+	// enough digits for the precision and one more to round with
+	shift := DecimalPrecision + numDigits(b.Value) - numDigits(a.Value) + 1
+	if shift < 0 {
+		shift = 0
+	}
+	num := new(big.Int).Mul(new(big.Int).Abs(a.Value), pow10(shift))
+	den := new(big.Int).Abs(b.Value)
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	scale := a.Scale - b.Scale + shift
+
+	if r.Sign() == 0 {
+		ideal := a.Scale - b.Scale
+		ten, m := big.NewInt(10), new(big.Int)
+		for scale > ideal && scale > 0 && q.Sign() != 0 {
+			q10, _ := new(big.Int).QuoRem(q, ten, m)
+			if m.Sign() != 0 {
+				break
+			}
+			q, scale = q10, scale-1
+		}
+		if q.Sign() == 0 {
+			scale = ideal
+		}
+	} else if extra := numDigits(q) - DecimalPrecision; extra > 0 {
+		// r is not zero, so a tie in the dropped digits is really above
+		// the half and rounds up
+		unit := pow10(extra)
+		dropped := new(big.Int)
+		q.QuoRem(q, unit, dropped)
+		if dropped.Lsh(dropped, 1).Cmp(unit) >= 0 {
+			q.Add(q, big.NewInt(1))
+		}
+		scale -= extra
+	}
+
+	if a.Value.Sign() != b.Value.Sign() {
+		q.Neg(q)
+	}
+	return NewDecimal(q, scale)
+}
+
+func decimalPow(a, b *Decimal) Object {
+	n := b.reduce()
+	if n.Scale != 0 {
+		return NewError(ValueError, "decimal can only be raised to an integer power")
+	}
+	if n.Value.Sign() < 0 {
+		p := decimalPow(a, &Decimal{Value: new(big.Int).Neg(n.Value)})
+		if p, ok := p.(*Decimal); ok {
+			return decimalOperation("/", &Decimal{Value: big.NewInt(1)}, p)
+		}
+		return p
+	}
+	// as for integers, -1, 0 and 1 stay small whatever the exponent
+	if a.Scale == 0 && a.Value.CmpAbs(big.NewInt(1)) <= 0 {
+		if n.Value.Sign() == 0 || (a.Value.Sign() < 0 && n.Value.Bit(0) == 0) {
+			return &Decimal{Value: big.NewInt(1)}
+		}
+		return a
+	}
+	if !n.Value.IsInt64() || n.Value.Int64() > MaxIntegerBits ||
+		int64(a.Value.BitLen()-1)*n.Value.Int64() > MaxIntegerBits ||
+		int64(a.Scale)*n.Value.Int64() > MaxIntegerBits {
+		return NewError(OverflowError, "decimal is too large")
+	}
+	return NewDecimal(new(big.Int).Exp(a.Value, n.Value, nil), a.Scale*int(n.Value.Int64()))
+}
+
+// roundQuo returns x / y rounded half to even, for y > 0.
+func roundQuo(x, y *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+	switch c := new(big.Int).Lsh(new(big.Int).Abs(r), 1).Cmp(y); {
+	case c > 0, c == 0 && q.Bit(0) == 1:
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func numDigits(v *big.Int) int {
+	if v.Sign() == 0 {
+		return 1
+	}
+	return len(new(big.Int).Abs(v).String())
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
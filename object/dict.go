@@ -1,10 +1,6 @@
 package object
 
-import (
-	"bytes"
-	"fmt"
-	"strings"
-)
+import "sort"
 
 type HashPair struct {
 	Key   Object
@@ -21,21 +17,52 @@ type Hash struct {
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
-func (h *Hash) Inspect() string {
-	var out bytes.Buffer
-	pairs := []string{}
+func (h *Hash) Inspect() string  { return inspectNested(h, map[Object]bool{}) }
+
+// Iter yields the keys of the hash.
+func (h *Hash) Iter() *Iterator {
+	pairs := h.sortedPairs()
+	keys := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		keys[i] = pair.Key
+	}
+	return sliceIterator(keys)
+}
+
+// Items yields the [key, value] pairs of the hash as arrays.
+func (h *Hash) Items() *Iterator {
+	pairs := h.sortedPairs()
+	items := make([]Object, len(pairs))
+	for i, pair := range pairs {
+		items[i] = NewArray([]Object{pair.Key, pair.Value})
+	}
+	return sliceIterator(items)
+}
+
+// sortedPairs returns the pairs ordered by key so that
+// iterating over a hash is deterministic.
+func (h *Hash) sortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
 	for _, pair := range h.Pairs {
-		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			pair.Key.Inspect(), pair.Value.Inspect()))
+		pairs = append(pairs, pair)
 	}
-	out.WriteString("{")
-	out.WriteString(strings.Join(pairs, ", "))
-	out.WriteString("}")
-	return out.String()
+	sort.Slice(pairs, func(i, j int) bool {
+		a, b := pairs[i].Key, pairs[j].Key
+		if a.Type() != b.Type() {
+			return a.Type() < b.Type()
+		}
+		if x, ok := bigValue(a); ok {
+			y, _ := bigValue(b)
+			return x.Cmp(y) < 0
+		}
+		return a.Inspect() < b.Inspect()
+	})
+	return pairs
 }
+
 func (h *Hash) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", h.Inspect(), key)}
+	return attributeError(h, key)
 }
 func (h *Hash) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", h.Inspect(), key)}
+	return attributeError(h, key)
 }
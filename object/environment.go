@@ -1,15 +1,37 @@
 package object
 
-import "fmt"
-
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s, outer: nil}
+	return &Environment{store: s, outer: nil, calls: new(int), importing: map[string]bool{}}
 }
 
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	if outer != nil {
+		env.calls = outer.calls
+		env.importing = outer.importing
+	}
+
+	return env
+}
+
+// NewCallEnvironment returns the environment of a call of a function
+// defined in outer.
+func NewCallEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.call = true
+
+	return env
+}
+
+// NewModuleEnvironment returns the top level environment of a module
+// imported by code running in e. It sees none of the bindings of e but
+// counts calls and imports together with it.
+func (e *Environment) NewModuleEnvironment() *Environment {
+	env := NewEnvironment()
+	env.calls = e.calls
+	env.importing = e.importing
 
 	return env
 }
@@ -17,6 +39,58 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// calls is the number of function calls in progress, shared by the
+	// environments of one evaluation
+	calls *int
+	// importing holds the modules being imported, to stop import cycles
+	importing map[string]bool
+	// call is set for the environment of a function call, as opposed to
+	// that of a loop or a module
+	call bool
+}
+
+// Function returns the environment of the innermost function call e is
+// part of, or nil at the top level.
+func (e *Environment) Function() *Environment {
+	for curr := e; curr != nil; curr = curr.outer {
+		if curr.call {
+			return curr
+		}
+	}
+	return nil
+}
+
+// EnterCall counts a call of a function defined in e and reports true,
+// unless max calls are in progress already. A counted call must be
+// ended with LeaveCall.
+func (e *Environment) EnterCall(max int) bool {
+	if *e.calls >= max {
+		return false
+	}
+	*e.calls++
+	return true
+}
+
+// LeaveCall ends a call counted by EnterCall.
+func (e *Environment) LeaveCall() {
+	*e.calls--
+}
+
+// EnterImport records that the module name is being imported and reports
+// true, unless it is being imported already, which makes an import cycle.
+// A recorded import must be ended with LeaveImport.
+func (e *Environment) EnterImport(name string) bool {
+	if e.importing[name] {
+		return false
+	}
+	e.importing[name] = true
+	return true
+}
+
+// LeaveImport ends an import recorded by EnterImport.
+func (e *Environment) LeaveImport(name string) {
+	delete(e.importing, name)
 }
 
 func (e *Environment) ToHash() *Hash {
@@ -45,6 +119,21 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// GetLocal looks name up in e only, ignoring enclosing environments.
+func (e *Environment) GetLocal(name string) (Object, bool) {
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
+// Define binds name in e itself, shadowing any binding in an
+// enclosing environment.
+func (e *Environment) Define(name string, val Object) Object {
+	e.store[name] = val
+	return val
+}
+
+// Set rebinds name in the nearest environment that already defines it,
+// or defines it in e otherwise.
 func (e *Environment) Set(name string, val Object) Object {
 	// e.store[name] = val
 
@@ -67,8 +156,8 @@ func (e *Environment) Set(name string, val Object) Object {
 }
 
 func (e *Environment) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", e.Inspect(), key)}
+	return attributeError(e, key)
 }
 func (e *Environment) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", e.Inspect(), key)}
+	return attributeError(e, key)
 }
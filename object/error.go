@@ -1,20 +1,153 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+// Frame is one entry of an error's call stack.
+type Frame struct {
+	Function string         // name of the called function
+	Class    string         // class of the receiver for methods, empty otherwise
+	Pos      token.Position // where the function was called
+}
+
+func (f Frame) Name() string {
+	if f.Class != "" {
+		return f.Class + "." + f.Function
+	}
+	return f.Function
+}
 
 type Error struct {
-	Message string
+	Class    *Class // exception class, ExceptionClass if nil
+	Message  string
+	Instance *Instance      // the thrown object for user-defined exceptions
+	Pos      token.Position // where the error was raised, if known
+
+	// Stack holds the calls the error unwound through, innermost first.
+	Stack []Frame
+}
+
+func NewError(cls *Class, format string, a ...interface{}) *Error {
+	return &Error{Class: cls, Message: fmt.Sprintf(format, a...)}
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.TypeName() + ": " + e.Message
+	}
+	return "ERROR: " + e.TypeName() + ": " + e.Message
+}
+
+// Error lets the VM return an Error as a Go error.
+func (e *Error) Error() string { return e.TypeName() + ": " + e.Message }
+
 func (e *Error) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", e.Inspect(), key)}
+	return attributeError(e, key)
 }
 func (e *Error) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", e.Inspect(), key)}
+	switch key {
+	case "message":
+		return NewString(e.Message)
+	case "type":
+		return NewString(e.TypeName())
+	case "trace":
+		return e.trace()
+	}
+	return attributeError(e, key)
+}
+
+func (e *Error) class() *Class {
+	if e.Class == nil {
+		return ExceptionClass
+	}
+	return e.Class
+}
+
+// TypeName returns the name of the exception class of e.
+func (e *Error) TypeName() string {
+	return e.class().Name.Value
+}
+
+// IsInstance reports whether e belongs to cls or one of its subclasses.
+func (e *Error) IsInstance(cls *Class) bool {
+	return e.class().IsSubclass(cls)
+}
+
+// AddFrame records that the error left the function described by f.
+func (e *Error) AddFrame(f Frame) {
+	e.Stack = append(e.Stack, f)
+}
+
+// PlaceFrame sets where the call of the outermost recorded frame was
+// made, unless that is known already.
+func (e *Error) PlaceFrame(pos token.Position) {
+	if n := len(e.Stack); n > 0 && !e.Stack[n-1].Pos.IsValid() {
+		e.Stack[n-1].Pos = pos
+	}
+}
+
+// Traceback formats the error and its call stack the way Python does,
+// most recent call last.
+func (e *Error) Traceback() string {
+	var out bytes.Buffer
+
+	out.WriteString("Traceback (most recent call last):\n")
+	lines := e.traceLines()
+	for i := 0; i < len(lines); {
+		// like Python, a run of identical lines left by deep recursion
+		// is shown three times and then counted
+		n := 1
+		for i+n < len(lines) && lines[i+n] == lines[i] {
+			n++
+		}
+		for j := 0; j < n && j < 3; j++ {
+			out.WriteString("  " + lines[i] + "\n")
+		}
+		if n > 3 {
+			out.WriteString(fmt.Sprintf("  [Previous line repeated %d more times]\n", n-3))
+		}
+		i += n
+	}
+	out.WriteString(e.TypeName() + ": " + e.Message + "\n")
+
+	return out.String()
+}
+
+func (e *Error) trace() *Array {
+	lines := e.traceLines()
+	elements := make([]Object, len(lines))
+	for i, line := range lines {
+		elements[i] = NewString(line)
+	}
+	return NewArray(elements)
+}
+
+// traceLines returns one line per frame, outermost first. Every frame
+// reports where execution was inside that function: the call site of the
+// next frame, or the error position for the innermost one.
+func (e *Error) traceLines() []string {
+	lines := []string{}
+
+	scope := "<module>"
+	for i := len(e.Stack) - 1; i >= 0; i-- {
+		lines = append(lines, formatTraceLine(e.Stack[i].Pos, scope))
+		scope = e.Stack[i].Name()
+	}
+	lines = append(lines, formatTraceLine(e.Pos, scope))
+
+	return lines
 }
 
-func newError(format string, a ...interface{}) *Error {
-	return &Error{Message: fmt.Sprintf(format, a...)}
+func formatTraceLine(pos token.Position, scope string) string {
+	filename := pos.Filename
+	if filename == "" {
+		filename = "<stdin>"
+	}
+	return fmt.Sprintf("File %q, line %d, column %d, in %s",
+		filename, pos.Line, pos.Column, scope)
 }
@@ -0,0 +1,210 @@
+package object
+
+import (
+	"fmt"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+// Built-in exception classes. Every Error raised by the interpreter
+// belongs to one of them; scripts may subclass them with class.
+var (
+	ExceptionClass *Class
+
+	ArithmeticError   *Class
+	ZeroDivisionError *Class
+	OverflowError     *Class
+
+	LookupError *Class
+	IndexError  *Class
+	KeyError    *Class
+
+	AttributeError *Class
+	ImportError    *Class
+	IOError        *Class
+	NameError      *Class
+	RuntimeError   *Class
+	RecursionError *Class
+	StopIteration  *Class
+	TypeError      *Class
+	ValueError     *Class
+)
+
+// Exceptions lists the built-in exception classes in a stable order.
+var Exceptions []*Class
+
+// The classes are built in init because their methods raise
+// errors of these very classes.
+func init() {
+	ExceptionClass = newExceptionClass("Exception", nil)
+
+	ArithmeticError = newExceptionClass("ArithmeticError", ExceptionClass)
+	ZeroDivisionError = newExceptionClass("ZeroDivisionError", ArithmeticError)
+	OverflowError = newExceptionClass("OverflowError", ArithmeticError)
+
+	LookupError = newExceptionClass("LookupError", ExceptionClass)
+	IndexError = newExceptionClass("IndexError", LookupError)
+	KeyError = newExceptionClass("KeyError", LookupError)
+
+	AttributeError = newExceptionClass("AttributeError", ExceptionClass)
+	ImportError = newExceptionClass("ImportError", ExceptionClass)
+	IOError = newExceptionClass("IOError", ExceptionClass)
+	NameError = newExceptionClass("NameError", ExceptionClass)
+	RuntimeError = newExceptionClass("RuntimeError", ExceptionClass)
+	RecursionError = newExceptionClass("RecursionError", RuntimeError)
+	StopIteration = newExceptionClass("StopIteration", ExceptionClass)
+	TypeError = newExceptionClass("TypeError", ExceptionClass)
+	ValueError = newExceptionClass("ValueError", ExceptionClass)
+
+	Exceptions = []*Class{
+		ExceptionClass,
+		ArithmeticError,
+		ZeroDivisionError,
+		OverflowError,
+		LookupError,
+		IndexError,
+		KeyError,
+		AttributeError,
+		ImportError,
+		IOError,
+		NameError,
+		RuntimeError,
+		RecursionError,
+		StopIteration,
+		TypeError,
+		ValueError,
+	}
+
+	ExceptionClass.Env.Define(MAGIC_METHOD_INIT, &Builtin{
+		Name: MAGIC_METHOD_INIT,
+		Fn:   exceptionInit,
+		Doc: `__init__(self, message)
+store the message of the exception
+`,
+	})
+}
+
+// LookupException returns the built-in exception class called name.
+func LookupException(name string) (*Class, bool) {
+	for _, cls := range Exceptions {
+		if cls.Name.Value == name {
+			return cls, true
+		}
+	}
+	return nil, false
+}
+
+func newExceptionClass(name string, parent *Class) *Class {
+	ident := &ast.Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: name},
+		Value: name,
+	}
+	cls := NewClass(ident, nil, nil)
+	if parent != nil {
+		cls.SetBases(parent)
+	}
+	return cls
+}
+
+func exceptionInit(env Env, args ...Object) Object {
+	if len(args) < 1 || len(args) > 2 {
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0..1",
+			len(args)-1)
+	}
+
+	message := NewString("")
+	if len(args) == 2 {
+		if s, ok := args[1].(*String); ok {
+			message = s
+		} else {
+			message = NewString(args[1].Inspect())
+		}
+	}
+
+	return args[0].SetAttr("message", message)
+}
+
+// Exception is the value a caught error is bound to in a catch clause.
+// Unlike Error it does not propagate on its own; throwing it again
+// re-raises the wrapped error.
+type Exception struct {
+	Err *Error
+}
+
+func NewException(err *Error) *Exception {
+	return &Exception{Err: err}
+}
+
+func (e *Exception) Type() ObjectType { return EXCEPTION_OBJ }
+func (e *Exception) Inspect() string {
+	return fmt.Sprintf("%s: %s", e.Err.TypeName(), e.Err.Message)
+}
+
+// SetAttr and GetAttr reach the instance that was thrown, if any,
+// so user-defined exception classes keep their attributes and methods.
+func (e *Exception) SetAttr(key string, value Object) Object {
+	if e.Err.Instance != nil {
+		return e.Err.Instance.SetAttr(key, value)
+	}
+	return attributeError(e, key)
+}
+func (e *Exception) GetAttr(key string) Object {
+	switch key {
+	case "message", "type", "trace":
+		return e.Err.GetAttr(key)
+	}
+	if e.Err.Instance != nil {
+		return e.Err.Instance.GetAttr(key)
+	}
+	return attributeError(e, key)
+}
+
+// Throw returns the error that throwing val raises. Exceptions re-raise
+// the error they were caught as, instances and subclasses of Exception
+// raise themselves and any other value becomes the message of a plain
+// Exception.
+func Throw(val Object) *Error {
+	switch val := val.(type) {
+	case *Error:
+		return val
+	case *Exception:
+		return val.Err
+	case *Instance:
+		if !val.Class().IsSubclass(ExceptionClass) {
+			break
+		}
+		message := ""
+		switch msg := val.GetAttr("message").(type) {
+		case *String:
+			message = msg.Value
+		case *Error:
+		default:
+			message = msg.Inspect()
+		}
+		return &Error{Class: val.Class(), Message: message, Instance: val}
+	case *Class:
+		if !val.IsSubclass(ExceptionClass) {
+			break
+		}
+		return NewError(val, "")
+	case *String:
+		return NewError(ExceptionClass, "%s", val.Value)
+	}
+	return NewError(ExceptionClass, "%s", val.Inspect())
+}
+
+// attributeError reports that obj has no attribute key.
+func attributeError(obj Object, key string) *Error {
+	switch obj := obj.(type) {
+	case *Class:
+		return NewError(AttributeError, "type object '%s' has no attribute '%s'",
+			obj.Name.Value, key)
+	case *Instance:
+		return NewError(AttributeError, "'%s' object has no attribute '%s'",
+			obj.Class().Name.Value, key)
+	default:
+		return NewError(AttributeError, "'%s' object has no attribute '%s'",
+			obj.Type(), key)
+	}
+}
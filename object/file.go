@@ -1,17 +1,20 @@
 package object
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
 )
 
 type File struct {
-	dict map[string]Object
-	file *os.File
-	path string
-	mode string
+	dict   map[string]Object
+	file   *os.File
+	reader *bufio.Reader // created on first iteration
+	path   string
+	mode   string
 }
 
 func NewFile(path string, mode string) *File {
@@ -27,6 +30,7 @@ func NewFile(path string, mode string) *File {
 
 func (f *File) initialize() {
 	f.dict["open"] = &Builtin{
+		Name: "open",
 		Fn:   fileOpen,
 		Env:  nil,
 		Self: f,
@@ -35,6 +39,7 @@ open file in read/write file mode
 `,
 	}
 	f.dict["close"] = &Builtin{
+		Name: "close",
 		Fn:   fileClose,
 		Env:  nil,
 		Self: f,
@@ -42,6 +47,7 @@ open file in read/write file mode
 `,
 	}
 	f.dict["read"] = &Builtin{
+		Name: "read",
 		Fn:   fileRead,
 		Env:  nil,
 		Self: f,
@@ -49,6 +55,7 @@ open file in read/write file mode
 `,
 	}
 	f.dict["write"] = &Builtin{
+		Name: "write",
 		Fn:   fileWrite,
 		Env:  nil,
 		Self: f,
@@ -60,24 +67,47 @@ open file in read/write file mode
 func (f *File) Type() ObjectType { return FILE_OBJ }
 func (f *File) Inspect() string  { return fmt.Sprintf("%#v", f) }
 func (f *File) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", f.Inspect(), key)}
+	return attributeError(f, key)
 }
 func (f *File) GetAttr(key string) Object {
 	if val, ok := f.dict[key]; ok {
 		return val
 	}
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", f.Inspect(), key)}
+	return attributeError(f, key)
 }
 
-func fileOpen(env *Environment, args ...Object) Object {
+// Iter yields the lines of an opened file without their line endings.
+func (f *File) Iter() *Iterator {
+	return NewIterator(func() (Object, bool) {
+		if f.file == nil {
+			return NewError(IOError, "%s", "cannot read from not opened file"), true
+		}
+		if f.reader == nil {
+			f.reader = bufio.NewReader(f.file)
+		}
+
+		line, err := f.reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil, false
+		}
+		if err != nil && err != io.EOF {
+			return NewError(IOError, "%s", err), true
+		}
+		line = strings.TrimSuffix(line, "\n")
+		line = strings.TrimSuffix(line, "\r")
+		return NewString(line), true
+	})
+}
+
+func fileOpen(env Env, args ...Object) Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args)-1)
 	}
 
 	self, ok := args[0].(*File)
 	if !ok {
-		return newError("%s", "cannot convert to type File")
+		return NewError(TypeError, "%s", "cannot convert to type File")
 	}
 
 	var flag int = os.O_APPEND | os.O_CREATE
@@ -87,90 +117,90 @@ func fileOpen(env *Environment, args ...Object) Object {
 	case "r":
 		flag = flag | os.O_RDONLY
 	default:
-		return newError("undefined mode '%s'", self.mode)
+		return NewError(ValueError, "undefined mode '%s'", self.mode)
 	}
 
 	file, err := os.OpenFile(self.path, flag, 0777)
 	if err != nil {
-		return newError("%s", err)
+		return NewError(IOError, "%s", err)
 	}
 	self.file = file
 
 	return self
 }
 
-func fileClose(env *Environment, args ...Object) Object {
+func fileClose(env Env, args ...Object) Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args)-1)
 	}
 
 	self, ok := args[0].(*File)
 	if !ok {
-		return newError("%s", "cannot convert to type File")
+		return NewError(TypeError, "%s", "cannot convert to type File")
 	}
 
 	if self.file == nil {
-		return newError("%s", "cannot close not opened file")
+		return NewError(IOError, "%s", "cannot close not opened file")
 	}
 
 	err := self.file.Close()
 	if err != nil {
 		log.Printf("error while closing the file. %v", err)
-		return newError("%s", err)
+		return NewError(IOError, "%s", err)
 	}
 	return NewNull()
 }
 
-func fileRead(env *Environment, args ...Object) Object {
+func fileRead(env Env, args ...Object) Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args)-1)
 	}
 
 	self, ok := args[0].(*File)
 	if !ok {
-		return newError("%s", "cannot convert to type File")
+		return NewError(TypeError, "%s", "cannot convert to type File")
 	}
 
 	if self.file == nil {
-		return newError("%s", "cannot read from not opened file")
+		return NewError(IOError, "%s", "cannot read from not opened file")
 	}
 
 	info, err := self.file.Stat()
 	if err != nil {
-		return newError("%s", err)
+		return NewError(IOError, "%s", err)
 	}
 
 	buffer := make([]byte, info.Size())
 	_, err = self.file.Read(buffer)
 	if err != nil {
-		return newError("%s", err)
+		return NewError(IOError, "%s", err)
 	}
 
 	return NewString(string(buffer))
 }
 
-func fileWrite(env *Environment, args ...Object) Object {
+func fileWrite(env Env, args ...Object) Object {
 	if len(args) != 2 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=1",
+			len(args)-1)
 	}
 
 	self, ok := args[0].(*File)
 	if !ok {
-		return newError("%s", "cannot convert to type File")
+		return NewError(TypeError, "%s", "cannot convert to type File")
 	}
 
 	obj := args[1]
 	if self.file == nil {
-		return newError("%s", "cannot write to not opened file")
+		return NewError(IOError, "%s", "cannot write to not opened file")
 	}
 
 	n, err := self.file.WriteString(
 		fmt.Sprint(strings.ReplaceAll(obj.Inspect(), "\\n", "\n")))
 	if err != nil {
-		return newError("%s", err)
+		return NewError(IOError, "%s", err)
 	}
 
 	return NewInteger(int64(n))
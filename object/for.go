@@ -2,17 +2,20 @@ package object
 
 import (
 	"bytes"
-	"fmt"
+	"strings"
 
 	"github.com/yushyn-andriy/firefly/ast"
 )
 
 type ForLoop struct {
-	Init *ast.AssignStatement
-	Cond ast.Expression
-	Post *ast.AssignStatement
+	Init ast.Statement  // may be nil
+	Cond ast.Expression // may be nil
+	Post ast.Statement  // may be nil
 	Body *ast.BlockStatement
 	Env  *Environment
+
+	Vars []*ast.Identifier // for-in loop variables
+	Iter ast.Expression    // for-in collection, nil for C-style loops
 }
 
 func (fl *ForLoop) Type() ObjectType { return FORLOOP_OBJ }
@@ -21,10 +24,28 @@ func (fl *ForLoop) Inspect() string {
 
 	out.WriteString("for")
 	out.WriteString("(")
-	out.WriteString(fl.Init.String())
-	out.WriteString(fl.Cond.String())
-	out.WriteString(";")
-	out.WriteString(fl.Post.String())
+	if fl.Iter != nil {
+		vars := []string{}
+		for _, v := range fl.Vars {
+			vars = append(vars, v.String())
+		}
+		out.WriteString(strings.Join(vars, ", "))
+		out.WriteString(" in ")
+		out.WriteString(fl.Iter.String())
+	} else {
+		if fl.Init != nil {
+			out.WriteString(fl.Init.String())
+		} else {
+			out.WriteString(";")
+		}
+		if fl.Cond != nil {
+			out.WriteString(fl.Cond.String())
+		}
+		out.WriteString(";")
+		if fl.Post != nil {
+			out.WriteString(fl.Post.String())
+		}
+	}
 	out.WriteString(")")
 	out.WriteString("{")
 	if fl.Body != nil {
@@ -35,9 +56,9 @@ func (fl *ForLoop) Inspect() string {
 	return out.String()
 }
 func (fl *ForLoop) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", fl.Inspect(), key)}
+	return attributeError(fl, key)
 }
 
 func (fl *ForLoop) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", fl.Inspect(), key)}
+	return attributeError(fl, key)
 }
@@ -2,7 +2,6 @@ package object
 
 import (
 	"bytes"
-	"fmt"
 	"strings"
 
 	"github.com/yushyn-andriy/firefly/ast"
@@ -12,9 +11,13 @@ type Function struct {
 	dict       map[string]Object
 	Name       *ast.Identifier
 	Parameters []*ast.Identifier
-	Body       *ast.BlockStatement
-	Env        *Environment
-	Self       Object
+	// Defaults holds the default value of each parameter, evaluated
+	// when the function was defined, and nil for required parameters.
+	Defaults []Object
+	Rest     *ast.Identifier // collects extra positional arguments
+	Body     *ast.BlockStatement
+	Source   string // the body as written, if the optimizer rewrote Body
+	Env      *Environment
 }
 
 func NewFunction(name *ast.Identifier, params []*ast.Identifier, env *Environment, body *ast.BlockStatement) *Function {
@@ -32,9 +35,16 @@ func (f *Function) Inspect() string {
 	var out bytes.Buffer
 
 	params := []string{}
-	for _, p := range f.Parameters {
+	for i, p := range f.Parameters {
+		if i < len(f.Defaults) && f.Defaults[i] != nil {
+			params = append(params, p.String()+" = "+f.Defaults[i].Inspect())
+			continue
+		}
 		params = append(params, p.String())
 	}
+	if f.Rest != nil {
+		params = append(params, "..."+f.Rest.String())
+	}
 
 	out.WriteString("fn")
 	if f.Name != nil {
@@ -44,7 +54,11 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	if f.Source != "" {
+		out.WriteString(f.Source)
+	} else {
+		out.WriteString(f.Body.String())
+	}
 	out.WriteString("\n}")
 
 	return out.String()
@@ -56,7 +70,7 @@ func (f *Function) SetAttr(key string, value Object) Object {
 func (f *Function) GetAttr(key string) Object {
 	v, ok := f.dict[key]
 	if !ok {
-		return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", f.Inspect(), key)}
+		return attributeError(f, key)
 	}
 	return v
 }
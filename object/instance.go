@@ -11,6 +11,9 @@ func (i *Instance) Type() ObjectType {
 	return INSTANCE
 }
 
+// Class returns the class i was created from.
+func (i *Instance) Class() *Class { return i.class }
+
 func (i *Instance) Len() Object {
 	flen, ok := i.class.dict[MAGIC_METHOD_LEN]
 	if !ok {
@@ -26,10 +29,26 @@ func (i *Instance) SetAttr(key string, value Object) Object {
 	return NULL
 }
 
+// GetAttr returns the attribute key of the instance. Methods found on
+// the class come back bound to the instance.
 func (i *Instance) GetAttr(key string) Object {
 	v, ok := i.dict[key]
 	if !ok {
-		return i.class.GetAttr(key)
+		return bindMethod(i.class.GetAttr(key), i)
 	}
 	return v
 }
+
+// LookupMethod returns the method name bound to obj if obj is an
+// instance whose class defines it.
+func LookupMethod(obj Object, name string) (Object, bool) {
+	inst, ok := obj.(*Instance)
+	if !ok {
+		return nil, false
+	}
+	fn := inst.GetAttr(name)
+	if _, ok := fn.(*Error); ok {
+		return nil, false
+	}
+	return fn, true
+}
@@ -17,9 +17,9 @@ func (i *Integer) HashKey() HashKey {
 }
 
 func (i *Integer) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", i.Inspect(), key)}
+	return attributeError(i, key)
 }
 
 func (i *Integer) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", i.Inspect(), key)}
+	return attributeError(i, key)
 }
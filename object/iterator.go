@@ -0,0 +1,88 @@
+package object
+
+// Iterable is implemented by the objects a for-in loop can walk over.
+type Iterable interface {
+	Iter() *Iterator
+}
+
+// Iterator yields the elements of a collection one at a time. The
+// element returned by Next may be an *Error, which ends the iteration
+// and should be propagated by the caller.
+type Iterator struct {
+	next func() (Object, bool)
+}
+
+func NewIterator(next func() (Object, bool)) *Iterator {
+	return &Iterator{next: next}
+}
+
+// Next returns the next element, or false once the iterator is exhausted.
+func (it *Iterator) Next() (Object, bool) {
+	return it.next()
+}
+
+// Iter makes an iterator iterable itself, so it can be passed
+// to a for-in loop directly.
+func (it *Iterator) Iter() *Iterator { return it }
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string  { return "<iterator>" }
+func (it *Iterator) SetAttr(key string, value Object) Object {
+	return attributeError(it, key)
+}
+func (it *Iterator) GetAttr(key string) Object {
+	return attributeError(it, key)
+}
+
+// sliceIterator iterates over a fixed list of elements.
+func sliceIterator(elements []Object) *Iterator {
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= len(elements) {
+			return nil, false
+		}
+		i++
+		return elements[i-1], true
+	})
+}
+
+// GetIterator returns an iterator over obj. Instances take part through
+// the __iter__ and __next__ magic methods, which call runs; __next__
+// signals the end by throwing StopIteration.
+func GetIterator(obj Object, call CallFunc) (*Iterator, *Error) {
+	switch obj := obj.(type) {
+	case Iterable:
+		return obj.Iter(), nil
+	case *Instance:
+		return instanceIterator(obj, call)
+	}
+	return nil, NewError(TypeError, "'%s' object is not iterable", obj.Type())
+}
+
+func instanceIterator(obj *Instance, call CallFunc) (*Iterator, *Error) {
+	iterFn, ok := LookupMethod(obj, MAGIC_METHOD_ITER)
+	if !ok {
+		return nil, NewError(TypeError, "'%s' object is not iterable", obj.Class().Name.Value)
+	}
+
+	res := call(iterFn)
+	switch res := res.(type) {
+	case *Error:
+		return nil, res
+	case Iterable:
+		return res.Iter(), nil
+	}
+
+	nextFn, ok := LookupMethod(res, MAGIC_METHOD_NEXT)
+	if !ok {
+		return nil, NewError(TypeError, "__iter__ returned non-iterator of type %s", res.Type())
+	}
+
+	return NewIterator(func() (Object, bool) {
+		next := call(nextFn)
+		if err, ok := next.(*Error); ok && err.IsInstance(StopIteration) {
+			return nil, false
+		}
+		return next, true
+	}), nil
+}
@@ -0,0 +1,33 @@
+package object
+
+import "github.com/yushyn-andriy/firefly/token"
+
+// Break and Continue unwind the statements of a loop body the same
+// way ReturnValue unwinds a function body.
+type Break struct {
+	Pos token.Position // of the break statement
+}
+
+func (b *Break) Type() ObjectType { return BREAK_OBJ }
+func (b *Break) Inspect() string  { return "break" }
+func (b *Break) SetAttr(key string, value Object) Object {
+	return attributeError(b, key)
+}
+
+func (b *Break) GetAttr(key string) Object {
+	return attributeError(b, key)
+}
+
+type Continue struct {
+	Pos token.Position // of the continue statement
+}
+
+func (c *Continue) Type() ObjectType { return CONTINUE_OBJ }
+func (c *Continue) Inspect() string  { return "continue" }
+func (c *Continue) SetAttr(key string, value Object) Object {
+	return attributeError(c, key)
+}
+
+func (c *Continue) GetAttr(key string) Object {
+	return attributeError(c, key)
+}
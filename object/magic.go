@@ -0,0 +1,147 @@
+package object
+
+// The operators of the language on instances, which overload them with
+// magic methods. Both engines call these with the function that runs
+// methods in them, and fall back to the operators on the built-in types.
+
+// infixMethods maps an operator to the magic method called on the left
+// operand and the reflected one tried on the right operand.
+var infixMethods = map[string][2]string{
+	"+":  {MAGIC_METHOD_ADD, MAGIC_METHOD_RADD},
+	"-":  {MAGIC_METHOD_SUB, MAGIC_METHOD_RSUB},
+	"*":  {MAGIC_METHOD_MUL, MAGIC_METHOD_RMUL},
+	"/":  {MAGIC_METHOD_DIV, MAGIC_METHOD_RDIV},
+	"==": {MAGIC_METHOD_EQ, MAGIC_METHOD_EQ},
+	"!=": {MAGIC_METHOD_NE, MAGIC_METHOD_NE},
+	"<":  {MAGIC_METHOD_LT, MAGIC_METHOD_GT},
+	">":  {MAGIC_METHOD_GT, MAGIC_METHOD_LT},
+	"<=": {MAGIC_METHOD_LE, MAGIC_METHOD_GE},
+	">=": {MAGIC_METHOD_GE, MAGIC_METHOD_LE},
+	"%":  {MAGIC_METHOD_MOD, MAGIC_METHOD_RMOD},
+	"**": {MAGIC_METHOD_POW, MAGIC_METHOD_RPOW},
+	"//": {MAGIC_METHOD_FLOORDIV, MAGIC_METHOD_RFLOORDIV},
+	"&":  {MAGIC_METHOD_AND, MAGIC_METHOD_RAND},
+	"|":  {MAGIC_METHOD_OR, MAGIC_METHOD_ROR},
+	"^":  {MAGIC_METHOD_XOR, MAGIC_METHOD_RXOR},
+	"<<": {MAGIC_METHOD_LSHIFT, MAGIC_METHOD_RLSHIFT},
+	">>": {MAGIC_METHOD_RSHIFT, MAGIC_METHOD_RRSHIFT},
+}
+
+// prefixMethods maps a prefix operator to the magic method it calls.
+var prefixMethods = map[string]string{
+	"-": MAGIC_METHOD_NEG,
+	"+": MAGIC_METHOD_POS,
+	"~": MAGIC_METHOD_INVERT,
+}
+
+// Infix returns left operator right.
+func Infix(operator string, left, right Object, call CallFunc) Object {
+	if left.Type() == INSTANCE || right.Type() == INSTANCE {
+		if res, ok := instanceInfix(operator, left, right, call); ok {
+			return res
+		}
+	}
+	return BinaryOperation(operator, left, right)
+}
+
+// instanceInfix dispatches operator to the magic methods of its operands.
+// It reports false when neither operand overloads it.
+func instanceInfix(operator string, left, right Object, call CallFunc) (Object, bool) {
+	names, ok := infixMethods[operator]
+	if !ok {
+		return nil, false
+	}
+
+	if fn, ok := LookupMethod(left, names[0]); ok {
+		return call(fn, right), true
+	}
+	if fn, ok := LookupMethod(right, names[1]); ok {
+		return call(fn, left), true
+	}
+
+	switch operator {
+	case "==":
+		return nativeBool(left == right), true
+	case "!=":
+		// without __ne__ the result is the negation of __eq__
+		if fn, ok := LookupMethod(left, MAGIC_METHOD_EQ); ok {
+			eq, err := Truth(call(fn, right), call)
+			if err != nil {
+				return err, true
+			}
+			return nativeBool(!eq), true
+		}
+		return nativeBool(left != right), true
+	}
+
+	return nil, false
+}
+
+// Prefix returns operator operand.
+func Prefix(operator string, operand Object, call CallFunc) Object {
+	if operator == "!" && operand.Type() == INSTANCE {
+		ok, err := Truth(operand, call)
+		if err != nil {
+			return err
+		}
+		return nativeBool(!ok)
+	}
+	if name, ok := prefixMethods[operator]; ok {
+		if fn, ok := LookupMethod(operand, name); ok {
+			return call(fn)
+		}
+	}
+	return UnaryOperation(operator, operand)
+}
+
+// Truth reports whether obj counts as true. Instances decide through
+// __bool__; errors raised by it are handed back to the caller, as is obj
+// if it is an error itself.
+func Truth(obj Object, call CallFunc) (bool, *Error) {
+	if err, ok := obj.(*Error); ok {
+		return false, err
+	}
+
+	fn, ok := LookupMethod(obj, MAGIC_METHOD_BOOL)
+	if !ok {
+		return IsTruthy(obj), nil
+	}
+
+	switch res := call(fn).(type) {
+	case *Error:
+		return false, res
+	case *Boolean:
+		return res.Value, nil
+	default:
+		return false, NewError(TypeError, "__bool__ should return BOOLEAN, returned %s",
+			res.Type())
+	}
+}
+
+// GetItem returns left[index]. Instances take part through __getitem__.
+func GetItem(left, index Object, call CallFunc) Object {
+	if inst, ok := left.(*Instance); ok {
+		if fn, ok := LookupMethod(inst, MAGIC_METHOD_GETITEM); ok {
+			return call(fn, index)
+		}
+		return NewError(TypeError, "'%s' object is not subscriptable", inst.Class().Name.Value)
+	}
+	return Index(left, index)
+}
+
+// SetItem sets left[index] to value and returns null, or the error that
+// stopped it. Instances take part through __setitem__, whose result is
+// returned.
+func SetItem(left, index, value Object, call CallFunc) Object {
+	if inst, ok := left.(*Instance); ok {
+		if fn, ok := LookupMethod(inst, MAGIC_METHOD_SETITEM); ok {
+			return call(fn, index, value)
+		}
+		return NewError(TypeError, "'%s' object does not support item assignment",
+			inst.Class().Name.Value)
+	}
+	if err := SetIndex(left, index, value); err != nil {
+		return err
+	}
+	return NULL
+}
@@ -0,0 +1,59 @@
+package object
+
+import "fmt"
+
+// BoundMethod is a function looked up through an instance, together with
+// that instance. Every lookup creates a new one, so the function itself
+// is never tied to a receiver.
+type BoundMethod struct {
+	Fn   Object // *Function, *Closure or *Builtin
+	Self Object
+}
+
+func NewBoundMethod(fn Object, self Object) *BoundMethod {
+	return &BoundMethod{Fn: fn, Self: self}
+}
+
+// Name returns the name of the wrapped function.
+func (bm *BoundMethod) Name() string {
+	switch fn := bm.Fn.(type) {
+	case *Function:
+		if fn.Name != nil {
+			return fn.Name.Value
+		}
+	case *Closure:
+		return fn.Fn.DisplayName()
+	}
+	return "<anonymous>"
+}
+
+func (bm *BoundMethod) Type() ObjectType { return BOUND_METHOD_OBJ }
+func (bm *BoundMethod) Inspect() string {
+	return fmt.Sprintf("<bound method %s of %s>", bm.Name(), bm.Self.Inspect())
+}
+func (bm *BoundMethod) SetAttr(key string, value Object) Object {
+	return attributeError(bm, key)
+}
+func (bm *BoundMethod) GetAttr(key string) Object {
+	switch key {
+	case "__func__":
+		return bm.Fn
+	case "__self__":
+		return bm.Self
+	}
+	return attributeError(bm, key)
+}
+
+// bindMethod binds attributes found on a class to self. Builtins that
+// already carry a receiver and other values are returned unchanged.
+func bindMethod(attr Object, self Object) Object {
+	switch attr := attr.(type) {
+	case *Function, *Closure:
+		return NewBoundMethod(attr, self)
+	case *Builtin:
+		if attr.Self == nil {
+			return NewBoundMethod(attr, self)
+		}
+	}
+	return attr
+}
@@ -12,6 +12,12 @@ type Module struct {
 	dict map[string]Object
 }
 
+// ImportPath returns the file that `import "name"` loads.
+func ImportPath(name string) string {
+	// find better way to do this
+	return "./lib/" + name + ".fl"
+}
+
 func NewModule(name *ast.StringLiteral, env *Environment) *Module {
 	m := new(Module)
 	m.Name = name
@@ -33,7 +39,7 @@ func (m *Module) GetAttr(key string) Object {
 	if !ok {
 		v, ok := m.Env.Get(key)
 		if !ok {
-			return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", m.Inspect(), key)}
+			return attributeError(m, key)
 		}
 		return v
 	}
@@ -1,7 +1,5 @@
 package object
 
-import "fmt"
-
 type Null struct {
 }
 
@@ -12,8 +10,8 @@ func NewNull() *Null {
 func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string  { return "null" }
 func (n *Null) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", n.Inspect(), key)}
+	return attributeError(n, key)
 }
 func (n *Null) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", n.Inspect(), key)}
+	return attributeError(n, key)
 }
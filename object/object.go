@@ -7,9 +7,13 @@ const (
 	INSTANCE         = "INSTANCE"
 	INTEGER_OBJ      = "INTEGER"
 	FLOAT_OBJ        = "FLOAT"
+	DECIMAL_OBJ      = "DECIMAL"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	ERROR_OBJ        = "ERROR"
+	EXCEPTION_OBJ    = "EXCEPTION"
 	FUNCTION_OBJ     = "FUNCTION"
 	STRING_OBJ       = "STRING"
 	BUILTIN_OBJ      = "BUILTIN"
@@ -19,6 +23,13 @@ const (
 	FORLOOP_OBJ      = "FORLOOP"
 	NULL_OBJ         = "NULL"
 	FILE_OBJ         = "FILE_OBJ"
+	ITERATOR_OBJ     = "ITERATOR"
+	RANGE_OBJ        = "RANGE"
+	SUPER_OBJ        = "SUPER"
+	BOUND_METHOD_OBJ = "BOUND_METHOD"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 // magic methods
@@ -27,12 +38,54 @@ const (
 	MAGIC_METHOD_LEN  = "__len__"
 	MAGIC_METHOD_REPR = "__repr__"
 	MAGIC_METHOD_STR  = "__str__"
+	MAGIC_METHOD_ITER = "__iter__"
+	MAGIC_METHOD_NEXT = "__next__"
+	MAGIC_METHOD_BOOL = "__bool__"
+
+	MAGIC_METHOD_ADD  = "__add__"
+	MAGIC_METHOD_SUB  = "__sub__"
+	MAGIC_METHOD_MUL  = "__mul__"
+	MAGIC_METHOD_DIV  = "__div__"
+	MAGIC_METHOD_RADD = "__radd__"
+	MAGIC_METHOD_RSUB = "__rsub__"
+	MAGIC_METHOD_RMUL = "__rmul__"
+	MAGIC_METHOD_RDIV = "__rdiv__"
+	MAGIC_METHOD_EQ   = "__eq__"
+	MAGIC_METHOD_NE   = "__ne__"
+	MAGIC_METHOD_LT   = "__lt__"
+	MAGIC_METHOD_GT   = "__gt__"
+	MAGIC_METHOD_NEG  = "__neg__"
+
+	MAGIC_METHOD_MOD       = "__mod__"
+	MAGIC_METHOD_POW       = "__pow__"
+	MAGIC_METHOD_FLOORDIV  = "__floordiv__"
+	MAGIC_METHOD_AND       = "__and__"
+	MAGIC_METHOD_OR        = "__or__"
+	MAGIC_METHOD_XOR       = "__xor__"
+	MAGIC_METHOD_LSHIFT    = "__lshift__"
+	MAGIC_METHOD_RSHIFT    = "__rshift__"
+	MAGIC_METHOD_RMOD      = "__rmod__"
+	MAGIC_METHOD_RPOW      = "__rpow__"
+	MAGIC_METHOD_RFLOORDIV = "__rfloordiv__"
+	MAGIC_METHOD_RAND      = "__rand__"
+	MAGIC_METHOD_ROR       = "__ror__"
+	MAGIC_METHOD_RXOR      = "__rxor__"
+	MAGIC_METHOD_RLSHIFT   = "__rlshift__"
+	MAGIC_METHOD_RRSHIFT   = "__rrshift__"
+	MAGIC_METHOD_LE        = "__le__"
+	MAGIC_METHOD_GE        = "__ge__"
+	MAGIC_METHOD_POS       = "__pos__"
+	MAGIC_METHOD_INVERT    = "__invert__"
+
+	MAGIC_METHOD_GETITEM = "__getitem__"
+	MAGIC_METHOD_SETITEM = "__setitem__"
 )
 
 // magic attributes
 const (
-	MAGIC_ATTR_NAME = "__name__"
-	MAGIC_ATTR_DOC  = "__doc__"
+	MAGIC_ATTR_NAME  = "__name__"
+	MAGIC_ATTR_DOC   = "__doc__"
+	MAGIC_ATTR_CLASS = "__class__"
 )
 
 var (
@@ -1,6 +1,13 @@
 package object
 
-import "testing"
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/token"
+)
 
 func TestStringHashKey(t *testing.T) {
 	hello1 := &String{Value: "Hello World"}
@@ -17,3 +24,194 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestDecimal(t *testing.T) {
+	parse := func(s string) *Decimal {
+		d, ok := ParseDecimal(s)
+		if !ok {
+			t.Fatalf("cannot parse %q", s)
+		}
+		return d
+	}
+
+	rounding := []struct {
+		input    string
+		places   int
+		expected string
+	}{
+		{"2.675", 2, "2.68"},
+		{"2.665", 2, "2.66"},
+		{"-2.675", 2, "-2.68"},
+		{"0.005", 2, "0.00"},
+		{"1.5", 0, "2"},
+		{"2.5", 0, "2"},
+		{"1.5", 3, "1.500"},
+	}
+	for _, tt := range rounding {
+		if got := parse(tt.input).Round(tt.places).Inspect(); got != tt.expected {
+			t.Errorf("%s rounded to %d places: expected %s, got %s", tt.input, tt.places, tt.expected, got)
+		}
+	}
+
+	for _, s := range []string{"", "-", ".", "1.2.3", "1e5", "--1", "0x10", "1 000"} {
+		if _, ok := ParseDecimal(s); ok {
+			t.Errorf("%q parsed as a decimal", s)
+		}
+	}
+
+	if parse("1.50").HashKey() != parse("1.5").HashKey() {
+		t.Errorf("1.50 and 1.5 have different hash keys")
+	}
+	if parse("2.00").HashKey() != NewInteger(2).HashKey() {
+		t.Errorf("2.00 and 2 have different hash keys")
+	}
+	n := NewBigInteger(new(big.Int).Lsh(big.NewInt(1), 70))
+	if parse(n.Inspect()+".0").HashKey() != n.(*BigInteger).HashKey() {
+		t.Errorf("a decimal and the big integer it equals have different hash keys")
+	}
+}
+
+func TestOperations(t *testing.T) {
+	tests := []struct {
+		result   Object
+		expected string
+	}{
+		{BinaryOperation("+", NewInteger(1), &Float{Value: 0.5}), "1.5"},
+		{BinaryOperation("*", NewString("ab"), NewInteger(2)), "abab"},
+		{BinaryOperation("*", NewInteger(2), NewString("ab")), "abab"},
+		{BinaryOperation("==", TRUE, FALSE), "false"},
+		{BinaryOperation("-", NewString("a"), NewString("b")), "ERROR: TypeError: unknown operator: STRING - STRING"},
+		{BinaryOperation("+", NewInteger(1), TRUE), "ERROR: TypeError: type mismatch: INTEGER + BOOLEAN"},
+		{UnaryOperation("-", NewInteger(3)), "-3"},
+		{UnaryOperation("!", NewString("")), "true"},
+		{UnaryOperation("~", &Float{Value: 1}), "ERROR: TypeError: unknown operator: ~FLOAT"},
+		{Index(NewString("héllo"), NewInteger(1)), "é"},
+		{Index(&Array{}, NewInteger(0)), "ERROR: IndexError: index out of range: 0"},
+	}
+
+	for i, tt := range tests {
+		if got := tt.result.Inspect(); got != tt.expected {
+			t.Errorf("tests[%d]: expected %q, got %q", i, tt.expected, got)
+		}
+	}
+
+	arr := &Array{Elements: []Object{NewInteger(1)}}
+	if err := SetIndex(arr, NewInteger(0), NewInteger(5)); err != nil || arr.Elements[0].Inspect() != "5" {
+		t.Errorf("SetIndex did not set the element: %v", err)
+	}
+	if err := SetIndex(NewString("a"), NewInteger(0), NewInteger(5)); err == nil {
+		t.Errorf("SetIndex on a string did not fail")
+	}
+}
+
+func TestRange(t *testing.T) {
+	tests := []struct {
+		r        *Range
+		expected []int64
+	}{
+		{NewRange(0, 4, 1), []int64{0, 1, 2, 3}},
+		{NewRange(2, 9, 3), []int64{2, 5, 8}},
+		{NewRange(5, 0, -2), []int64{5, 3, 1}},
+		{NewRange(3, 3, 1), []int64{}},
+		{NewRange(3, 0, 1), []int64{}},
+	}
+
+	for _, tt := range tests {
+		got := []int64{}
+		it := tt.r.Iter()
+		for obj, ok := it.Next(); ok; obj, ok = it.Next() {
+			got = append(got, obj.(*Integer).Value)
+		}
+
+		if len(got) != len(tt.expected) {
+			t.Fatalf("%s yields wrong values. want=%v, got=%v", tt.r.Inspect(), tt.expected, got)
+		}
+		for i := range got {
+			if got[i] != tt.expected[i] {
+				t.Fatalf("%s yields wrong values. want=%v, got=%v", tt.r.Inspect(), tt.expected, got)
+			}
+		}
+		if n := tt.r.Len().(*Integer).Value; n != int64(len(tt.expected)) {
+			t.Errorf("%s has wrong length. want=%d, got=%d", tt.r.Inspect(), len(tt.expected), n)
+		}
+	}
+}
+
+func TestClassMRO(t *testing.T) {
+	newClass := func(name string, bases ...*Class) *Class {
+		cls := NewClass(&ast.Identifier{Value: name}, nil, nil)
+		if err := cls.SetBases(bases...); err != nil {
+			t.Fatalf("SetBases(%s) failed: %s", name, err.Message)
+		}
+		return cls
+	}
+
+	o := newClass("O")
+	a := newClass("A", o)
+	b := newClass("B", o)
+	c := newClass("C", o)
+	d := newClass("D", o)
+	e := newClass("E", o)
+	k1 := newClass("K1", a, b, c)
+	k2 := newClass("K2", d, b, e)
+	k3 := newClass("K3", d, a)
+	z := newClass("Z", k1, k2, k3)
+
+	got := []string{}
+	for _, cls := range z.MRO {
+		got = append(got, cls.Name.Value)
+	}
+	expected := "Z K1 K2 K3 D A B C E O"
+	if strings.Join(got, " ") != expected {
+		t.Errorf("wrong MRO. want=%q, got=%q", expected, strings.Join(got, " "))
+	}
+
+	if !z.IsSubclass(o) || o.IsSubclass(z) {
+		t.Errorf("IsSubclass does not follow the MRO")
+	}
+}
+
+func TestTracebackRepeatedFrames(t *testing.T) {
+	err := NewError(RecursionError, "stack overflow")
+	err.Pos = token.Position{Line: 2, Column: 3}
+	for i := 0; i < 5; i++ {
+		err.AddFrame(Frame{Function: "f", Pos: token.Position{Line: 2, Column: 3}})
+	}
+
+	expected := `Traceback (most recent call last):
+  File "<stdin>", line 2, column 3, in <module>
+  File "<stdin>", line 2, column 3, in f
+  File "<stdin>", line 2, column 3, in f
+  File "<stdin>", line 2, column 3, in f
+  [Previous line repeated 2 more times]
+RecursionError: stack overflow
+`
+	if err.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, err.Traceback())
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	a := NewArray([]Object{&Integer{Value: 1}})
+	a.Elements = append(a.Elements, a)
+	h := &Hash{Pairs: map[HashKey]HashPair{}}
+	key := &Integer{Value: 1}
+	h.Pairs[key.HashKey()] = HashPair{Key: key, Value: h}
+	shared := NewArray(nil)
+
+	tests := []struct {
+		obj      Object
+		expected string
+	}{
+		{a, "[1, [...]]"},
+		{NewArray([]Object{a}), "[[1, [...]]]"},
+		{h, "{1: {...}}"},
+		{NewArray([]Object{shared, shared}), "[[], []]"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.obj.Inspect(); got != tt.expected {
+			t.Errorf("wrong inspection. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package object
+
+// The operators of the language on the built-in types. Both engines call
+// these, so that the same operands are accepted and the same errors are
+// raised by the evaluator and the VM. Instances that overload operators
+// with magic methods are left to the engines, which know how to call
+// them.
+
+// BinaryOperation returns left operator right.
+func BinaryOperation(operator string, left, right Object) Object {
+	if l, r, ok := PromoteToFloat(operator, left, right); ok {
+		return floatOperation(operator, l, r)
+	}
+	if result, ok := BigOperation(operator, left, right); ok {
+		return result
+	}
+
+	switch {
+	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
+		return integerOperation(operator, left, right)
+
+	case left.Type() == FLOAT_OBJ && right.Type() == FLOAT_OBJ:
+		return floatOperation(operator, left, right)
+
+	case left.Type() == INTEGER_OBJ && right.Type() == STRING_OBJ:
+		return stringIntegerOperation(operator, left, right)
+	case right.Type() == INTEGER_OBJ && left.Type() == STRING_OBJ:
+		return stringIntegerOperation(operator, right, left)
+
+	case operator == "==" && left.Type() == BOOLEAN_OBJ && right.Type() == BOOLEAN_OBJ:
+		return nativeBool(left == right)
+
+	case operator == "!=" && left.Type() == BOOLEAN_OBJ && right.Type() == BOOLEAN_OBJ:
+		return nativeBool(left != right)
+
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return stringOperation(operator, left, right)
+
+	case left.Type() != right.Type():
+		return NewError(TypeError, "type mismatch: %s %s %s",
+			left.Type(), operator, right.Type())
+
+	default:
+		return unknownOperator(operator, left, right)
+	}
+}
+
+func unknownOperator(operator string, left, right Object) *Error {
+	return NewError(TypeError, "unknown operator: %s %s %s",
+		left.Type(), operator, right.Type())
+}
+
+func integerOperation(operator string, left, right Object) Object {
+	leftVal := left.(*Integer).Value
+	rightVal := right.(*Integer).Value
+
+	switch operator {
+	case "+":
+		return Add(leftVal, rightVal)
+	case "-":
+		return Sub(leftVal, rightVal)
+	case "*":
+		return Mul(leftVal, rightVal)
+	case "/":
+		return Div(leftVal, rightVal)
+	case "//":
+		return FloorDiv(leftVal, rightVal)
+	case "%":
+		return Mod(leftVal, rightVal)
+	case "**":
+		return Pow(leftVal, rightVal)
+	case "&":
+		return &Integer{Value: leftVal & rightVal}
+	case "|":
+		return &Integer{Value: leftVal | rightVal}
+	case "^":
+		return &Integer{Value: leftVal ^ rightVal}
+	case "<<", ">>":
+		return Shift(operator, leftVal, rightVal)
+	case "<":
+		return nativeBool(leftVal < rightVal)
+	case ">":
+		return nativeBool(leftVal > rightVal)
+	case "<=":
+		return nativeBool(leftVal <= rightVal)
+	case ">=":
+		return nativeBool(leftVal >= rightVal)
+	case "==":
+		return nativeBool(leftVal == rightVal)
+	case "!=":
+		return nativeBool(leftVal != rightVal)
+	default:
+		return unknownOperator(operator, left, right)
+	}
+}
+
+func floatOperation(operator string, left, right Object) Object {
+	leftVal := left.(*Float).Value
+	rightVal := right.(*Float).Value
+
+	switch operator {
+	case "+":
+		return &Float{Value: leftVal + rightVal}
+	case "-":
+		return &Float{Value: leftVal - rightVal}
+	case "*":
+		return &Float{Value: leftVal * rightVal}
+	case "/":
+		return FloatDiv(leftVal, rightVal)
+	case "//":
+		return FloatFloorDiv(leftVal, rightVal)
+	case "%":
+		return FloatMod(leftVal, rightVal)
+	case "**":
+		return FloatPow(leftVal, rightVal)
+	case "<":
+		return nativeBool(leftVal < rightVal)
+	case ">":
+		return nativeBool(leftVal > rightVal)
+	case "<=":
+		return nativeBool(leftVal <= rightVal)
+	case ">=":
+		return nativeBool(leftVal >= rightVal)
+	case "==":
+		return nativeBool(leftVal == rightVal)
+	case "!=":
+		return nativeBool(leftVal != rightVal)
+	default:
+		return unknownOperator(operator, left, right)
+	}
+}
+
+func stringOperation(operator string, left, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return NewString(leftVal + rightVal)
+	case "==":
+		return nativeBool(leftVal == rightVal)
+	case "!=":
+		return nativeBool(leftVal != rightVal)
+	default:
+		return unknownOperator(operator, left, right)
+	}
+}
+
+// stringIntegerOperation handles n * s and s * n, with the integer
+// always passed first.
+func stringIntegerOperation(operator string, left, right Object) Object {
+	leftVal := Int64(left)
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "*":
+		return RepeatString(rightVal, leftVal)
+	default:
+		return unknownOperator(operator, left, right)
+	}
+}
+
+// UnaryOperation returns operator operand, for -, +, ~ and !.
+func UnaryOperation(operator string, operand Object) Object {
+	switch operator {
+	case "!":
+		return nativeBool(!IsTruthy(operand))
+	case "-":
+		switch obj := operand.(type) {
+		case *Integer:
+			return Neg(obj.Value)
+		case *BigInteger:
+			return obj.Neg()
+		case *Float:
+			return &Float{Value: -obj.Value}
+		case *Decimal:
+			return obj.Neg()
+		}
+	case "+":
+		switch operand.(type) {
+		case *Integer, *BigInteger, *Float, *Decimal:
+			return operand
+		}
+	case "~":
+		switch obj := operand.(type) {
+		case *Integer:
+			return &Integer{Value: ^obj.Value}
+		case *BigInteger:
+			return obj.Invert()
+		}
+	}
+	return NewError(TypeError, "unknown operator: %s%s", operator, operand.Type())
+}
+
+// Index returns left[index] for arrays, strings and hashes.
+func Index(left, index Object) Object {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		elements := left.(*Array).Elements
+		idx := Int64(index)
+		if idx < 0 || idx > int64(len(elements))-1 {
+			return NewError(IndexError, "index out of range: %s", index.Inspect())
+		}
+		return elements[idx]
+	case left.Type() == STRING_OBJ && index.Type() == INTEGER_OBJ:
+		runes := []rune(left.(*String).Value)
+		idx := Int64(index)
+		if idx < 0 || idx > int64(len(runes))-1 {
+			return NewError(IndexError, "index out of range: %s", index.Inspect())
+		}
+		return NewString(string(runes[idx]))
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError(TypeError, "unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NewError(KeyError, "key does not exists: %s", index.Inspect())
+		}
+		return pair.Value
+	default:
+		return NewError(TypeError, "index operator not supported: %s", left.Type())
+	}
+}
+
+// SetIndex sets left[index] to value for arrays and hashes. It returns
+// nil on success.
+func SetIndex(left, index, value Object) *Error {
+	switch {
+	case left.Type() == ARRAY_OBJ && index.Type() == INTEGER_OBJ:
+		elements := left.(*Array).Elements
+		idx := Int64(index)
+		if idx < 0 || idx > int64(len(elements))-1 {
+			return NewError(IndexError, "index out of range: %s", index.Inspect())
+		}
+		elements[idx] = value
+		return nil
+	case left.Type() == HASH_OBJ:
+		key, ok := index.(Hashable)
+		if !ok {
+			return NewError(TypeError, "unusable as hash key: %s", index.Type())
+		}
+		left.(*Hash).Pairs[key.HashKey()] = HashPair{Key: index, Value: value}
+		return nil
+	default:
+		return NewError(TypeError, "index operator not supported: %s", left.Type())
+	}
+}
@@ -0,0 +1,46 @@
+package object
+
+import "fmt"
+
+// Range is the lazy sequence of integers returned by range().
+type Range struct {
+	Start, Stop, Step int64
+}
+
+func NewRange(start, stop, step int64) *Range {
+	return &Range{Start: start, Stop: stop, Step: step}
+}
+
+func (r *Range) Type() ObjectType { return RANGE_OBJ }
+func (r *Range) Inspect() string {
+	return fmt.Sprintf("range(%d, %d, %d)", r.Start, r.Stop, r.Step)
+}
+func (r *Range) SetAttr(key string, value Object) Object {
+	return attributeError(r, key)
+}
+func (r *Range) GetAttr(key string) Object {
+	return attributeError(r, key)
+}
+
+func (r *Range) Len() Object {
+	n := int64(0)
+	switch {
+	case r.Step > 0 && r.Start < r.Stop:
+		n = (r.Stop - r.Start + r.Step - 1) / r.Step
+	case r.Step < 0 && r.Start > r.Stop:
+		n = (r.Start - r.Stop - r.Step - 1) / -r.Step
+	}
+	return NewInteger(n)
+}
+
+func (r *Range) Iter() *Iterator {
+	current := r.Start
+	return NewIterator(func() (Object, bool) {
+		if (r.Step > 0 && current >= r.Stop) || (r.Step < 0 && current <= r.Stop) {
+			return nil, false
+		}
+		value := current
+		current += r.Step
+		return NewInteger(value), true
+	})
+}
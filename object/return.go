@@ -1,7 +1,5 @@
 package object
 
-import "fmt"
-
 type ReturnValue struct {
 	Value Object
 }
@@ -9,9 +7,9 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 func (rv *ReturnValue) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", rv.Inspect(), key)}
+	return attributeError(rv, key)
 }
 
 func (rv *ReturnValue) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", rv.Inspect(), key)}
+	return attributeError(rv, key)
 }
@@ -1,7 +1,6 @@
 package object
 
 import (
-	"fmt"
 	"hash/fnv"
 	"strings"
 )
@@ -21,8 +20,25 @@ func NewString(value string) *String {
 	return s
 }
 
+// MaxRepeatLength is the longest string repetition, as in "ab" * n, may
+// build. Longer ones fail with a ValueError instead of exhausting memory.
+const MaxRepeatLength = 1 << 30
+
+// RepeatString returns s repeated count times, or an error if the result
+// would be longer than MaxRepeatLength. A negative count gives "".
+func RepeatString(s string, count int64) Object {
+	if count <= 0 || s == "" {
+		return NewString("")
+	}
+	if count > int64(MaxRepeatLength/len(s)) {
+		return NewError(ValueError, "repeated string is too long")
+	}
+	return NewString(strings.Repeat(s, int(count)))
+}
+
 func (s *String) initialize() {
 	s.dict["reverse"] = &Builtin{
+		Name: "reverse",
 		Fn:   strReverse,
 		Env:  nil,
 		Self: s,
@@ -31,6 +47,7 @@ reverse the string and return new string object
 `,
 	}
 	s.dict["upper"] = &Builtin{
+		Name: "upper",
 		Fn:   strUpper,
 		Env:  nil,
 		Self: s,
@@ -39,6 +56,7 @@ upper case the string and return new string object
 `,
 	}
 	s.dict["split"] = &Builtin{
+		Name: "split",
 		Fn:   strSplit,
 		Env:  nil,
 		Self: s,
@@ -52,17 +70,30 @@ The default separator is a whitespace.
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 func (s *String) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", s.Inspect(), key)}
+	return attributeError(s, key)
 }
 func (s *String) Len() Object {
 	return &Integer{Value: int64(len(s.Value))}
 }
 
+// Iter yields the characters of the string one by one.
+func (s *String) Iter() *Iterator {
+	runes := []rune(s.Value)
+	i := 0
+	return NewIterator(func() (Object, bool) {
+		if i >= len(runes) {
+			return nil, false
+		}
+		i++
+		return NewString(string(runes[i-1])), true
+	})
+}
+
 func (s *String) GetAttr(key string) Object {
 	if val, ok := s.dict[key]; ok {
 		return val
 	}
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", s.Inspect(), key)}
+	return attributeError(s, key)
 }
 
 func (s *String) HashKey() HashKey {
@@ -72,10 +103,10 @@ func (s *String) HashKey() HashKey {
 	return HashKey{Type: s.Type(), Value: h.Sum64()}
 }
 
-func strReverse(env *Environment, args ...Object) Object {
+func strReverse(env Env, args ...Object) Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args)-1)
 	}
 
 	self, _ := args[0].(*String)
@@ -92,10 +123,10 @@ func strReverse(env *Environment, args ...Object) Object {
 
 }
 
-func strUpper(env *Environment, args ...Object) Object {
+func strUpper(env Env, args ...Object) Object {
 	if len(args) != 1 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0",
+			len(args)-1)
 	}
 
 	s := args[0].(*String)
@@ -104,15 +135,19 @@ func strUpper(env *Environment, args ...Object) Object {
 	return r
 }
 
-func strSplit(env *Environment, args ...Object) Object {
+func strSplit(env Env, args ...Object) Object {
 	var sep = " "
 	if len(args) < 1 || len(args) > 2 {
-		return newError("wrong number of arguments. got=%d, want=1",
-			len(args))
+		return NewError(TypeError, "wrong number of arguments. got=%d, want=0..1",
+			len(args)-1)
 	}
 
 	if len(args) == 2 {
-		sep = args[1].(*String).Value
+		s, ok := args[1].(*String)
+		if !ok {
+			return NewError(TypeError, "separator must be STRING, got %s", args[1].Type())
+		}
+		sep = s.Value
 	}
 
 	s := args[0].(*String).Value
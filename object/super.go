@@ -0,0 +1,31 @@
+package object
+
+import "fmt"
+
+// Super is the proxy returned by super(). Its attributes are looked up
+// in the MRO of the receiver's class, after Class.
+type Super struct {
+	Class *Class
+	Self  *Instance
+}
+
+func (s *Super) Type() ObjectType { return SUPER_OBJ }
+func (s *Super) Inspect() string {
+	return fmt.Sprintf("<super: %s, %s>", s.Class.Inspect(), s.Self.Inspect())
+}
+func (s *Super) SetAttr(key string, value Object) Object {
+	return attributeError(s, key)
+}
+func (s *Super) GetAttr(key string) Object {
+	mro := s.Self.Class().MRO
+	for i, cls := range mro {
+		if cls != s.Class {
+			continue
+		}
+		if v, ok := s.Self.Class().lookup(key, i+1); ok {
+			return bindMethod(v, s.Self)
+		}
+		break
+	}
+	return NewError(AttributeError, "'super' object has no attribute '%s'", key)
+}
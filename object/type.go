@@ -1,7 +1,5 @@
 package object
 
-import "fmt"
-
 type ObjType struct {
 	Value string
 }
@@ -14,9 +12,9 @@ func (ot *ObjType) Inspect() string {
 	return ot.Value
 }
 func (ot *ObjType) SetAttr(key string, value Object) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", ot.Inspect(), key)}
+	return attributeError(ot, key)
 }
 
 func (ot *ObjType) GetAttr(key string) Object {
-	return &Error{Message: fmt.Sprintf("AttributeError: '%s' object has no attribute  %s", ot.Inspect(), key)}
+	return attributeError(ot, key)
 }
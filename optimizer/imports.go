@@ -0,0 +1,234 @@
+package optimizer
+
+import (
+	"github.com/yushyn-andriy/firefly/ast"
+)
+
+// importName returns the module name of a top level import statement.
+func importName(s ast.Statement) (string, bool) {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return "", false
+	}
+	imp, ok := es.Expression.(*ast.ImportLiteral)
+	if !ok || imp.Name == nil {
+		return "", false
+	}
+	return imp.Name.Value, true
+}
+
+// importModule makes the literal constants of module name available for
+// inlining in the statements after its import. That is only safe if the
+// name always refers to the module: program must neither rebind it nor
+// use it other than to read its attributes, which rules out aliases
+// through which the module could be changed.
+func (o *optimizer) importModule(name string, program *ast.Program) {
+	if _, ok := o.constants[name]; ok || !onlySelected(program, name) {
+		return
+	}
+	module := o.load(name)
+	if module == nil {
+		return
+	}
+	constants := moduleConstants(o, module)
+	if len(constants) > 0 {
+		o.constants[name] = constants
+	}
+}
+
+// onlySelected reports whether every use of the identifier name in node
+// is of the form name.attr, and none of them assigns to the attribute.
+func onlySelected(node ast.Node, name string) bool {
+	ok := true
+	inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			if id, isIdent := n.Expression.(*ast.Identifier); isIdent && id.Value == name {
+				if n.Value != nil {
+					ok = false
+				}
+				return false
+			}
+		case *ast.Identifier:
+			if n.Value == name {
+				ok = false
+			}
+		}
+		return ok
+	})
+	return ok
+}
+
+// moduleConstants returns the names that module binds to a literal at
+// its top level and never binds again, anywhere. Statements after a top
+// level return do not run, so they define nothing.
+func moduleConstants(o *optimizer, module *ast.Program) map[string]ast.Expression {
+	bound := map[string]int{}
+	inspect(module, func(n ast.Node) bool {
+		for _, id := range bindings(n) {
+			bound[id.Value]++
+		}
+		return true
+	})
+
+	constants := map[string]ast.Expression{}
+	for _, s := range module.Statements {
+		var name *ast.Identifier
+		var value ast.Expression
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			name, value = s.Name, s.Value
+		case *ast.AssignStatement:
+			name, value = s.Name, s.Value
+		case *ast.ReturnStatement:
+			return constants
+		default:
+			continue
+		}
+		if bound[name.Value] != 1 {
+			continue
+		}
+		if value = o.expression(value); isLiteral(value) {
+			constants[name.Value] = value
+		}
+	}
+	return constants
+}
+
+// bindings returns the identifiers n binds a value to.
+func bindings(n ast.Node) []*ast.Identifier {
+	switch n := n.(type) {
+	case *ast.LetStatement:
+		return []*ast.Identifier{n.Name}
+	case *ast.AssignStatement:
+		return []*ast.Identifier{n.Name}
+	case *ast.FunctionLiteral:
+		ids := append([]*ast.Identifier{}, n.Parameters...)
+		if n.Name != nil {
+			ids = append(ids, n.Name)
+		}
+		if n.Rest != nil {
+			ids = append(ids, n.Rest)
+		}
+		return ids
+	case *ast.ClassLiteral:
+		if n.Name != nil {
+			return []*ast.Identifier{n.Name}
+		}
+	case *ast.ForStatement:
+		return n.Vars
+	case *ast.CatchClause:
+		if n.Param != nil {
+			return []*ast.Identifier{n.Param}
+		}
+	}
+	return nil
+}
+
+// inspect calls f for node and, as long as f returns true, for each of
+// its children, depth first.
+func inspect(node ast.Node, f func(ast.Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	visit := func(nodes ...ast.Node) {
+		for _, n := range nodes {
+			inspect(n, f)
+		}
+	}
+	switch n := node.(type) {
+	case *ast.Program:
+		for _, s := range n.Statements {
+			visit(s)
+		}
+	case *ast.BlockStatement:
+		for _, s := range n.Statements {
+			visit(s)
+		}
+	case *ast.LetStatement:
+		visit(n.Name, n.Value)
+	case *ast.AssignStatement:
+		visit(n.Name, n.Value)
+	case *ast.ReturnStatement:
+		visit(n.ReturnValue)
+	case *ast.ThrowStatement:
+		visit(n.Value)
+	case *ast.ExpressionStatement:
+		visit(n.Expression)
+	case *ast.PrefixExpression:
+		visit(n.Right)
+	case *ast.InfixExpression:
+		visit(n.Left, n.Right)
+	case *ast.IfExpression:
+		visit(n.Condition, n.Consequence, n.Alternative)
+	case *ast.ConditionalExpression:
+		visit(n.Condition, n.Consequence, n.Alternative)
+	case *ast.FunctionLiteral:
+		visit(n.Name)
+		for i, p := range n.Parameters {
+			visit(p)
+			if i < len(n.Defaults) {
+				visit(n.Defaults[i])
+			}
+		}
+		visit(n.Rest, n.Body)
+	case *ast.ClassLiteral:
+		visit(n.Name)
+		for _, b := range n.Bases {
+			visit(b)
+		}
+		visit(n.Body)
+	case *ast.CallExpression:
+		visit(n.Function)
+		for _, a := range n.Arguments {
+			visit(a)
+		}
+	case *ast.KeywordArgument:
+		visit(n.Value)
+	case *ast.SpreadExpression:
+		visit(n.Value)
+	case *ast.ArrayLiteral:
+		for _, e := range n.Elements {
+			visit(e)
+		}
+	case *ast.IndexExpression:
+		visit(n.Left, n.Index, n.Right)
+	case *ast.HashLiteral:
+		for k, v := range n.Pairs {
+			visit(k, v)
+		}
+	case *ast.SelectorExpr:
+		visit(n.Expression, n.Value)
+	case *ast.ForStatement:
+		for _, v := range n.Vars {
+			visit(v)
+		}
+		visit(n.Init, n.Cond, n.Post, n.Iter, n.Body)
+	case *ast.WhileStatement:
+		visit(n.Cond, n.Body)
+	case *ast.TryStatement:
+		visit(n.Block)
+		for _, c := range n.Catches {
+			visit(c)
+		}
+		visit(n.Finally)
+	case *ast.CatchClause:
+		visit(n.Type, n.Param, n.Body)
+	}
+}
+
+// isNil reports whether n is nil or a nil pointer stored in the
+// interface, as optional children like an absent else block are.
+func isNil(n ast.Node) bool {
+	if n == nil {
+		return true
+	}
+	switch n := n.(type) {
+	case *ast.BlockStatement:
+		return n == nil
+	case *ast.Identifier:
+		return n == nil
+	}
+	return false
+}
@@ -0,0 +1,328 @@
+// Package optimizer rewrites a parsed program into an equivalent one that
+// is cheaper to run. It sits between the parser and the evaluator or the
+// compiler, so both engines benefit from it.
+//
+// The rewrites are:
+//
+//   - operators whose operands are literals are folded into a literal,
+//     e.g. 2 * 3.5 or "a" + "b";
+//   - if expressions with a literal true or false condition are replaced
+//     by the branch that runs, or dropped when no branch runs;
+//   - statements after return, break, continue and throw are dropped;
+//   - literal constants of imported modules, like phys.G after
+//     import "phys", are replaced by their value.
+//
+// A rewrite is only made when it cannot change what the program prints
+// or raises. In particular an operation that fails, like 1 / 0, is left
+// alone so that it fails at run time with its usual traceback.
+//
+// The rewrites speed up code that computes with constants, like a loop
+// over 2.0 * PI / 360.0. Code that spends its time in calls and in
+// arithmetic on variables, like the sin and cos series of lib/math.fl,
+// runs no faster.
+package optimizer
+
+import (
+	"os"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/evaluator"
+	"github.com/yushyn-andriy/firefly/lexer"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/parser"
+	"github.com/yushyn-andriy/firefly/token"
+)
+
+// maxFoldedString bounds the strings, and the digits of the integers,
+// folding may create, so that "-" * 1000000 stays an expression instead
+// of a megabyte constant.
+const maxFoldedString = 1024
+
+// Optimize rewrites program in place.
+func Optimize(program *ast.Program) {
+	o := &optimizer{load: loadModule, constants: map[string]map[string]ast.Expression{}}
+	o.program(program)
+}
+
+type optimizer struct {
+	// load returns the parsed source of an imported module, or nil
+	load func(name string) *ast.Program
+
+	// constants maps the name of an imported module to the literal
+	// constants that can be inlined for it
+	constants map[string]map[string]ast.Expression
+}
+
+func loadModule(name string) *ast.Program {
+	path := object.ImportPath(name)
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	p := parser.New(lexer.NewFile(path, string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil
+	}
+	return program
+}
+
+func (o *optimizer) program(program *ast.Program) {
+	stmts := program.Statements
+	var out []ast.Statement
+	for i, s := range stmts {
+		out = o.appendStatement(out, s, i == len(stmts)-1, true)
+		if name, ok := importName(s); ok {
+			o.importModule(name, program)
+		}
+		if len(out) > 0 && isTerminal(out[len(out)-1]) {
+			break
+		}
+	}
+	program.Statements = out
+}
+
+// statements optimizes a list of statements. splice allows replacing an
+// if statement with the statements of its branch, which is wrong in a
+// class body, where the functions defined directly in it are methods.
+func (o *optimizer) statements(stmts []ast.Statement, splice bool) []ast.Statement {
+	var out []ast.Statement
+	for i, s := range stmts {
+		out = o.appendStatement(out, s, i == len(stmts)-1, splice)
+		if len(out) > 0 && isTerminal(out[len(out)-1]) {
+			break
+		}
+	}
+	return out
+}
+
+// appendStatement appends the optimized s to out. last tells whether s
+// is the last statement of its block, whose value is the value of the
+// block, so it is only dropped or spliced if that value is kept.
+func (o *optimizer) appendStatement(out []ast.Statement, s ast.Statement, last, splice bool) []ast.Statement {
+	s = o.statement(s)
+
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok || !splice {
+		return append(out, s)
+	}
+	ie, ok := es.Expression.(*ast.IfExpression)
+	if !ok {
+		return append(out, s)
+	}
+	cond, ok := ie.Condition.(*ast.Boolean)
+	if !ok {
+		return append(out, s)
+	}
+
+	branch := ie.Alternative
+	if cond.Value {
+		branch = ie.Consequence
+	}
+	if branch == nil || len(branch.Statements) == 0 {
+		if last {
+			return append(out, s)
+		}
+		return out
+	}
+	if _, ok := branch.Statements[len(branch.Statements)-1].(*ast.ExpressionStatement); !ok && last {
+		return append(out, s)
+	}
+
+	for _, bs := range branch.Statements {
+		out = append(out, bs)
+		if isTerminal(bs) {
+			break
+		}
+	}
+	return out
+}
+
+func (o *optimizer) statement(s ast.Statement) ast.Statement {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		s.Value = o.expression(s.Value)
+	case *ast.AssignStatement:
+		s.Value = o.expression(s.Value)
+	case *ast.ReturnStatement:
+		s.ReturnValue = o.expression(s.ReturnValue)
+	case *ast.ThrowStatement:
+		s.Value = o.expression(s.Value)
+	case *ast.ExpressionStatement:
+		s.Expression = o.expression(s.Expression)
+	case *ast.BlockStatement:
+		o.block(s, true)
+	case *ast.ForStatement:
+		if s.Init != nil {
+			s.Init = o.statement(s.Init)
+		}
+		s.Cond = o.expression(s.Cond)
+		if s.Post != nil {
+			s.Post = o.statement(s.Post)
+		}
+		s.Iter = o.expression(s.Iter)
+		o.block(s.Body, true)
+	case *ast.WhileStatement:
+		s.Cond = o.expression(s.Cond)
+		o.block(s.Body, true)
+	case *ast.TryStatement:
+		o.block(s.Block, true)
+		for _, c := range s.Catches {
+			c.Type = o.expression(c.Type)
+			o.block(c.Body, true)
+		}
+		o.block(s.Finally, true)
+	}
+	return s
+}
+
+func (o *optimizer) block(b *ast.BlockStatement, splice bool) {
+	if b != nil {
+		b.Statements = o.statements(b.Statements, splice)
+	}
+}
+
+func (o *optimizer) expression(e ast.Expression) ast.Expression {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		e.Right = o.expression(e.Right)
+		if isLiteral(e.Right) {
+			return fold(e)
+		}
+	case *ast.InfixExpression:
+		e.Left = o.expression(e.Left)
+		e.Right = o.expression(e.Right)
+		if isLiteral(e.Left) && isLiteral(e.Right) {
+			return fold(e)
+		}
+	case *ast.IfExpression:
+		e.Condition = o.expression(e.Condition)
+		o.block(e.Consequence, true)
+		o.block(e.Alternative, true)
+	case *ast.ConditionalExpression:
+		e.Condition = o.expression(e.Condition)
+		e.Consequence = o.expression(e.Consequence)
+		e.Alternative = o.expression(e.Alternative)
+		if cond, ok := e.Condition.(*ast.Boolean); ok {
+			if cond.Value {
+				return e.Consequence
+			}
+			return e.Alternative
+		}
+	case *ast.FunctionLiteral:
+		for i, d := range e.Defaults {
+			e.Defaults[i] = o.expression(d)
+		}
+		if e.Source == "" {
+			e.Source = e.Body.String()
+		}
+		o.block(e.Body, true)
+	case *ast.ClassLiteral:
+		o.expressions(e.Bases)
+		o.block(e.Body, false)
+	case *ast.CallExpression:
+		e.Function = o.expression(e.Function)
+		o.expressions(e.Arguments)
+	case *ast.KeywordArgument:
+		e.Value = o.expression(e.Value)
+	case *ast.SpreadExpression:
+		e.Value = o.expression(e.Value)
+	case *ast.ArrayLiteral:
+		o.expressions(e.Elements)
+	case *ast.IndexExpression:
+		e.Left = o.expression(e.Left)
+		e.Index = o.expression(e.Index)
+		e.Right = o.expression(e.Right)
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression, len(e.Pairs))
+		for k, v := range e.Pairs {
+			pairs[o.expression(k)] = o.expression(v)
+		}
+		e.Pairs = pairs
+	case *ast.SelectorExpr:
+		if module, ok := e.Expression.(*ast.Identifier); ok && e.Value == nil {
+			if c, ok := o.constants[module.Value][e.Selector.Value]; ok {
+				return copyLiteral(c, e.Pos())
+			}
+		}
+		e.Expression = o.expression(e.Expression)
+		e.Value = o.expression(e.Value)
+	}
+	return e
+}
+
+func (o *optimizer) expressions(list []ast.Expression) {
+	for i, e := range list {
+		list[i] = o.expression(e)
+	}
+}
+
+// fold evaluates e, whose operands are literals, and returns the result
+// as a literal. The evaluator itself computes the value, so folding
+// cannot disagree with it; e is returned unchanged if it fails.
+func fold(e ast.Expression) ast.Expression {
+	result := evaluator.Eval(e, object.NewEnvironment())
+
+	pos := e.Pos()
+	switch result := result.(type) {
+	case *object.Integer:
+		return &ast.IntegerLiteral{Token: newToken(token.INT, result.Inspect(), pos), Value: result.Value}
+	case *object.BigInteger:
+		literal := result.Inspect()
+		if len(literal) > maxFoldedString {
+			return e
+		}
+		return &ast.IntegerLiteral{Token: newToken(token.INT, literal, pos), Big: result.Value}
+	case *object.Float:
+		return &ast.FloatLiteral{Token: newToken(token.FLOAT, result.Inspect(), pos), Value: result.Value}
+	case *object.String:
+		if len(result.Value) > maxFoldedString {
+			return e
+		}
+		return &ast.StringLiteral{Token: newToken(token.STRING, result.Value, pos), Value: result.Value}
+	case *object.Boolean:
+		if result.Value {
+			return &ast.Boolean{Token: newToken(token.TRUE, "true", pos), Value: true}
+		}
+		return &ast.Boolean{Token: newToken(token.FALSE, "false", pos), Value: false}
+	default:
+		return e
+	}
+}
+
+func newToken(typ token.TokenType, literal string, pos token.Position) token.Token {
+	return token.Token{Type: typ, Literal: literal, Pos: pos}
+}
+
+// copyLiteral returns a copy of the literal e placed at pos, so that an
+// inlined constant reports errors where it is used.
+func copyLiteral(e ast.Expression, pos token.Position) ast.Expression {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return &ast.IntegerLiteral{Token: newToken(e.Token.Type, e.Token.Literal, pos), Value: e.Value, Big: e.Big}
+	case *ast.FloatLiteral:
+		return &ast.FloatLiteral{Token: newToken(e.Token.Type, e.Token.Literal, pos), Value: e.Value}
+	case *ast.StringLiteral:
+		return &ast.StringLiteral{Token: newToken(e.Token.Type, e.Token.Literal, pos), Value: e.Value}
+	case *ast.Boolean:
+		return &ast.Boolean{Token: newToken(e.Token.Type, e.Token.Literal, pos), Value: e.Value}
+	}
+	return e
+}
+
+func isLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.IntegerLiteral, *ast.FloatLiteral, *ast.StringLiteral, *ast.Boolean:
+		return true
+	}
+	return false
+}
+
+// isTerminal reports whether the statements following s never run.
+func isTerminal(s ast.Statement) bool {
+	switch s.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement, *ast.BreakStatement, *ast.ContinueStatement:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package optimizer
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/compiler"
+	"github.com/yushyn-andriy/firefly/evaluator"
+	"github.com/yushyn-andriy/firefly/lexer"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/parser"
+	"github.com/yushyn-andriy/firefly/vm"
+)
+
+func parse(t testing.TB, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func optimize(t testing.TB, input string, modules map[string]string) *ast.Program {
+	t.Helper()
+
+	o := &optimizer{
+		load: func(name string) *ast.Program {
+			if src, ok := modules[name]; ok {
+				return parse(t, src)
+			}
+			return nil
+		},
+		constants: map[string]map[string]ast.Expression{},
+	}
+	program := parse(t, input)
+	o.program(program)
+	return program
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 2 * 3 + 1;", "let x = 7;"},
+		{`let s = "a" + "b" * 2;`, "let s = abb;"},
+		{"let y = -(1.5 * 2.0);", "let y = -3;"},
+		{"let h = 1 + 0.5 * 3;", "let h = 2.5;"},
+		{"let b = 1 < 2 == !false;", "let b = true;"},
+		{"let c = x + 1 * 2;", "let c = (x + 2);"},
+		// failing operations are left for run time
+		{"let z = 1 / 0;", "let z = (1 / 0);"},
+		{"let m = 1 + true;", "let m = (1 + true);"},
+		{`let r = "-" * 2000;`, "let r = (- * 2000);"},
+
+		{"x = 1; if (false) { x = 2; } x", "x = 1;x"},
+		{"if (1 > 2) { a } else { b; c } d", "bcd"},
+		{"if (true) { a } d", "ad"},
+		// the value of the last statement is the value of the block
+		{"if (false) { a }", "iffalse a"},
+		{"if (true) { let a = 1; }", "iftrue let a = 1;"},
+		{"if (x) { 1 + 1 }", "ifx 2"},
+		{"if (false) { a } else if (x) { b } c", "ifx bc"},
+		{"let v = 1 < 2 ? a : b;", "let v = a;"},
+		{"let w = x ? 1 + 1 : 3;", "let w = (x ? 2 : 3);"},
+
+		{"fn f() { return 1; g(); }", "fn f() return 1;"},
+		{"fn f() { if (true) { return 1; } g(); }", "fn f() return 1;"},
+		{"while (x) { break; x = 1; }", "while(x){break;}"},
+		{"for (;;) { if (true) { continue; } x = 1; }", "for(;;){continue;}"},
+		{"throw 1; x", "throw 1;"},
+		// functions in a class body are methods, even in a branch
+		{"class A { if (true) { fn m() { 1 } } }", "class Aiftrue fn m() 1"},
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input, nil)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestImportConstants(t *testing.T) {
+	modules := map[string]string{
+		"phys":  `G = 2.0; let C = 3; NAME = "phys"; ANSWER = 6 * 7; fn f() { 1 }`,
+		"state": `G = 2.0; fn set() { G = 1.0; }`,
+		"early": `A = 1; return 0; B = 2;`,
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "phys"; phys.G * 2.0`, `import "phys";4`},
+		{`import "phys"; phys.C + phys.ANSWER; phys.NAME`, `import "phys";45phys`},
+		{`import "phys"; fn g() { phys.G }`, `import "phys";fn g() 2.0`},
+		{`import "phys"; phys.f`, `import "phys";phys.f`},
+		{`phys.G; import "phys"; phys.G`, `phys.Gimport "phys";2.0`},
+		// the name does not always refer to the module
+		{`import "phys"; phys = 1; phys.G`, `import "phys";phys = 1;phys.G`},
+		{`import "phys"; phys.G = 1; phys.G`, `import "phys";phys.G = 1phys.G`},
+		{`import "phys"; let p = phys; phys.G`, `import "phys";let p = phys;phys.G`},
+		{`import "phys"; fn g(phys) { phys.G }`, `import "phys";fn g(phys) phys.G`},
+		// the constant is not constant
+		{`import "state"; state.G`, `import "state";state.G`},
+		{`import "early"; early.A + early.B`, `import "early";(1 + early.B)`},
+		{`import "missing"; missing.G`, `import "missing";missing.G`},
+	}
+
+	for _, tt := range tests {
+		program := optimize(t, tt.input, modules)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// TestOptimizedOutput runs programs with and without the optimizer, in
+// the evaluator and on the VM, and checks that they print and return the
+// same.
+func TestOptimizedOutput(t *testing.T) {
+	math, err := os.ReadFile("../lib/math.fl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []string{
+		`println(2 * 3 + 1, "a" + "b", -(1.5 * 2.0), 1 < 2 == !false)`,
+		`let x = 1; if (false) { x = 2; } if (true) { x = x + 10; } x`,
+		`fn f(n) { if (n > 0) { return "pos"; "dead" } else { return "neg"; } }; [f(1), f(-1)]`,
+		`fn f() { if (false) { 1 } }; f()`,
+		`fn f() { if (true) { let a = 1; } }; f()`,
+		`for (let i = 0; i < 3; i = i + 1) { if (true) { continue; } println(i); }`,
+		`let s = 0; while (true) { s = s + 2 * 2; if (s > 10) { break; } } s`,
+		`println(1 + 1); 10 / (5 - 5)`,
+		`println(1 + 1); 10 / (2 * 0)`,
+		`"a" - "b"`,
+		`class A { fn m() { 1 + 1 } }; A().m()`,
+		`let f = fn() { return 1 + 2 * 3; }; println(f);`,
+		`fn f(a = 1 + 1) { if (true) { return a; } a }; println(f); f`,
+		string(math) + ";\n[sin(PI / 2.0), cos(2.0 * PI), factorial(3 + 2)]",
+	}
+
+	for _, input := range tests {
+		for _, compile := range []bool{false, true} {
+			expected := run(t, input, compile, false)
+			if got := run(t, input, compile, true); got != expected {
+				t.Errorf("%q (compiled %t): optimized output differs\nexpected: %q\ngot:      %q",
+					input, compile, expected, got)
+			}
+		}
+	}
+}
+
+// run runs input and returns what it printed followed by its result or
+// the traceback of its error.
+func run(t testing.TB, input string, compile, optimize bool) string {
+	var out bytes.Buffer
+	builtins.SetStd(&out, &out)
+	defer builtins.SetStd(os.Stdout, os.Stderr)
+
+	program := parse(t, input)
+	if optimize {
+		Optimize(program)
+	}
+
+	var result object.Object
+	if compile {
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			result = err.(*object.Error)
+		} else {
+			result = machine.LastPoppedStackElem()
+		}
+	} else {
+		result = evaluator.Eval(program, object.NewEnvironment())
+	}
+
+	switch result := result.(type) {
+	case nil:
+	case *object.Error:
+		out.WriteString(result.Traceback())
+	default:
+		out.WriteString(result.Inspect())
+	}
+	return out.String()
+}
+
+// BenchmarkMathSeries runs the sin and cos series of lib/math.fl with and
+// without the optimizer. The series spends its time in calls and in
+// arithmetic on variables, which the optimizer leaves alone, so both
+// run about equally fast.
+func BenchmarkMathSeries(b *testing.B) {
+	math, err := os.ReadFile("../lib/math.fl")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkRun(b, string(math)+`;
+let sum = 0.0;
+for (let i = 0; i < 20; i = i + 1) {
+    sum = sum + sin(PI / 4.0) * cos(PI / 4.0);
+}
+sum`)
+}
+
+// BenchmarkConstantLoop runs a loop whose body is mostly constant
+// arithmetic and a disabled debugging branch, which the optimizer folds
+// and drops.
+func BenchmarkConstantLoop(b *testing.B) {
+	benchmarkRun(b, `let sum = 0.0;
+for (let i = 0; i < 2000; i = i + 1) {
+    if (false) { println("step", i); }
+    sum = sum + i * (2.0 * 3.141592653589793 / 360.0) + (60 * 60 * 24) % 7;
+}
+sum`)
+}
+
+// benchmarkRun times running input in both engines, with and without the
+// optimizer. Parsing, optimizing and compiling happen before the timer
+// starts, so only running the program is measured.
+func benchmarkRun(b *testing.B, input string) {
+	for _, bench := range []struct {
+		name              string
+		compile, optimize bool
+	}{
+		{"eval", false, false},
+		{"eval-O", false, true},
+		{"vm", true, false},
+		{"vm-O", true, true},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			program := parse(b, input)
+			if bench.optimize {
+				Optimize(program)
+			}
+
+			var bytecode *compiler.Bytecode
+			if bench.compile {
+				comp := compiler.New()
+				if err := comp.Compile(program); err != nil {
+					b.Fatalf("compiler error: %s", err)
+				}
+				bytecode = comp.Bytecode()
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if bench.compile {
+					if err := vm.New(bytecode).Run(); err != nil {
+						b.Fatal(err)
+					}
+				} else if err, ok := evaluator.Eval(program, object.NewEnvironment()).(*object.Error); ok {
+					b.Fatal(err.Traceback())
+				}
+			}
+		})
+	}
+}
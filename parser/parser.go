@@ -2,6 +2,7 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 
 	"strconv"
 
@@ -13,32 +14,49 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	CONDITIONAL // x ? y : z
 	OR
 	AND
 	EQUALS      // ==
 	LESSGREATER // > or <
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
-	DOT         // .
 	PREFIX      // -X or !X
+	POWER       // **
 	CALL        // muFunction(X)
 	INDEX       // array[index]
+	DOT         // .
 )
 
 var precedences = map[token.TokenType]int{
-	token.DOT:      DOT,
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL,
-	token.LBRACKET: INDEX,
-	token.AND:      AND,
-	token.OR:       AND,
+	token.DOT:         DOT,
+	token.EQ:          EQUALS,
+	token.NOT_EQ:      EQUALS,
+	token.LT:          LESSGREATER,
+	token.GT:          LESSGREATER,
+	token.LT_EQ:       LESSGREATER,
+	token.GT_EQ:       LESSGREATER,
+	token.PIPE:        BITOR,
+	token.CARET:       BITXOR,
+	token.AMPERSAND:   BITAND,
+	token.SHIFT_LEFT:  SHIFT,
+	token.SHIFT_RIGHT: SHIFT,
+	token.PLUS:        SUM,
+	token.MINUS:       SUM,
+	token.SLASH:       PRODUCT,
+	token.ASTERISK:    PRODUCT,
+	token.PERCENT:     PRODUCT,
+	token.FLOOR_DIV:   PRODUCT,
+	token.POWER:       POWER,
+	token.LPAREN:      CALL,
+	token.LBRACKET:    INDEX,
+	token.AND:         AND,
+	token.OR:          AND,
+	token.QUESTION:    CONDITIONAL,
 }
 
 type (
@@ -56,8 +74,24 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// loops counts the loops around the current token within the
+	// innermost function or class body, where break and continue
+	// are allowed
+	loops int
+
+	// depth counts the expressions and blocks being parsed around the
+	// current token
+	depth int
+	// tooDeep is set once they nest deeper than maxDepth; the rest of
+	// the input is skipped then
+	tooDeep bool
 }
 
+// maxDepth bounds the nesting of expressions and blocks, so that input
+// like a million ( fails to parse instead of overflowing the Go stack.
+const maxDepth = 1000
+
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
@@ -70,6 +104,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.PLUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -90,12 +126,23 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	p.registerInfix(token.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.FLOOR_DIV, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_LEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFT_RIGHT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	p.registerInfix(token.DOT, p.parseSelectorExpression)
 
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.QUESTION, p.parseConditionalExpression)
 
 	// Read two tokens, so curToken and peekToken are both set
 	p.nextToken()
@@ -199,9 +246,13 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		v, ok := new(big.Int).SetString(p.curToken.Literal, 0)
+		if !ok {
+			p.errorf(p.curToken.Pos, "could not parse %q as integer", p.curToken.Literal)
+			return nil
+		}
+		lit.Big = v
+		return lit
 	}
 
 	lit.Value = value
@@ -214,8 +265,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float64", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorf(p.curToken.Pos, "could not parse %q as float64", p.curToken.Literal)
 		return nil
 	}
 
@@ -228,10 +278,40 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// errorf records a parse error prefixed with the source position it refers to.
+func (p *Parser) errorf(pos token.Position, format string, a ...interface{}) {
+	if p.tooDeep {
+		// every construct around the skipped input is unfinished,
+		// which is not worth a message each
+		return
+	}
+	msg := fmt.Sprintf("%s: %s", pos, fmt.Sprintf(format, a...))
+	p.errors = append(p.errors, msg)
+}
+
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.errorf(p.peekToken.Pos, "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+}
+
+// enter notes that parsing descends into a nested expression or block.
+// It reports false, after skipping to the end of the input, if that is
+// too deep; otherwise the caller must call leave when done.
+func (p *Parser) enter() bool {
+	if p.depth >= maxDepth {
+		p.errorf(p.curToken.Pos, "nested too deeply, more than %d levels", maxDepth)
+		p.tooDeep = true
+		for !p.curTokenIs(token.EOF) {
+			p.nextToken()
+		}
+		return false
+	}
+	p.depth++
+	return true
+}
+
+func (p *Parser) leave() {
+	p.depth--
 }
 
 func (p *Parser) nextToken() {
@@ -269,40 +349,252 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseAssignStatement()
 	case tokenType == token.FOR:
 		return p.parseForStatement()
+	case tokenType == token.WHILE:
+		return p.parseWhileStatement()
+	case tokenType == token.BREAK:
+		stmt := &ast.BreakStatement{Token: p.curToken}
+		if p.loops == 0 {
+			p.errorf(p.curToken.Pos, "'break' outside loop")
+		}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case tokenType == token.CONTINUE:
+		stmt := &ast.ContinueStatement{Token: p.curToken}
+		if p.loops == 0 {
+			p.errorf(p.curToken.Pos, "'continue' outside loop")
+		}
+		if p.peekTokenIs(token.SEMICOLON) {
+			p.nextToken()
+		}
+		return stmt
+	case tokenType == token.TRY:
+		return p.parseTryStatement()
+	case tokenType == token.THROW:
+		return p.parseThrowStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
+// parseForStatement parses `for (init; cond; post) { }`. Every slot
+// may be left empty; init and post take any simple statement.
+func (p *Parser) parseForStatement() ast.Statement {
 	stmt := &ast.ForStatement{Token: p.curToken}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 	p.nextToken()
 
-	pp := p.parseAssignStatement()
-	stmt.Init = pp
+	if p.curTokenIs(token.IDENT) && (p.peekTokenIs(token.IN) || p.peekTokenIs(token.COMMA)) {
+		return p.parseForInStatement(stmt)
+	}
 
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Init = p.parseSimpleStatement()
+		if stmt.Init == nil {
+			return nil
+		}
+		if !p.curTokenIs(token.SEMICOLON) {
+			p.peekError(token.SEMICOLON)
+			return nil
+		}
+	}
 	p.nextToken()
-	ppp := p.parseExpression(LOWEST)
 
-	stmt.Cond = ppp
-	p.nextToken()
+	if !p.curTokenIs(token.SEMICOLON) {
+		stmt.Cond = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Post = p.parseSimpleStatement()
+		if stmt.Post == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseForInStatement parses the rest of `for (x in iter) { }` and
+// `for (k, v in iter) { }` once the first variable is the current token.
+func (p *Parser) parseForInStatement(stmt *ast.ForStatement) ast.Statement {
+	stmt.Vars = append(stmt.Vars, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Vars = append(stmt.Vars, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+	}
+
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
 	p.nextToken()
+	stmt.Iter = p.parseExpression(LOWEST)
+	if stmt.Iter == nil {
+		return nil
+	}
 
-	pt := p.parseAssignStatement()
-	stmt.Post = pt
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseSimpleStatement parses the statements allowed in the
+// init and post slots of a for loop.
+func (p *Parser) parseSimpleStatement() ast.Statement {
+	switch {
+	case p.curTokenIs(token.LET):
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN):
+		if stmt := p.parseAssignStatement(); stmt != nil {
+			return stmt
+		}
+	default:
+		stmt := p.parseExpressionStatement()
+		if stmt.Expression != nil {
+			return stmt
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Cond = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Body = p.parseLoopBody()
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseTryStatement() ast.Statement {
+	stmt := &ast.TryStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Block = p.parseBlockStatement()
+
+	for p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		clause := p.parseCatchClause()
+		if clause == nil {
+			return nil
+		}
+		stmt.Catches = append(stmt.Catches, clause)
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		stmt.Finally = p.parseBlockStatement()
+	}
+
+	if len(stmt.Catches) == 0 && stmt.Finally == nil {
+		p.errorf(stmt.Token.Pos, "expected catch or finally after try block")
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseCatchClause parses `catch { }`, `catch (e) { }` and
+// `catch (Type e) { }` where Type is any expression naming a class.
+func (p *Parser) parseCatchClause() *ast.CatchClause {
+	clause := &ast.CatchClause{Token: p.curToken}
+
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		p.nextToken()
+
+		typ := p.parseExpression(LOWEST)
+		if p.peekTokenIs(token.IDENT) {
+			p.nextToken()
+			clause.Type = typ
+			clause.Param = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		} else if ident, ok := typ.(*ast.Identifier); ok {
+			clause.Param = ident
+		} else {
+			p.errorf(clause.Token.Pos, "expected exception name in catch clause")
+			return nil
+		}
+
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
-	stmt.Body = p.parseBlockStatement()
+	clause.Body = p.parseBlockStatement()
 
+	return clause
+}
+
+func (p *Parser) parseThrowStatement() ast.Statement {
+	stmt := &ast.ThrowStatement{Token: p.curToken}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
@@ -374,6 +666,11 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	if !p.enter() {
+		return nil
+	}
+	defer p.leave()
+
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
 		p.noPrefixParseFnError(p.curToken.Type)
@@ -461,6 +758,10 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	}
 
 	precedence := p.curPrecedence()
+	if p.curTokenIs(token.POWER) {
+		// ** is right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
 
@@ -468,8 +769,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorf(p.curToken.Pos, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) parseBoolean() ast.Expression {
@@ -511,6 +811,19 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
 
+		// else if (c) { } is else { if (c) { } }
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			block := &ast.BlockStatement{Token: p.curToken}
+			stmt := &ast.ExpressionStatement{Token: p.curToken, Expression: p.parseIfExpression()}
+			if stmt.Expression == nil {
+				return nil
+			}
+			block.Statements = []ast.Statement{stmt}
+			expression.Alternative = block
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -521,9 +834,48 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
+// parseConditionalExpression parses cond ? a : b. It is right
+// associative, so a ? b : c ? d : e is a ? b : (c ? d : e).
+func (p *Parser) parseConditionalExpression(condition ast.Expression) ast.Expression {
+	expression := &ast.ConditionalExpression{Token: p.curToken, Condition: condition}
+
+	p.nextToken()
+	expression.Consequence = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+
+	p.nextToken()
+	expression.Alternative = p.parseExpression(CONDITIONAL - 1)
+
+	return expression
+}
+
+// parseLoopBody parses the body of a loop, where break and continue
+// are allowed.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	p.loops++
+	defer func() { p.loops-- }()
+	return p.parseBlockStatement()
+}
+
+// parseScopeBody parses the body of a function or class, which break
+// and continue cannot leave even when it is inside a loop.
+func (p *Parser) parseScopeBody() *ast.BlockStatement {
+	loops := p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+	return p.parseBlockStatement()
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
+	if !p.enter() {
+		return block
+	}
+	defer p.leave()
 
 	p.nextToken()
 
@@ -542,13 +894,11 @@ func (p *Parser) parseImportLiteral() ast.Expression {
 	imp := &ast.ImportLiteral{
 		Token: p.curToken,
 	}
-	if !p.peekTokenIs(token.STRING) {
+	if !p.expectPeek(token.STRING) {
 		return nil
 	}
 
-	p.nextToken()
-
-	imp.Name = &ast.StringLiteral{p.curToken, p.curToken.Literal}
+	imp.Name = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
@@ -571,11 +921,19 @@ func (p *Parser) parseClassLiteral() ast.Expression {
 	cls.Name = ident
 	// lit.Parameters = p.parseFunctionParameters()
 
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		cls.Bases = p.parseExpressionList(token.RPAREN)
+		if cls.Bases == nil {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	cls.Body = p.parseBlockStatement()
+	cls.Body = p.parseScopeBody()
 
 	return cls
 }
@@ -594,52 +952,80 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	}
 
 	lit.Name = ident
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseScopeBody()
 
 	return lit
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// parseFunctionParameters parses the parameter list of lit: plain names,
+// names with a default value (b = 2) and a final ...rest parameter.
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
+	lit.Parameters = []*ast.Identifier{}
+	lit.Defaults = []ast.Expression{}
 
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
+	for {
+		p.nextToken()
 
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.peekTokenIs(token.RPAREN) {
+				p.errorf(p.peekToken.Pos, "rest parameter must be the last parameter")
+				return false
+			}
+			break
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
+		if !p.curTokenIs(token.IDENT) {
+			p.errorf(p.curToken.Pos, "expected parameter name, got %s", p.curToken.Type)
+			return false
+		}
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
 
-	if !p.expectPeek(token.RPAREN) {
-		return nil
+		var def ast.Expression
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			def = p.parseExpression(LOWEST)
+		} else if len(lit.Defaults) > 0 && lit.Defaults[len(lit.Defaults)-1] != nil {
+			p.errorf(ident.Pos(), "non-default parameter %s follows default parameter",
+				ident.Value)
+			return false
+		}
+
+		lit.Parameters = append(lit.Parameters, ident)
+		lit.Defaults = append(lit.Defaults, def)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
 	}
 
-	return identifiers
+	return p.expectPeek(token.RPAREN)
 }
 
 func (p *Parser) parseSelectorExpression(expression ast.Expression) ast.Expression {
-	exp := &ast.SelectorExpr{Expression: expression}
+	exp := &ast.SelectorExpr{Token: p.curToken, Expression: expression}
 
-	if !p.peekTokenIs(token.IDENT) {
+	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
-
-	p.nextToken()
 	exp.Selector = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
 	if p.peekTokenIs(token.ASSIGN) {
@@ -655,10 +1041,13 @@ func (p *Parser) parseSelectorExpression(expression ast.Expression) ast.Expressi
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseExpressionList(token.RPAREN)
+	exp.Arguments = p.parseCallArguments()
 	return exp
 }
 
+// parseCallArguments parses the arguments of a call. Besides plain
+// expressions they may be keyword arguments (name: value) and spread
+// arguments (...iterable); positional arguments cannot follow keywords.
 func (p *Parser) parseCallArguments() []ast.Expression {
 	args := []ast.Expression{}
 
@@ -667,13 +1056,30 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		return args
 	}
 
-	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
-
-	for p.peekTokenIs(token.COMMA) {
+	keywords := map[string]bool{}
+	for {
 		p.nextToken()
+
+		arg := p.parseCallArgument()
+		switch arg := arg.(type) {
+		case *ast.KeywordArgument:
+			if keywords[arg.Name.Value] {
+				p.errorf(arg.Pos(), "keyword argument repeated: %s", arg.Name.Value)
+			}
+			keywords[arg.Name.Value] = true
+		case *ast.SpreadExpression:
+			// spread arguments are positional but may follow keywords
+		default:
+			if len(keywords) > 0 {
+				p.errorf(p.curToken.Pos, "positional argument follows keyword argument")
+			}
+		}
+		args = append(args, arg)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -682,3 +1088,22 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 
 	return args
 }
+
+func (p *Parser) parseCallArgument() ast.Expression {
+	switch {
+	case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON):
+		arg := &ast.KeywordArgument{Token: p.curToken}
+		arg.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		p.nextToken()
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		return arg
+	case p.curTokenIs(token.ELLIPSIS):
+		arg := &ast.SpreadExpression{Token: p.curToken}
+		p.nextToken()
+		arg.Value = p.parseExpression(LOWEST)
+		return arg
+	default:
+		return p.parseExpression(LOWEST)
+	}
+}
@@ -2,6 +2,9 @@ package parser
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/yushyn-andriy/firefly/ast"
@@ -200,6 +203,22 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestBigIntegerLiteralExpression(t *testing.T) {
+	input := "18446744073709551616;"
+
+	program := createParseProgram(input, t)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.IntegerLiteral)
+	if !ok {
+		t.Fatalf("exp not %T. got=%T", &ast.IntegerLiteral{}, stmt.Expression)
+	}
+
+	if literal.Big == nil || literal.Big.String() != "18446744073709551616" {
+		t.Errorf("literal.Big not %s. got=%s", "18446744073709551616", literal.Big)
+	}
+}
+
 func TestFloatLiteralExpression(t *testing.T) {
 	input := "3.1415;"
 
@@ -238,6 +257,8 @@ func TestParsingPrefixExpressions(t *testing.T) {
 		{"-15", "-", 15},
 		{"!true", "!", true},
 		{"!false", "!", false},
+		{"+5", "+", 5},
+		{"~5", "~", 5},
 	}
 
 	for _, tt := range prefixTests {
@@ -280,6 +301,16 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 // 5;", 5, "//", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 
 		{"5.0 + 5.0;", 5.0, "+", 5.0},
 		{"5.0 + 5.0;", 5.0, "+", 5.0},
@@ -424,6 +455,66 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a * b[2], b[1], 2 * [1, 2][1])",
 			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 		},
+		{
+			"-a.b",
+			"(-a.b)",
+		},
+		{
+			"!a.b.c",
+			"(!a.b.c)",
+		},
+		{
+			"-a.b * c",
+			"((-a.b) * c)",
+		},
+		{
+			"a <= b == b >= a",
+			"((a <= b) == (b >= a))",
+		},
+		{
+			"a + b % c // d",
+			"(a + ((b % c) // d))",
+		},
+		{
+			"-a ** b",
+			"(-(a ** b))",
+		},
+		{
+			"a ** b ** c",
+			"(a ** (b ** c))",
+		},
+		{
+			"a ** -b * c",
+			"((a ** (-b)) * c)",
+		},
+		{
+			"a | b ^ c & d << e + f",
+			"(a | (b ^ (c & (d << (e + f)))))",
+		},
+		{
+			"a & 1 == 0",
+			"((a & 1) == 0)",
+		},
+		{
+			"~a >> +b",
+			"((~a) >> (+b))",
+		},
+		{
+			"a ? b : c ? d : e",
+			"(a ? b : (c ? d : e))",
+		},
+		{
+			"a or b ? c + 1 : d * 2",
+			"((a or b) ? (c + 1) : (d * 2))",
+		},
+		{
+			"a ? b ? c : d : e",
+			"(a ? (b ? c : d) : e)",
+		},
+		{
+			"f(a ? b : c, d)",
+			"f((a ? b : c), d)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -738,6 +829,67 @@ func TestIfElseExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else { 0 }`
+
+	program := createParseProgram(input, t)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not %T. got=%T", &ast.ExpressionStatement{},
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not %T. got=%T", &ast.IfExpression{}, stmt.Expression)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+
+	// the else if is the only statement of the alternative
+	if len(exp.Alternative.Statements) != 1 {
+		t.Fatalf("exp.Alternative.Statements does not contain 1 statements. got=%d\n",
+			len(exp.Alternative.Statements))
+	}
+	alternative, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("Statements[0] is not %T. got=%T", &ast.ExpressionStatement{},
+			exp.Alternative.Statements[0])
+	}
+	elseIf, ok := alternative.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("alternative is not %T. got=%T", &ast.IfExpression{}, alternative.Expression)
+	}
+	if !testInfixExpression(t, elseIf.Condition, "x", ">", "y") {
+		return
+	}
+	if elseIf.Alternative == nil || len(elseIf.Alternative.Statements) != 1 {
+		t.Fatalf("else if has no else block")
+	}
+	last := elseIf.Alternative.Statements[0].(*ast.ExpressionStatement)
+	testIntegerLiteral(t, last.Expression, 0)
+}
+
+func TestConditionalExpression(t *testing.T) {
+	program := createParseProgram(`let v = x < y ? x : y;`, t)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not %T. got=%T", &ast.LetStatement{},
+			program.Statements[0])
+	}
+	exp, ok := stmt.Value.(*ast.ConditionalExpression)
+	if !ok {
+		t.Fatalf("stmt.Value is not %T. got=%T", &ast.ConditionalExpression{}, stmt.Value)
+	}
+	if !testInfixExpression(t, exp.Condition, "x", "<", "y") {
+		return
+	}
+	testIdentifier(t, exp.Consequence, "x")
+	testIdentifier(t, exp.Alternative, "y")
+}
+
 func TestFunctionLiteralParsing(t *testing.T) {
 	input := `fn(x, y) { x + y; }`
 
@@ -1064,3 +1216,471 @@ func TestCommentLiteral(t *testing.T) {
 		}
 	}
 }
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let = 5;", "main.fl:1:5: expected next token to be IDENT, got = instead"},
+		{"x = 1;\ny = ;", "main.fl:2:5: no prefix parse function for ; found"},
+		{"if (x {\n}", "main.fl:1:7: expected next token to be ), got { instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("main.fl", tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	input := `fn add(a, b) {
+  return a.x + b;
+}`
+
+	program := createParseProgram(input, t)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	fn := stmt.Expression.(*ast.FunctionLiteral)
+
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	infix := ret.ReturnValue.(*ast.InfixExpression)
+	selector := infix.Left.(*ast.SelectorExpr)
+
+	tests := []struct {
+		node           ast.Node
+		expectedLine   int
+		expectedColumn int
+	}{
+		{program, 1, 1},
+		{fn, 1, 1},
+		{fn.Parameters[1], 1, 11},
+		{ret, 2, 3},
+		{infix, 2, 14},
+		{selector, 2, 11},
+		{selector.Selector, 2, 12},
+	}
+
+	for i, tt := range tests {
+		pos := tt.node.Pos()
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - %T position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.node, tt.expectedLine, tt.expectedColumn, pos.Line, pos.Column)
+		}
+	}
+}
+
+func TestTryStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStmt  string
+		expectedTypes []string // one entry per catch clause, "" for untyped
+		hasFinally    bool
+	}{
+		{`try { x } catch (e) { y }`, "try {x} catch (e) {y}", []string{""}, false},
+		{`try { x } catch { y }`, "try {x} catch {y}", []string{""}, false},
+		{`try { x } finally { z }`, "try {x} finally {z}", nil, true},
+		{`try { x } catch (err) { y } finally { z };`, "try {x} catch (err) {y} finally {z}", []string{""}, true},
+		{`try { x } catch (TypeError e) { y }`, "try {x} catch (TypeError e) {y}", []string{"TypeError"}, false},
+		{
+			`try { x } catch (errors.Custom e) { y } catch (KeyError k) { z } catch { w }`,
+			"try {x} catch (errors.Custom e) {y} catch (KeyError k) {z} catch {w}",
+			[]string{"errors.Custom", "KeyError", ""},
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.TryStatement)
+		if !ok {
+			t.Fatalf("stmt is not %T. got=%T", &ast.TryStatement{}, program.Statements[0])
+		}
+		if stmt.String() != tt.expectedStmt {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expectedStmt, stmt.String())
+		}
+		if len(stmt.Catches) != len(tt.expectedTypes) {
+			t.Fatalf("wrong number of catch clauses. want=%d, got=%d",
+				len(tt.expectedTypes), len(stmt.Catches))
+		}
+		for i, typ := range tt.expectedTypes {
+			got := ""
+			if stmt.Catches[i].Type != nil {
+				got = stmt.Catches[i].Type.String()
+			}
+			if got != typ {
+				t.Errorf("catch[%d] type wrong. want=%q, got=%q", i, typ, got)
+			}
+		}
+		if (stmt.Finally != nil) != tt.hasFinally {
+			t.Errorf("stmt.Finally wrong. want finally=%t, got=%+v", tt.hasFinally, stmt.Finally)
+		}
+	}
+}
+
+func TestTryWithoutHandlers(t *testing.T) {
+	p := New(lexer.New("try { x }"))
+	p.ParseProgram()
+
+	expected := "1:1: expected catch or finally after try block"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("wrong parser errors. want=%q, got=%q", expected, p.Errors())
+	}
+}
+
+func TestThrowStatement(t *testing.T) {
+	program := createParseProgram(`throw "boom";`, t)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ThrowStatement)
+	if !ok {
+		t.Fatalf("stmt is not %T. got=%T", &ast.ThrowStatement{}, program.Statements[0])
+	}
+	if stmt.Value.String() != "boom" {
+		t.Errorf("stmt.Value wrong. got=%q", stmt.Value.String())
+	}
+}
+
+func TestClassBases(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedBases []string
+		expectedClass string
+	}{
+		{`class A { }`, []string{}, "class A"},
+		{`class B(A) { }`, []string{"A"}, "class B(A)"},
+		{`class C(errors.Base) { }`, []string{"errors.Base"}, "class C(errors.Base)"},
+		{`class D(B, C) { }`, []string{"B", "C"}, "class D(B, C)"},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("stmt is not %T. got=%T", &ast.ExpressionStatement{}, program.Statements[0])
+		}
+		cls, ok := stmt.Expression.(*ast.ClassLiteral)
+		if !ok {
+			t.Fatalf("expression is not %T. got=%T", &ast.ClassLiteral{}, stmt.Expression)
+		}
+
+		if len(cls.Bases) != len(tt.expectedBases) {
+			t.Fatalf("wrong number of bases. want=%d, got=%d",
+				len(tt.expectedBases), len(cls.Bases))
+		}
+		for i, base := range tt.expectedBases {
+			if cls.Bases[i].String() != base {
+				t.Errorf("base %d wrong. want=%q, got=%q", i, base, cls.Bases[i].String())
+			}
+		}
+		if cls.String() != tt.expectedClass {
+			t.Errorf("cls.String() wrong. want=%q, got=%q", tt.expectedClass, cls.String())
+		}
+	}
+}
+
+func TestForStatementOptionalClauses(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedStmt string
+	}{
+		{`for (;;) { x }`, "for(;;){x}"},
+		{`for (; i < 3;) { x }`, "for(;(i < 3);){x}"},
+		{`for (let i = 0; i < 3; i = i + 1) { x }`, "for(let i = 0;(i < 3);i = (i + 1);){x}"},
+		{`for (i = 0; ; next()) { x }`, "for(i = 0;;next()){x}"},
+		// like other statements a loop may end in a semicolon
+		{`for (;;) { x };`, "for(;;){x}"},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt is not %T. got=%T", &ast.ForStatement{}, program.Statements[0])
+		}
+		if stmt.String() != tt.expectedStmt {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expectedStmt, stmt.String())
+		}
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < 10) { if (x == 5) { break; } continue; }`
+
+	program := createParseProgram(input, t)
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("stmt is not %T. got=%T", &ast.WhileStatement{}, program.Statements[0])
+	}
+	if !testInfixExpression(t, stmt.Cond, "x", "<", 10) {
+		return
+	}
+	if len(stmt.Body.Statements) != 2 {
+		t.Fatalf("body does not contain 2 statements. got=%d", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[1].(*ast.ContinueStatement); !ok {
+		t.Errorf("body.Statements[1] is not %T. got=%T",
+			&ast.ContinueStatement{}, stmt.Body.Statements[1])
+	}
+
+	ifExp := stmt.Body.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IfExpression)
+	if _, ok := ifExp.Consequence.Statements[0].(*ast.BreakStatement); !ok {
+		t.Errorf("consequence is not %T. got=%T",
+			&ast.BreakStatement{}, ifExp.Consequence.Statements[0])
+	}
+}
+
+func TestForInStatement(t *testing.T) {
+	tests := []struct {
+		input        string
+		expectedVars []string
+		expectedIter string
+	}{
+		{`for (x in items) { x }`, []string{"x"}, "items"},
+		{`for (k, v in {"a": 1}) { k }`, []string{"k", "v"}, "{a:1}"},
+		{`for (i in range(1, 10)) { i }`, []string{"i"}, "range(1, 10)"},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("stmt is not %T. got=%T", &ast.ForStatement{}, program.Statements[0])
+		}
+
+		if len(stmt.Vars) != len(tt.expectedVars) {
+			t.Fatalf("wrong number of loop variables. want=%d, got=%d",
+				len(tt.expectedVars), len(stmt.Vars))
+		}
+		for i, name := range tt.expectedVars {
+			if stmt.Vars[i].Value != name {
+				t.Errorf("loop variable %d wrong. want=%q, got=%q", i, name, stmt.Vars[i].Value)
+			}
+		}
+		if stmt.Iter.String() != tt.expectedIter {
+			t.Errorf("stmt.Iter wrong. want=%q, got=%q", tt.expectedIter, stmt.Iter.String())
+		}
+		if stmt.Init != nil || stmt.Cond != nil || stmt.Post != nil {
+			t.Errorf("for-in loop has C-style clauses: %q", stmt.String())
+		}
+	}
+}
+
+func TestFunctionDefaultsAndRest(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedDefaults []string
+		expectedRest     string
+		expectedString   string
+	}{
+		{"fn(a, b = 2) {}", []string{"", "2"}, "", "fn(a, b = 2) "},
+		{"fn(...args) {}", []string{}, "args", "fn(...args) "},
+		{"fn(a, b = 1 + 2, ...rest) {}", []string{"", "(1 + 2)"}, "rest", "fn(a, b = (1 + 2), ...rest) "},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		function := stmt.Expression.(*ast.FunctionLiteral)
+
+		if len(function.Defaults) != len(tt.expectedDefaults) {
+			t.Fatalf("length defaults wrong. want %d, got=%d",
+				len(tt.expectedDefaults), len(function.Defaults))
+		}
+		for i, def := range tt.expectedDefaults {
+			got := ""
+			if function.Defaults[i] != nil {
+				got = function.Defaults[i].String()
+			}
+			if got != def {
+				t.Errorf("default %d wrong. want=%q, got=%q", i, def, got)
+			}
+		}
+
+		rest := ""
+		if function.Rest != nil {
+			rest = function.Rest.Value
+		}
+		if rest != tt.expectedRest {
+			t.Errorf("rest parameter wrong. want=%q, got=%q", tt.expectedRest, rest)
+		}
+		if function.String() != tt.expectedString {
+			t.Errorf("function.String() wrong. want=%q, got=%q", tt.expectedString, function.String())
+		}
+	}
+}
+
+func TestCallArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"f(1, b: 2)", "f(1, b: 2)"},
+		{"f(...xs)", "f(...xs)"},
+		{"f(a: 1, ...xs)", "f(a: 1, ...xs)"},
+		{"f(...g(1), x + 1)", "f(...g(1), (x + 1))"},
+	}
+
+	for _, tt := range tests {
+		program := createParseProgram(tt.input, t)
+		if program.String() != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+		}
+	}
+}
+
+func TestParameterErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"fn(a = 1, b) {}", "main.fl:1:11: non-default parameter b follows default parameter"},
+		{"fn(...a, b) {}", "main.fl:1:8: rest parameter must be the last parameter"},
+		{"fn(1) {}", "main.fl:1:4: expected parameter name, got INT"},
+		{"f(a: 1, 2)", "main.fl:1:9: positional argument follows keyword argument"},
+		{"f(a: 1, a: 2)", "main.fl:1:9: keyword argument repeated: a"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("main.fl", tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+// TestMalformedInput checks that incomplete programs give parser errors
+// rather than a program with holes in it.
+func TestMalformedInput(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import;`, "main.fl:1:7: expected next token to be STRING, got ; instead"},
+		{`x.;`, "main.fl:1:3: expected next token to be IDENT, got ; instead"},
+		{`f(A.)`, "main.fl:1:5: expected next token to be IDENT, got ) instead"},
+		{`a ? b;`, "main.fl:1:6: expected next token to be :, got ; instead"},
+		{`break;`, "main.fl:1:1: 'break' outside loop"},
+		{`if (x) { continue; }`, "main.fl:1:10: 'continue' outside loop"},
+		{`while (x) { fn() { break; } }`, "main.fl:1:20: 'break' outside loop"},
+		{`for (;;) { class A { continue; } }`, "main.fl:1:22: 'continue' outside loop"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("main.fl", tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestNestingDepth(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{strings.Repeat("(", 2000000) + "1", "main.fl:1:1001: nested too deeply, more than 1000 levels"},
+		{strings.Repeat("-", 3000000) + "1", "main.fl:1:1001: nested too deeply, more than 1000 levels"},
+		{strings.Repeat("[", 1000) + "1", "main.fl:1:1001: nested too deeply, more than 1000 levels"},
+		{strings.Repeat("while (x) {", 1001), "main.fl:1:11008: nested too deeply, more than 1000 levels"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.NewFile("main.fl", tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != 1 {
+			t.Fatalf("expected 1 parser error for %.20q..., got %d", tt.input, len(errors))
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+
+	input := strings.Repeat("(", 999) + "1" + strings.Repeat(")", 999)
+	p := New(lexer.New(input))
+	p.ParseProgram()
+	checkParserErrors(t, p)
+}
+
+// FuzzParser checks that the parser turns any input into either a
+// program or parser errors. A program parsed without errors must be
+// complete, which String, visiting every node, checks.
+func FuzzParser(f *testing.F) {
+	files, _ := filepath.Glob("../programs/*/*.fl")
+	for _, file := range files {
+		input, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(input))
+	}
+	for _, seed := range []string{
+		`import`,
+		`import;`,
+		`for`,
+		`for (`,
+		`for (x in`,
+		`for (let i = 0; i < 3; i = i +) {}`,
+		`try {} catch (`,
+		`class A(`,
+		`fn(a, b`,
+		`x.`,
+		`x.y = `,
+		`{1: }`,
+		`a[1] = `,
+		`f(...)`,
+		`-`,
+		`if (x) {} else`,
+		`if (x) {} else if`,
+		`a ? b :`,
+		`let x = 99999999999999999999;`,
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			_ = program.String()
+		}
+	})
+}
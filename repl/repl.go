@@ -2,15 +2,20 @@ package repl
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/yushyn-andriy/firefly/ast"
 	"github.com/yushyn-andriy/firefly/compiler"
 	"github.com/yushyn-andriy/firefly/config"
 	"github.com/yushyn-andriy/firefly/evaluator"
 	"github.com/yushyn-andriy/firefly/lexer"
 	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/optimizer"
 	"github.com/yushyn-andriy/firefly/parser"
 	"github.com/yushyn-andriy/firefly/vm"
 )
@@ -19,6 +24,12 @@ const PROMPT = ">>> "
 
 func Start(in io.Reader, out io.Writer, conf config.Config) {
 	env := object.NewEnvironment()
+
+	// state the compiler mode keeps from one line to the next
+	constants := []object.Object{}
+	globals := make([]object.Object, vm.GlobalsSize)
+	symbolTable := compiler.NewSymbolTable()
+
 	if conf.Mode == config.INTERACTIVE {
 		scanner := bufio.NewScanner(in)
 		for {
@@ -39,28 +50,37 @@ func Start(in io.Reader, out io.Writer, conf config.Config) {
 			}
 
 			if conf.CompilerMode == true {
-				comp := compiler.New()
+				comp := compiler.NewWithState(symbolTable, constants)
 				err := comp.Compile(program)
 				if err != nil {
 					fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 					continue
 				}
+				constants = comp.Constants()
 
-				machine := vm.New(comp.Bytecode())
+				bytecode := comp.Bytecode()
+				compiler.Peephole(bytecode)
+
+				machine := vm.NewWithGlobalsStore(bytecode, globals)
 				err = machine.Run()
-				if err != nil {
+				if e, ok := err.(*object.Error); ok {
+					io.WriteString(out, e.Traceback())
+					continue
+				} else if err != nil {
 					fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
 					continue
 				}
 				stackTop := machine.LastPoppedStackElem()
-				if stackTop != nil {
+				if stackTop != nil && endsWithExpression(program) {
 					io.WriteString(out, stackTop.Inspect())
 					io.WriteString(out, "\n")
 				}
 			} else {
 
 				evaluated := evaluator.Eval(program, env)
-				if evaluated != nil {
+				if err, ok := evaluated.(*object.Error); ok {
+					io.WriteString(out, err.Traceback())
+				} else if evaluated != nil {
 					io.WriteString(out, evaluated.Inspect())
 					io.WriteString(out, "\n")
 				}
@@ -71,20 +91,172 @@ func Start(in io.Reader, out io.Writer, conf config.Config) {
 		if err != nil {
 			log.Fatal(err)
 		}
-		l := lexer.New(string(input))
+		if compiler.IsBytecode(input) {
+			runBytecode(input)
+			return
+		}
+		l := lexer.NewFile(conf.FilePath, string(input))
 		p := parser.New(l)
 
 		program := p.ParseProgram()
 		if len(p.Errors()) != 0 {
+			// what did not parse cannot be run
 			printParseErrors(out, p.Errors())
+			os.Exit(1)
+		}
+
+		if conf.Optimize {
+			optimizer.Optimize(program)
+			evaluator.SetOptimizer(optimizer.Optimize)
+		}
+
+		if conf.CompilerMode {
+			runCompiled(program)
+			return
 		}
 
 		obj := evaluator.Eval(program, env)
 		switch result := obj.(type) {
 		case *object.Error:
-			log.Fatal(result.Message)
+			io.WriteString(os.Stderr, result.Traceback())
+			os.Exit(1)
+		}
+	}
+}
+
+// runCompiled compiles program and runs it on the VM, reporting errors
+// the same way the evaluator does.
+func runCompiled(program *ast.Program) {
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Compilation failed:\n %s\n", err)
+		os.Exit(1)
+	}
+
+	bytecode := comp.Bytecode()
+	compiler.Peephole(bytecode)
+	runVM(bytecode)
+}
+
+// runBytecode runs a program compiled by Build.
+func runBytecode(input []byte) {
+	bytecode, err := compiler.Decode(bytes.NewReader(input))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Loading bytecode failed:\n %s\n", err)
+		os.Exit(1)
+	}
+	runVM(bytecode)
+}
+
+func runVM(bytecode *compiler.Bytecode) {
+	machine := vm.New(bytecode)
+	err := machine.Run()
+	if e, ok := err.(*object.Error); ok {
+		io.WriteString(os.Stderr, e.Traceback())
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "Woops! Executing bytecode failed:\n %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// Build compiles the source file src and writes the bytecode to dst, so
+// that it can be run later without lexing and parsing it again. If
+// optimize is set the program is optimized before it is compiled.
+func Build(src, dst string, optimize bool) error {
+	input, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.NewFile(src, string(input)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: %s", src, strings.Join(p.Errors(), "\n\t"))
+	}
+	if optimize {
+		optimizer.Optimize(program)
+	}
+
+	comp := compiler.New()
+	comp.StrictImports = true
+	if err := comp.Compile(program); err != nil {
+		return fmt.Errorf("%s: compilation failed: %s", src, err)
+	}
+
+	bytecode := comp.Bytecode()
+	compiler.Peephole(bytecode)
+
+	var out bytes.Buffer
+	if err := bytecode.Encode(&out); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, out.Bytes(), 0644)
+}
+
+// Disasm writes the disassembly of path, a source file or a file made by
+// Build, to out. Source files are optimized first if optimize is set.
+func Disasm(path string, out io.Writer, optimize bool) error {
+	input, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var bytecode *compiler.Bytecode
+	if compiler.IsBytecode(input) {
+		bytecode, err = compiler.Decode(bytes.NewReader(input))
+		if err != nil {
+			return err
 		}
+	} else {
+		p := parser.New(lexer.NewFile(path, string(input)))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return fmt.Errorf("%s: %s", path, strings.Join(p.Errors(), "\n\t"))
+		}
+		if optimize {
+			optimizer.Optimize(program)
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			return fmt.Errorf("%s: compilation failed: %s", path, err)
+		}
+		bytecode = comp.Bytecode()
+		compiler.Peephole(bytecode)
+	}
+
+	compiler.Disassemble(out, bytecode, sourceLines())
+	return nil
+}
+
+// sourceLines returns a function that reads the lines of source files,
+// reading each file once.
+func sourceLines() func(filename string) []string {
+	files := map[string][]string{}
+	return func(filename string) []string {
+		lines, ok := files[filename]
+		if !ok {
+			data, err := os.ReadFile(filename)
+			if err == nil {
+				lines = strings.Split(string(data), "\n")
+			}
+			files[filename] = lines
+		}
+		return lines
+	}
+}
+
+// endsWithExpression reports whether the last statement of program
+// produces a value, which is what the evaluator shows in the REPL.
+func endsWithExpression(program *ast.Program) bool {
+	n := len(program.Statements)
+	if n == 0 {
+		return false
 	}
+	_, ok := program.Statements[n-1].(*ast.ExpressionStatement)
+	return ok
 }
 
 func printParseErrors(out io.Writer, errors []string) {
@@ -23,10 +23,10 @@ func main() {
 		log.Fatalf("error: %s", err)
 	}
 
-	l := lexer.New(string(data))
+	l := lexer.NewFile(args[0], string(data))
 	for i := 0; ; i++ {
 		tok := l.NextToken()
-		fmt.Printf("%d: Type: %q, Literal: %q\n", i, tok.Type, tok.Literal)
+		fmt.Printf("%d: %s: Type: %q, Literal: %q\n", i, tok.Pos, tok.Type, tok.Literal)
 		if tok.Type == token.EOF {
 			break
 		}
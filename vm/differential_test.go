@@ -0,0 +1,524 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/compiler"
+	"github.com/yushyn-andriy/firefly/evaluator"
+	"github.com/yushyn-andriy/firefly/lexer"
+	"github.com/yushyn-andriy/firefly/object"
+	"github.com/yushyn-andriy/firefly/parser"
+)
+
+// The tests in this file run programs in both engines, the evaluator and
+// the VM, and check that they behave the same.
+
+// differentialPrograms are the programs TestDifferential runs. The
+// examples of the web page are included when they are checked out. The
+// programs run in the root of the repository, where the modules they
+// import and the files they read are found.
+var differentialPrograms = []string{
+	"programs/*.fl",
+	"programs/*/*.fl",
+	"webassembly/yushyn-andriy.github.io/*.fl",
+}
+
+// skippedPrograms lists the programs TestDifferential does not run, and
+// why. Every other program has to compile.
+var skippedPrograms = map[string]string{
+	"file.fl": "it writes a million lines to example.txt",
+}
+
+// knownDivergences lists the programs the engines do not agree on yet,
+// and why. They are reported but do not fail the test, until they agree
+// and have to be taken off the list.
+var knownDivergences = map[string]string{
+	"scope.fl": "the evaluator prints functions as their source, the VM as <function name>",
+}
+
+// differentialInput is what the programs that call input read.
+const differentialInput = "5\n"
+
+// outcome is what running a program in one engine produced.
+type outcome struct {
+	stdout string
+	value  string // the value of the last expression statement, if any
+	err    string // the traceback of the error it ended with, if any
+}
+
+func (o outcome) String() string {
+	var out strings.Builder
+	out.WriteString(o.stdout)
+	if o.value != "" {
+		fmt.Fprintf(&out, "=> %s\n", o.value)
+	}
+	out.WriteString(o.err)
+	return out.String()
+}
+
+func TestDifferential(t *testing.T) {
+	chdir(t, "..")
+
+	var files []string
+	for _, pattern := range differentialPrograms {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs found")
+	}
+
+	for _, file := range files {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			if reason, ok := skippedPrograms[filepath.Base(file)]; ok {
+				t.Skip(reason)
+			}
+			input, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vmOutcome, err := runVMEngine(file, string(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			evalOutcome, err := runEvaluatorEngine(file, string(input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diff := lineDiff(evalOutcome.String(), vmOutcome.String())
+			reason, known := knownDivergences[filepath.Base(file)]
+			switch {
+			case diff != "" && known:
+				t.Skipf("known divergence, %s:\n%s", reason, diff)
+			case diff != "":
+				t.Errorf("evaluator (-) and VM (+) differ:\n%s", diff)
+			case known:
+				t.Errorf("the engines agree now, take it off knownDivergences")
+			}
+		})
+	}
+}
+
+// TestDifferentialLoopControl checks that both engines reject break and
+// continue outside a loop before running anything, at the statement.
+func TestDifferentialLoopControl(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`println("x"); break;`, "loop.fl:1:15: 'break' outside loop"},
+		{"let f = fn() {\n  continue;\n};\nwhile (true) { f(); }", "loop.fl:2:3: 'continue' outside loop"},
+	}
+
+	for _, tt := range tests {
+		_, evalErr := runEvaluatorEngine("loop.fl", tt.input)
+		_, vmErr := runVMEngine("loop.fl", tt.input)
+		if evalErr == nil || vmErr == nil {
+			t.Fatalf("%q: expected both engines to reject it, got %v and %v", tt.input, evalErr, vmErr)
+		}
+		if evalErr.Error() != vmErr.Error() {
+			t.Errorf("%q: evaluator and VM differ: %q, %q", tt.input, evalErr, vmErr)
+		}
+		if !strings.Contains(evalErr.Error(), tt.expected) {
+			t.Errorf("%q: expected %q, got %q", tt.input, tt.expected, evalErr)
+		}
+	}
+}
+
+// TestDifferentialSuper checks that both engines take super() without
+// arguments in the methods themselves only, not in functions nested in
+// them, the way Python does.
+func TestDifferentialSuper(t *testing.T) {
+	const classes = "class P { fn m() { return 1; }; };\n"
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{classes + "class Q(P) { fn m() { for (x in [1]) { return super().m() + 1; }; }; };\nprintln(Q().m());",
+			"2\n"},
+		{classes + "class Q(P) { fn m() { let f = fn() { return super().m(); }; return f(); }; };\nQ().m();",
+			"RuntimeError: super(): no arguments outside a method\n"},
+		{classes + "class Q(P) { fn m() { let f = fn() { self; return super().m(); }; return f(); }; };\nQ().m();",
+			"RuntimeError: super(): no arguments outside a method\n"},
+	}
+
+	for _, tt := range tests {
+		evalOutcome, err := runEvaluatorEngine("super.fl", tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		vmOutcome, err := runVMEngine("super.fl", tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := lineDiff(evalOutcome.String(), vmOutcome.String()); diff != "" {
+			t.Errorf("%q: evaluator (-) and VM (+) differ:\n%s", tt.input, diff)
+		}
+		if !strings.Contains(evalOutcome.String(), tt.expected) {
+			t.Errorf("%q: expected the output to contain %q, got %q", tt.input, tt.expected, evalOutcome)
+		}
+	}
+}
+
+// TestDifferentialCycles checks that both engines print arrays and hashes
+// that contain themselves, and stop modules that import themselves.
+func TestDifferentialCycles(t *testing.T) {
+	chdir(t, t.TempDir())
+	if err := os.Mkdir("lib", 0755); err != nil {
+		t.Fatal(err)
+	}
+	modules := map[string]string{
+		"self.fl": `import "self"; let x = 1;`,
+		"a.fl":    `import "b";`,
+		"b.fl":    `import "a";`,
+	}
+	for name, input := range modules {
+		if err := os.WriteFile(filepath.Join("lib", name), []byte(input), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := "let a = [1, 2]; let h = {1: a}; a[0] = a; a[1] = h; let g = {1: 0}; g[1] = g;\n" +
+		"println(a, [a, a]); println(h, g);\na"
+	evalOutcome, err := runEvaluatorEngine("cycles.fl", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vmOutcome, err := runVMEngine("cycles.fl", input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := lineDiff(evalOutcome.String(), vmOutcome.String()); diff != "" {
+		t.Errorf("evaluator (-) and VM (+) differ:\n%s", diff)
+	}
+	expected := "[[...], {1: [...]}] [[[...], {1: [...]}], [[...], {1: [...]}]]\n" +
+		"{1: [[...], {...}]} {1: {...}}\n=> [[...], {1: [...]}]\n"
+	if evalOutcome.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, evalOutcome)
+	}
+
+	for _, name := range []string{"self", "a"} {
+		input := fmt.Sprintf("import %q;", name)
+		evalOutcome, err := runEvaluatorEngine("main.fl", input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(evalOutcome.err, "ImportError: cannot import "+name+": import cycle") {
+			t.Errorf("%s: evaluator did not stop the import cycle: %q", name, evalOutcome)
+		}
+		if _, err := runVMEngine("main.fl", input); err == nil ||
+			!strings.Contains(err.Error(), "cannot import "+name+": import cycle") {
+			t.Errorf("%s: compiler did not stop the import cycle: %v", name, err)
+		}
+	}
+}
+
+// chdir changes the working directory to dir until the test ends.
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func parseProgram(filename, input string) (*ast.Program, error) {
+	p := parser.New(lexer.NewFile(filename, input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors: %s", strings.Join(p.Errors(), "; "))
+	}
+	return program, nil
+}
+
+// captureStd redirects the builtins to a fresh buffer and input and
+// returns the buffer and a function that undoes this.
+func captureStd() (*bytes.Buffer, func()) {
+	var out bytes.Buffer
+	builtins.SetStd(&out, &out)
+	builtins.SetStdin(strings.NewReader(differentialInput))
+	return &out, func() {
+		builtins.SetStd(os.Stdout, os.Stderr)
+		builtins.SetStdin(os.Stdin)
+	}
+}
+
+func runEvaluatorEngine(filename, input string) (outcome, error) {
+	program, err := parseProgram(filename, input)
+	if err != nil {
+		return outcome{}, err
+	}
+	out, restore := captureStd()
+	defer restore()
+
+	var o outcome
+	result := evaluator.Eval(program, object.NewEnvironment())
+	if e, ok := result.(*object.Error); ok {
+		o.err = e.Traceback()
+	} else if result != nil && endsWithValue(program) {
+		o.value = result.Inspect()
+	}
+	o.stdout = out.String()
+	return o, nil
+}
+
+// runVMEngine compiles and runs the program the way the command line
+// does, peephole optimizer included.
+func runVMEngine(filename, input string) (outcome, error) {
+	program, err := parseProgram(filename, input)
+	if err != nil {
+		return outcome{}, err
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return outcome{}, fmt.Errorf("not compiled: %w", err)
+	}
+	bytecode := comp.Bytecode()
+	compiler.Peephole(bytecode)
+
+	out, restore := captureStd()
+	defer restore()
+
+	var o outcome
+	machine := New(bytecode)
+	if err := machine.Run(); err != nil {
+		e, ok := err.(*object.Error)
+		if !ok {
+			return outcome{}, err
+		}
+		o.err = e.Traceback()
+	} else if result := machine.LastPoppedStackElem(); result != nil && endsWithValue(program) {
+		o.value = result.Inspect()
+	}
+	o.stdout = out.String()
+	return o, nil
+}
+
+// endsWithValue reports whether the last statement of program is an
+// expression whose value both engines keep.
+func endsWithValue(program *ast.Program) bool {
+	if len(program.Statements) == 0 {
+		return false
+	}
+	es, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+	if !ok || es.Expression == nil {
+		return false
+	}
+	switch exp := es.Expression.(type) {
+	case *ast.IndexExpression:
+		return exp.Right == nil
+	case *ast.SelectorExpr:
+		return exp.Value == nil
+	}
+	return true
+}
+
+// lineDiff returns the lines where want and got differ, with a line of
+// context on each side, or "" if they are equal. Long runs of changed
+// lines are cut short, so that a program printing a million lines still
+// gives a readable report.
+func lineDiff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	a := strings.Split(want, "\n")
+	b := strings.Split(got, "\n")
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	const context, maxLines = 1, 10
+	var out strings.Builder
+	fmt.Fprintf(&out, "@@ line %d @@\n", prefix+1)
+	for _, line := range a[max0(prefix-context):prefix] {
+		fmt.Fprintf(&out, "  %s\n", line)
+	}
+	writeLines := func(mark string, lines []string) {
+		for i, line := range lines {
+			if i == maxLines {
+				fmt.Fprintf(&out, "%s ... %d more lines\n", mark, len(lines)-maxLines)
+				break
+			}
+			fmt.Fprintf(&out, "%s %s\n", mark, line)
+		}
+	}
+	writeLines("-", a[prefix:len(a)-suffix])
+	writeLines("+", b[prefix:len(b)-suffix])
+	if suffix > 0 {
+		fmt.Fprintf(&out, "  %s\n", a[len(a)-suffix])
+	}
+	return out.String()
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// FuzzDifferential builds an expression program from the fuzzer's bytes
+// and checks that both engines print and return the same, or fail with
+// the same error.
+func FuzzDifferential(f *testing.F) {
+	for _, seed := range []string{
+		"",
+		"\x01\x02\x03\x04\x05\x06\x07\x08",
+		"\x01\x00\x01\x03\x01\x02\x00\x05",
+		"\x03\x01\x00\x04\x02\x06\x01\x07\x00",
+		"\x04\x04\x00\x01\x00\x02\x01\x03",
+		"\x06\x07\x00\x01\x02\x03\x04\x05\x06\x07\x00",
+		"\x01\x05\x00\x02\x01\x04\x03\x00\x01\x02",
+		"\x0a\x01\x0a\x00\x02\x01\x01\x0a\x02\x00\x03",
+		"\x03\x0a\x01\x04\x0a\x02\x01\x00\x02\x0a\x01\x01",
+		"\x0b\x00\x01\x00\x05\x01\x0b\x01\x02\x03\x00",
+		"\x0c\x01\x00\x02\x04\x01\x0c\x00\x01\x05\x02\x00\x03",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g := &programGen{data: data}
+		input := g.program()
+
+		want, err := runEvaluatorEngine("fuzz.fl", input)
+		if err != nil {
+			t.Fatalf("%s\n%s", err, input)
+		}
+		got, err := runVMEngine("fuzz.fl", input)
+		if err != nil {
+			t.Fatalf("%s\n%s", err, input)
+		}
+		if diff := lineDiff(want.String(), got.String()); diff != "" {
+			t.Errorf("evaluator (-) and VM (+) differ on\n%s\n%s", input, diff)
+		}
+	})
+}
+
+// programGen turns bytes into a program that binds two variables and
+// prints and returns expressions over them, some of them wrapped in
+// instances of genClass or passed to genFunction. Each byte picks one choice;
+// once the bytes run out every choice is the first.
+type programGen struct {
+	data []byte
+}
+
+func (g *programGen) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b) % n
+}
+
+func (g *programGen) program() string {
+	return fmt.Sprintf("%s%slet x = %s;\nlet y = %s;\nprintln(%s);\n%s",
+		genClass, genFunction, g.expr(3), g.expr(3), g.expr(4), g.expr(4))
+}
+
+// genFunction takes positional, keyword and spread arguments of calls.
+const genFunction = "fn k(a, b = 1, ...r) { return [a, b, r]; }\n"
+
+// genClass overloads operators by passing them on to the wrapped value,
+// so that instances meet both the built-in types and each other.
+const genClass = `class Z {
+    fn __init__(v) { self.v = v; }
+    fn __bool__() { return !!self.v; }
+    fn __add__(o) { return Z(self.v + o); }
+    fn __radd__(o) { return o + self.v; }
+    fn __sub__(o) { return self.v - o; }
+    fn __mul__(o) { return self.v * o; }
+    fn __eq__(o) { return self.v == o; }
+    fn __lt__(o) { return self.v < o; }
+    fn __gt__(o) { return self.v > o; }
+    fn __neg__() { return Z(-self.v); }
+    fn __getitem__(i) { return [self.v, i][i]; }
+    fn __len__() { return len(self.v); }
+}
+`
+
+var (
+	genLiterals = []string{
+		"0", "1", "7", "-3", "0.5", "2.0", "9223372036854775807", "18446744073709551616",
+		`""`, `"ab"`, "true", "false",
+	}
+	genInfix = []string{
+		"+", "-", "*", "/", "%", "**", "//", "==", "!=", "<", ">", "<=", ">=",
+		"&", "|", "^", "<<", ">>", "and", "or",
+	}
+	genPrefix = []string{"-", "!", "+", "~"}
+)
+
+func (g *programGen) expr(depth int) string {
+	if depth == 0 {
+		return genLiterals[g.choose(len(genLiterals))]
+	}
+	switch g.choose(13) {
+	case 0:
+		return genLiterals[g.choose(len(genLiterals))]
+	case 1:
+		return fmt.Sprintf("(%s %s %s)", g.expr(depth-1), genInfix[g.choose(len(genInfix))], g.expr(depth-1))
+	case 2:
+		return fmt.Sprintf("(%s%s)", genPrefix[g.choose(len(genPrefix))], g.expr(depth-1))
+	case 3:
+		return fmt.Sprintf("if (%s) { %s } else { %s }", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1))
+	case 4:
+		return fmt.Sprintf("[%s, %s][%s]", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1))
+	case 5:
+		return []string{"x", "y"}[g.choose(2)]
+	case 6:
+		return fmt.Sprintf("%s(%s)", []string{"len", "string", "type", "int", "decimal"}[g.choose(5)], g.expr(depth-1))
+	case 7:
+		return fmt.Sprintf("(%s ? %s : %s)", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1))
+	case 8:
+		return fmt.Sprintf("if (%s) { %s } else if (%s) { %s }", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1), g.expr(depth-1))
+	case 9:
+		return fmt.Sprintf("{%s: %s}[%s]", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1))
+	case 10:
+		return fmt.Sprintf("Z(%s)", g.expr(depth-1))
+	case 11:
+		return []string{
+			fmt.Sprintf("k(%s, b: %s)", g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("k(b: %s, a: %s)", g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("k(%s, a: %s)", g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("k(c: %s)", g.expr(depth-1)),
+			fmt.Sprintf("Z(v: %s)", g.expr(depth-1)),
+			fmt.Sprintf("len(x: %s)", g.expr(depth-1)),
+		}[g.choose(6)]
+	default:
+		return []string{
+			fmt.Sprintf("k(...[%s, %s, %s])", g.expr(depth-1), g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("k(%s, ...%s)", g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("k(a: %s, ...[%s])", g.expr(depth-1), g.expr(depth-1)),
+			fmt.Sprintf("len(...[%s])", g.expr(depth-1)),
+		}[g.choose(4)]
+	}
+}
@@ -0,0 +1,123 @@
+package vm
+
+import "github.com/yushyn-andriy/firefly/object"
+
+// The VM is the object.Env of the builtins it calls. They see the frame
+// that made the call.
+
+// Get looks name up in the locals and free variables of the current
+// frame, then in the globals.
+func (vm *VM) Get(name string) (object.Object, bool) {
+	frame := vm.currentFrame()
+	fn := frame.cl.Fn
+
+	for i := len(fn.LocalNames) - 1; i >= 0; i-- {
+		if fn.LocalNames[i] != name {
+			continue
+		}
+		if val := deref(vm.stack[frame.basePointer+i]); val != nil {
+			return val, true
+		}
+	}
+	for i, freeName := range fn.FreeNames {
+		if freeName == name && frame.cl.Free[i].Value != nil {
+			return frame.cl.Free[i].Value, true
+		}
+	}
+	for i, globalName := range vm.globalNames {
+		if globalName == name && vm.globals[i] != nil {
+			return vm.globals[i], true
+		}
+	}
+	return nil, false
+}
+
+// Method uses the self and class of the current frame, provided its
+// function was defined in a class body.
+func (vm *VM) Method() (object.Object, object.Object, bool) {
+	if !vm.currentFrame().cl.Fn.Method {
+		return nil, nil, false
+	}
+	self, okSelf := vm.Get("self")
+	cls, okCls := vm.Get(object.MAGIC_ATTR_CLASS)
+	return cls, self, okSelf && okCls
+}
+
+// Locals returns the variables of the current function, or the globals
+// at the top level.
+func (vm *VM) Locals() *object.Hash {
+	if vm.framesIndex == 1 {
+		return namedHash(vm.globalNames, vm.globals)
+	}
+
+	frame := vm.currentFrame()
+	numLocals := frame.cl.Fn.NumLocals
+	return namedHash(frame.cl.Fn.LocalNames, vm.stack[frame.basePointer:frame.basePointer+numLocals])
+}
+
+// Call calls fn with args and runs it to completion before returning
+// its result.
+func (vm *VM) Call(fn object.Object, args ...object.Object) object.Object {
+	sp, depth := vm.sp, vm.framesIndex
+
+	result, err := vm.call(fn, args, depth)
+	if err != nil {
+		vm.sp, vm.framesIndex = sp, depth
+		return asError(err)
+	}
+	return result
+}
+
+func (vm *VM) call(fn object.Object, args []object.Object, depth int) (object.Object, error) {
+	if err := vm.push(fn); err != nil {
+		return nil, err
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := vm.executeCall(len(args)); err != nil {
+		return nil, err
+	}
+	// functions compiled to bytecode leave a frame to run
+	if vm.framesIndex > depth {
+		if err := vm.run(depth); err != nil {
+			return nil, err
+		}
+	}
+	return vm.pop(), nil
+}
+
+func asError(err error) *object.Error {
+	if e, ok := err.(*object.Error); ok {
+		return e
+	}
+	return object.NewError(object.RuntimeError, "%s", err)
+}
+
+func deref(o object.Object) object.Object {
+	if cell, ok := o.(*object.Cell); ok {
+		return cell.Value
+	}
+	return o
+}
+
+// namedHash maps names to the values of the slots they name, leaving
+// out unset slots.
+func namedHash(names []string, slots []object.Object) *object.Hash {
+	pairs := map[object.HashKey]object.HashPair{}
+	for i, name := range names {
+		if i >= len(slots) {
+			break
+		}
+		val := deref(slots[i])
+		if val == nil {
+			continue
+		}
+		key := object.NewString(name)
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+	}
+	return &object.Hash{Pairs: pairs}
+}
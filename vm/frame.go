@@ -0,0 +1,39 @@
+package vm
+
+import (
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+// Frame is the activation of one function call. Its locals live on the
+// stack starting at basePointer.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// self is the receiver of a method call. When the frame runs the
+	// __init__ of a new instance, construct is set and the call results
+	// in self instead of the value __init__ returns.
+	self      object.Object
+	construct bool
+
+	// handlers are the try statements set up in the frame, innermost
+	// last
+	handlers []handler
+}
+
+// handler is where an error raised in a try block continues, and the
+// height the stack has there.
+type handler struct {
+	ip int
+	sp int
+}
+
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
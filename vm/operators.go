@@ -0,0 +1,112 @@
+package vm
+
+import (
+	"github.com/yushyn-andriy/firefly/code"
+	"github.com/yushyn-andriy/firefly/object"
+)
+
+// The operators themselves are in the object package, shared with the
+// evaluator, so that a program behaves the same in both engines. The VM
+// runs the magic methods of instances for them with Call.
+
+var binaryOperators = map[code.Opcode]string{
+	code.OpAdd:         "+",
+	code.OpSub:         "-",
+	code.OpMul:         "*",
+	code.OpDiv:         "/",
+	code.OpEqual:       "==",
+	code.OpNotEqual:    "!=",
+	code.OpGreaterThan: ">",
+	code.OpLessThan:    "<",
+
+	code.OpLessEqual:    "<=",
+	code.OpGreaterEqual: ">=",
+	code.OpMod:          "%",
+	code.OpPow:          "**",
+	code.OpFloorDiv:     "//",
+	code.OpBitAnd:       "&",
+	code.OpBitOr:        "|",
+	code.OpBitXor:       "^",
+	code.OpShiftLeft:    "<<",
+	code.OpShiftRight:   ">>",
+}
+
+func (vm *VM) executeBinaryOperation(op code.Opcode) error {
+	right := vm.pop()
+	left := vm.pop()
+
+	return vm.pushResult(object.Infix(binaryOperators[op], left, right, vm.Call))
+}
+
+// pushResult pushes the result of an operation, or returns it if it is
+// an error.
+func (vm *VM) pushResult(result object.Object) error {
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+	return vm.push(result)
+}
+
+var comparisons = map[code.Opcode]string{
+	code.OpLessThanJumpNotTruthy:    "<",
+	code.OpGreaterThanJumpNotTruthy: ">",
+	code.OpEqualJumpNotTruthy:       "==",
+	code.OpNotEqualJumpNotTruthy:    "!=",
+}
+
+// executeComparison pops two operands and compares them for one of the
+// compare-and-branch instructions, with a fast path for integers.
+func (vm *VM) executeComparison(op code.Opcode) (bool, error) {
+	right := vm.pop()
+	left := vm.pop()
+
+	operator := comparisons[op]
+	if l, ok := left.(*object.Integer); ok {
+		if r, ok := right.(*object.Integer); ok {
+			switch operator {
+			case "<":
+				return l.Value < r.Value, nil
+			case ">":
+				return l.Value > r.Value, nil
+			case "==":
+				return l.Value == r.Value, nil
+			case "!=":
+				return l.Value != r.Value, nil
+			}
+		}
+	}
+
+	return vm.isTruthy(object.Infix(operator, left, right, vm.Call))
+}
+
+func (vm *VM) executeUnaryOperation(operator string) error {
+	return vm.pushResult(object.Prefix(operator, vm.pop(), vm.Call))
+}
+
+func (vm *VM) executeIndexExpression(left, index object.Object) error {
+	return vm.pushResult(object.GetItem(left, index, vm.Call))
+}
+
+func (vm *VM) executeSetIndex(left, index, value object.Object) error {
+	if err, ok := object.SetItem(left, index, value, vm.Call).(*object.Error); ok {
+		return err
+	}
+	return nil
+}
+
+// isTruthy reports whether obj counts as true, running __bool__ for
+// instances. It keeps a nil *object.Error from becoming a non-nil error.
+func (vm *VM) isTruthy(obj object.Object) (bool, error) {
+	truthy, err := object.Truth(obj, vm.Call)
+	if err != nil {
+		return false, err
+	}
+	return truthy, nil
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
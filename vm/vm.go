@@ -3,30 +3,88 @@ package vm
 import (
 	"fmt"
 
+	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
 	"github.com/yushyn-andriy/firefly/code"
 	"github.com/yushyn-andriy/firefly/compiler"
 	"github.com/yushyn-andriy/firefly/object"
 )
 
 const StackSize = 2048
+const GlobalsSize = 65536
+const MaxFrames = 1024
+
+var (
+	NULL  = object.NULL
+	TRUE  = object.TRUE
+	FALSE = object.FALSE
+)
 
 type VM struct {
-	constants    []object.Object
-	instructions code.Instructions
+	constants []object.Object
+
+	// names of the global slots, used to report errors
+	globalNames []string
 
 	stack []object.Object
 	sp    int // Always points to the next value. Top of stack is stack[sp - 1]
+
+	globals []object.Object
+
+	frames      []*Frame
+	framesIndex int
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		SourceMap:    bytecode.SourceMap,
+		NumLocals:    bytecode.NumLocals,
+		LocalNames:   bytecode.Locals,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, MaxFrames)
+	frames[0] = mainFrame
+
 	return &VM{
-		instructions: bytecode.Instructions,
-		constants:    bytecode.Constants,
-		stack:        make([]object.Object, StackSize),
-		sp:           0,
+		constants:   bytecode.Constants,
+		globalNames: bytecode.Globals,
+
+		stack: make([]object.Object, StackSize),
+		// the locals of the top level live at the bottom of the stack
+		sp: bytecode.NumLocals,
+
+		globals: make([]object.Object, GlobalsSize),
+
+		frames:      frames,
+		framesIndex: 1,
 	}
 }
 
+// NewWithGlobalsStore creates a VM that shares s with earlier runs, so
+// that the REPL keeps its globals from one line to the next.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	vm := New(bytecode)
+	vm.globals = s
+	return vm
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	vm.frames[vm.framesIndex] = f
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -38,61 +96,467 @@ func (vm *VM) LastPoppedStackElem() object.Object {
 	return vm.stack[vm.sp]
 }
 
+// Run executes the bytecode. Errors raised by the program are returned
+// as *object.Error carrying the source position of the failing
+// instruction and the calls it unwound through.
 func (vm *VM) Run() error {
-	for ip := 0; ip < len(vm.instructions); ip++ {
-		op := code.Opcode(vm.instructions[ip])
+	return vm.run(0)
+}
+
+// run executes instructions until the frame at depth returns, or until
+// the program ends when depth is 0.
+func (vm *VM) run(depth int) error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
 
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		var err error
 		switch op {
 		case code.OpConstant:
-			constIndex := code.ReadUint16(vm.instructions[ip+1:])
-			ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err = vm.push(vm.constants[constIndex])
+
+		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv,
+			code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+			code.OpLessEqual, code.OpGreaterEqual, code.OpMod, code.OpPow, code.OpFloorDiv,
+			code.OpBitAnd, code.OpBitOr, code.OpBitXor, code.OpShiftLeft, code.OpShiftRight:
+			err = vm.executeBinaryOperation(op)
+
+		case code.OpTrue:
+			err = vm.push(TRUE)
+		case code.OpFalse:
+			err = vm.push(FALSE)
+		case code.OpNull:
+			err = vm.push(NULL)
 
-			err := vm.push(vm.constants[constIndex])
+		case code.OpBang:
+			err = vm.executeUnaryOperation("!")
+		case code.OpMinus:
+			err = vm.executeUnaryOperation("-")
+		case code.OpPlus:
+			err = vm.executeUnaryOperation("+")
+		case code.OpBitNot:
+			err = vm.executeUnaryOperation("~")
+
+		case code.OpJump:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip = pos - 1
+		case code.OpJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var truthy bool
+			truthy, err = vm.isTruthy(vm.pop())
+			if err == nil && !truthy {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var truthy bool
+			truthy, err = vm.isTruthy(vm.StackTop())
 			if err != nil {
-				return err
+				break
+			}
+			if truthy == (op == code.OpJumpTruthyOrPop) {
+				vm.currentFrame().ip = pos - 1
+			} else {
+				vm.pop()
 			}
-		case code.OpAdd:
+		case code.OpAnd, code.OpOr:
+			// only in bytecode compiled before and and or short-circuited,
+			// which keeps the meaning it was compiled with: true only for
+			// the operands that are true themselves
 			right := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
+			if op == code.OpAnd {
+				err = vm.push(nativeBoolToBooleanObject(TRUE == left && TRUE == right))
+			} else {
+				err = vm.push(nativeBoolToBooleanObject(TRUE == left || TRUE == right))
+			}
 
-			result := leftValue + rightValue
-			vm.push(&object.Integer{Value: result})
-		case code.OpSub:
-			right := vm.pop()
-			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
+		case code.OpLessThanJumpNotTruthy, code.OpGreaterThanJumpNotTruthy,
+			code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
 
-			result := leftValue - rightValue
-			vm.push(&object.Integer{Value: result})
-		case code.OpMul:
-			right := vm.pop()
+			var truthy bool
+			truthy, err = vm.executeComparison(op)
+			if err == nil && !truthy {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpAddLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			vm.currentFrame().ip += 3
+
+			frame := vm.currentFrame()
+			slot := &vm.stack[frame.basePointer+int(localIndex)]
+			val := *slot
+			cell, isCell := val.(*object.Cell)
+			if isCell {
+				val = cell.Value
+			}
+			if val == nil {
+				err = nameError(frame.cl.Fn.LocalNames, int(localIndex))
+				break
+			}
+			sum := object.Infix("+", val, vm.constants[constIndex], vm.Call)
+			if e, ok := sum.(*object.Error); ok {
+				// the source map has the addition one byte further on
+				if err := vm.unwind(ip+1, e, depth); err != nil {
+					return err
+				}
+				continue
+			}
+			if isCell {
+				cell.Value = sum
+			} else {
+				*slot = sum
+			}
+
+		case code.OpSetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			vm.globals[globalIndex] = vm.pop()
+		case code.OpGetGlobal:
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			val := vm.globals[globalIndex]
+			if val == nil {
+				err = nameError(vm.globalNames, int(globalIndex))
+				break
+			}
+			err = vm.push(val)
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			slot := &vm.stack[vm.currentFrame().basePointer+int(localIndex)]
+			if cell, ok := (*slot).(*object.Cell); ok {
+				cell.Value = vm.pop()
+			} else {
+				*slot = vm.pop()
+			}
+		case code.OpGetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			frame := vm.currentFrame()
+			val := vm.stack[frame.basePointer+int(localIndex)]
+			if cell, ok := val.(*object.Cell); ok {
+				val = cell.Value
+			}
+			if val == nil {
+				err = nameError(frame.cl.Fn.LocalNames, int(localIndex))
+				break
+			}
+			err = vm.push(val)
+
+		case code.OpGetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			cl := vm.currentFrame().cl
+			val := cl.Free[freeIndex].Value
+			if val == nil {
+				err = nameError(cl.Fn.FreeNames, int(freeIndex))
+				break
+			}
+			err = vm.push(val)
+		case code.OpSetFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			vm.currentFrame().cl.Free[freeIndex].Value = vm.pop()
+
+		case code.OpCaptureLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.captureLocal(int(localIndex)))
+		case code.OpCaptureFree:
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(vm.currentFrame().cl.Free[freeIndex])
+
+		case code.OpClosure:
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			vm.currentFrame().ip += 3
+
+			err = vm.pushClosure(int(constIndex), int(numFree))
+
+		case code.OpCall:
+			numArgs := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.executeCall(int(numArgs))
+
+		case code.OpCallKw:
+			numItems := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			err = vm.executeCallKw(numItems)
+		case code.OpSpread:
+			var array object.Object
+			array, err = vm.spread(vm.pop())
+			if err == nil {
+				err = vm.push(array)
+			}
+
+		case code.OpReturnValue:
+			returnValue := vm.pop()
+			if vm.framesIndex == 1 {
+				// return at the top level ends the program
+				return nil
+			}
+
+			err = vm.returnFrom(returnValue)
+			if err == nil && vm.framesIndex == depth {
+				return nil
+			}
+		case code.OpReturn:
+			if vm.framesIndex == 1 {
+				return nil
+			}
+
+			err = vm.returnFrom(NULL)
+			if err == nil && vm.framesIndex == depth {
+				return nil
+			}
+
+		case code.OpClass:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			numBases := int(code.ReadUint8(ins[ip+3:]))
+			vm.currentFrame().ip += 3
+
+			err = vm.pushClass(vm.constants[nameIndex], numBases)
+		case code.OpGetBuiltin:
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(builtins.Get(int(builtinIndex)))
+		case code.OpGetAttr:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			obj := vm.pop()
+			attr := obj.GetAttr(vm.constants[nameIndex].(*object.String).Value)
+			if e, ok := attr.(*object.Error); ok {
+				err = e
+				break
+			}
+			err = vm.push(attr)
+		case code.OpSetAttr:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			value := vm.pop()
+			obj := vm.pop()
+			res := obj.SetAttr(vm.constants[nameIndex].(*object.String).Value, value)
+			if e, ok := res.(*object.Error); ok {
+				err = e
+			}
+
+		case code.OpArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.buildArray(vm.sp-numElements, vm.sp)
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(array)
+		case code.OpHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var hash object.Object
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				break
+			}
+			vm.sp = vm.sp - numElements
+
+			err = vm.push(hash)
+		case code.OpExtendArray:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array := vm.stack[vm.sp-numElements-1].(*object.Array)
+			array.Elements = append(array.Elements, vm.stack[vm.sp-numElements:vm.sp]...)
+			vm.sp = vm.sp - numElements
+		case code.OpExtendHash:
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var pairs object.Object
+			pairs, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err != nil {
+				break
+			}
+			vm.sp = vm.sp - numElements
+
+			hash := vm.stack[vm.sp-1].(*object.Hash)
+			for key, pair := range pairs.(*object.Hash).Pairs {
+				hash.Pairs[key] = pair
+			}
+		case code.OpIndex:
+			index := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
 
-			result := leftValue * rightValue
-			vm.push(&object.Integer{Value: result})
-		case code.OpDiv:
-			right := vm.pop()
+			err = vm.executeIndexExpression(left, index)
+		case code.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
 			left := vm.pop()
-			leftValue := left.(*object.Integer).Value
-			rightValue := right.(*object.Integer).Value
 
-			result := leftValue / rightValue
-			vm.push(&object.Integer{Value: result})
+			err = vm.executeSetIndex(left, index, value)
+
 		case code.OpPop:
 			vm.pop()
+
+		case code.OpGetIter:
+			numVars := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.pushIterator(vm.pop(), int(numVars))
+		case code.OpForIter:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			element, ok := vm.StackTop().(*object.Iterator).Next()
+			if !ok {
+				vm.pop()
+				vm.currentFrame().ip = pos - 1
+				break
+			}
+			if e, ok := element.(*object.Error); ok {
+				err = e
+				break
+			}
+			err = vm.push(element)
+		case code.OpUnpack:
+			numVars := int(code.ReadUint8(ins[ip+1:]))
+			vm.currentFrame().ip += 1
+
+			err = vm.unpack(vm.pop(), numVars)
+
+		case code.OpModule:
+			nameIndex := code.ReadUint16(ins[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err = vm.push(vm.module(vm.constants[nameIndex]))
+		case code.OpGetException:
+			index := code.ReadUint8(ins[ip+1:])
+			vm.currentFrame().ip += 1
+
+			err = vm.push(object.Exceptions[index])
+
+		case code.OpSetupTry:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			frame.handlers = append(frame.handlers, handler{ip: pos, sp: vm.sp})
+		case code.OpPopTry:
+			frame := vm.currentFrame()
+			frame.handlers = frame.handlers[:len(frame.handlers)-1]
+		case code.OpThrow:
+			err = object.Throw(vm.pop())
+		case code.OpCatch:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			var caught bool
+			caught, err = catches(vm.pop(), vm.StackTop())
+			if err == nil && !caught {
+				vm.currentFrame().ip = pos - 1
+			}
+
+		default:
+			err = fmt.Errorf("opcode %d undefined", op)
+		}
+
+		if err != nil {
+			if err := vm.unwind(ip, err, depth); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
 }
 
+// unwind attributes err to the instruction at ip of the current frame,
+// unless it already knows where it was raised, and records the calls
+// made since the frame at depth in its stack, the way the evaluator does
+// while returning. When a try statement of one of those frames handles
+// err, it continues at the handler and unwind returns nil.
+func (vm *VM) unwind(ip int, err error, depth int) error {
+	e, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+
+	if !e.Pos.IsValid() {
+		e.Pos = vm.currentFrame().cl.Fn.SourceMap.Lookup(ip)
+	}
+	for i := vm.framesIndex - 1; i >= 0 && i >= depth; i-- {
+		frame := vm.frames[i]
+		if n := len(frame.handlers); n > 0 {
+			h := frame.handlers[n-1]
+			frame.handlers = frame.handlers[:n-1]
+			vm.framesIndex = i + 1
+			vm.sp = h.sp
+			frame.ip = h.ip - 1
+			return vm.push(object.NewException(e))
+		}
+		if i == 0 {
+			break
+		}
+
+		caller := vm.frames[i-1]
+		f := object.Frame{
+			Function: frame.cl.Fn.DisplayName(),
+			Pos:      caller.cl.Fn.SourceMap.Lookup(caller.ip),
+		}
+		if self, ok := frame.self.(*object.Instance); ok {
+			f.Class = self.Class().Name.Value
+		}
+		e.AddFrame(f)
+	}
+	return e
+}
+
+// returnFrom leaves the current frame and replaces the callee and its
+// arguments on the stack with the result of the call.
+func (vm *VM) returnFrom(returnValue object.Object) error {
+	frame := vm.popFrame()
+	vm.sp = frame.basePointer - 1
+
+	if frame.construct {
+		returnValue = frame.self
+	}
+	return vm.push(returnValue)
+}
+
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
-		return fmt.Errorf("stack overflow")
+		return stackOverflow()
 	}
 
 	vm.stack[vm.sp] = o
@@ -106,3 +570,429 @@ func (vm *VM) pop() object.Object {
 	vm.sp--
 	return o
 }
+
+// captureLocal returns the cell of a local of the current frame, moving
+// the variable into a new cell the first time it is captured.
+func (vm *VM) captureLocal(index int) *object.Cell {
+	slot := &vm.stack[vm.currentFrame().basePointer+index]
+	if cell, ok := (*slot).(*object.Cell); ok {
+		return cell
+	}
+
+	cell := &object.Cell{Value: *slot}
+	*slot = cell
+	return cell
+}
+
+// pushClosure makes a closure of the function constant at constIndex.
+// The stack holds its default values followed by the captured cells.
+func (vm *VM) pushClosure(constIndex, numFree int) error {
+	constant := vm.constants[constIndex]
+	function, ok := constant.(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", constant)
+	}
+
+	free := make([]*object.Cell, numFree)
+	for i := 0; i < numFree; i++ {
+		free[i] = vm.stack[vm.sp-numFree+i].(*object.Cell)
+	}
+	vm.sp = vm.sp - numFree
+
+	defaults := make([]object.Object, function.NumDefaults)
+	copy(defaults, vm.stack[vm.sp-function.NumDefaults:vm.sp])
+	vm.sp = vm.sp - function.NumDefaults
+
+	return vm.push(&object.Closure{Fn: function, Free: free, Defaults: defaults})
+}
+
+// pushClass creates the class named by name from the numBases classes on
+// top of the stack. Its body runs afterwards, as a call of the closure
+// below the bases.
+func (vm *VM) pushClass(name object.Object, numBases int) error {
+	className := name.(*object.String).Value
+	cls := object.NewClass(&ast.Identifier{Value: className}, nil, object.NewEnvironment())
+
+	if numBases > 0 {
+		bases := []*object.Class{}
+		for _, b := range vm.stack[vm.sp-numBases : vm.sp] {
+			base, ok := b.(*object.Class)
+			if !ok {
+				return object.NewError(object.TypeError, "class %s cannot inherit from %s",
+					className, b.Type())
+			}
+			bases = append(bases, base)
+		}
+		if err := cls.SetBases(bases...); err != nil {
+			return err
+		}
+		vm.sp = vm.sp - numBases
+	}
+
+	return vm.push(cls)
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs, nil)
+	case *object.BoundMethod:
+		return vm.callMethod(callee, numArgs)
+	case *object.Class:
+		return vm.instantiate(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs, nil)
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", callee.Type())
+	}
+}
+
+// callMethod calls the function bm wraps with bm.Self as its receiver.
+// Builtins get the receiver as their first argument.
+func (vm *VM) callMethod(bm *object.BoundMethod, numArgs int) error {
+	switch fn := bm.Fn.(type) {
+	case *object.Closure:
+		return vm.callClosure(fn, numArgs, bm.Self)
+	case *object.Builtin:
+		return vm.callBuiltin(fn, numArgs, bm.Self)
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", fn.Type())
+	}
+}
+
+// instantiate creates an instance of cls and runs its __init__ with the
+// arguments of the call.
+func (vm *VM) instantiate(cls *object.Class, numArgs int) error {
+	instance := cls.NewInstance()
+
+	init := instance.GetAttr(object.MAGIC_METHOD_INIT)
+	switch init := init.(type) {
+	case *object.BoundMethod:
+		if fn, ok := init.Fn.(*object.Closure); ok {
+			if err := vm.callClosure(fn, numArgs, instance); err != nil {
+				return err
+			}
+			vm.currentFrame().construct = true
+			return nil
+		}
+		if err := vm.callMethod(init, numArgs); err != nil {
+			return err
+		}
+		vm.stack[vm.sp-1] = instance
+		return nil
+	case *object.Error:
+		if numArgs > 0 {
+			return object.NewError(object.TypeError, "%s() takes no arguments", cls.Name.Value)
+		}
+	default:
+		return object.NewError(object.TypeError, "not a function: %s", init.Type())
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(instance)
+}
+
+// callBuiltin runs fn with the arguments on the stack and replaces them
+// and the callee with its result. The receivers of fn and of the bound
+// method it came from, if any, go first. Builtins do not get a frame.
+func (vm *VM) callBuiltin(fn *object.Builtin, numArgs int, self object.Object) error {
+	args := make([]object.Object, 0, numArgs+2)
+	if fn.Self != nil {
+		args = append(args, fn.Self)
+	}
+	if self != nil {
+		args = append(args, self)
+	}
+	args = append(args, vm.stack[vm.sp-numArgs:vm.sp]...)
+
+	env := fn.Env
+	if env == nil {
+		env = vm
+	}
+	result := fn.Fn(env, args...)
+	if err, ok := result.(*object.Error); ok {
+		return err
+	}
+
+	vm.sp = vm.sp - numArgs - 1
+	return vm.push(result)
+}
+
+// callClosure binds the numArgs arguments on the stack to the parameters
+// of cl and enters it. Missing arguments are taken from the defaults and
+// extra ones go to the rest parameter. Methods get self as well.
+func (vm *VM) callClosure(cl *object.Closure, numArgs int, self object.Object) error {
+	fn := cl.Fn
+
+	if err := checkArity(fn, numArgs); err != nil {
+		return err
+	}
+
+	required := fn.NumParameters - fn.NumDefaults
+	for i := numArgs; i < fn.NumParameters; i++ {
+		if err := vm.push(cl.Defaults[i-required]); err != nil {
+			return err
+		}
+	}
+
+	basePointer := vm.sp - numArgs
+	if numArgs < fn.NumParameters {
+		basePointer = vm.sp - fn.NumParameters
+	}
+	if fn.Rest {
+		rest := vm.buildArray(basePointer+fn.NumParameters, vm.sp)
+		vm.sp = basePointer + fn.NumParameters
+		if err := vm.push(rest); err != nil {
+			return err
+		}
+	}
+
+	return vm.enterClosure(cl, basePointer, self)
+}
+
+// enterClosure pushes a frame for cl, whose parameters are bound in the
+// stack slots from basePointer on.
+func (vm *VM) enterClosure(cl *object.Closure, basePointer int, self object.Object) error {
+	fn := cl.Fn
+
+	if vm.framesIndex >= MaxFrames || basePointer+fn.NumLocals >= StackSize {
+		return stackOverflow()
+	}
+
+	// locals start out unset, not with what earlier calls left there
+	for i := vm.sp; i < basePointer+fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	frame := NewFrame(cl, basePointer)
+	frame.self = self
+	if self != nil && fn.Method {
+		vm.stack[basePointer+fn.SelfIndex] = self
+	}
+	vm.pushFrame(frame)
+	vm.sp = basePointer + fn.NumLocals
+
+	return nil
+}
+
+// executeCallKw calls the function below the numItems stack items of
+// OpCallKw with the arguments they hold. Without keyword arguments the
+// call is made like OpCall makes it.
+func (vm *VM) executeCallKw(numItems int) error {
+	base := vm.sp - numItems
+	args := []object.Object{}
+	kwargs := []object.Keyword{}
+	for i := base; i < vm.sp; i++ {
+		switch item := vm.stack[i].(type) {
+		case *object.Array:
+			args = append(args, item.Elements...)
+		case *object.String:
+			kwargs = append(kwargs, object.Keyword{Name: item.Value, Value: vm.stack[i+1]})
+			i++
+		}
+	}
+	vm.sp = base
+
+	if len(kwargs) == 0 {
+		for _, arg := range args {
+			if err := vm.push(arg); err != nil {
+				return err
+			}
+		}
+		return vm.executeCall(len(args))
+	}
+
+	switch callee := vm.stack[base-1].(type) {
+	case *object.Closure:
+		return vm.bindClosure(callee, args, kwargs, nil)
+	case *object.BoundMethod:
+		if fn, ok := callee.Fn.(*object.Closure); ok {
+			return vm.bindClosure(fn, args, kwargs, callee.Self)
+		}
+		return object.NoKeywordArguments(callee.Fn)
+	case *object.Class:
+		instance := callee.NewInstance()
+		switch init := instance.GetAttr(object.MAGIC_METHOD_INIT).(type) {
+		case *object.BoundMethod:
+			fn, ok := init.Fn.(*object.Closure)
+			if !ok {
+				return object.NoKeywordArguments(init.Fn)
+			}
+			if err := vm.bindClosure(fn, args, kwargs, instance); err != nil {
+				return err
+			}
+			vm.currentFrame().construct = true
+			return nil
+		case *object.Error:
+			return object.NewError(object.TypeError, "%s() takes no arguments", callee.Name.Value)
+		default:
+			return object.NewError(object.TypeError, "not a function: %s", init.Type())
+		}
+	default:
+		return object.NoKeywordArguments(callee)
+	}
+}
+
+// bindClosure binds args and kwargs to the parameters of cl the way the
+// evaluator does and enters it. The callee is on top of the stack.
+func (vm *VM) bindClosure(cl *object.Closure, args []object.Object, kwargs []object.Keyword, self object.Object) error {
+	fn := cl.Fn
+
+	defaults := make([]object.Object, fn.NumParameters)
+	copy(defaults[fn.NumParameters-fn.NumDefaults:], cl.Defaults)
+	params := object.Parameters{
+		Function: fn.DisplayName(),
+		Names:    fn.LocalNames[:fn.NumParameters],
+		Defaults: defaults,
+		Rest:     fn.Rest,
+	}
+	values, rest, err := params.Bind(args, kwargs)
+	if err != nil {
+		return err
+	}
+
+	basePointer := vm.sp
+	for _, value := range values {
+		if err := vm.push(value); err != nil {
+			return err
+		}
+	}
+	if fn.Rest {
+		if err := vm.push(object.NewArray(rest)); err != nil {
+			return err
+		}
+	}
+	return vm.enterClosure(cl, basePointer, self)
+}
+
+// checkArity raises the errors the evaluator raises when a function is
+// given too many or too few arguments.
+func checkArity(fn *object.CompiledFunction, numArgs int) *object.Error {
+	if numArgs > fn.NumParameters && !fn.Rest {
+		return object.TooManyArguments(fn.DisplayName(), fn.NumParameters, numArgs)
+	}
+
+	required := fn.NumParameters - fn.NumDefaults
+	if numArgs < required {
+		return object.MissingArguments(fn.DisplayName(), fn.LocalNames[numArgs:required])
+	}
+	return nil
+}
+
+func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
+	elements := make([]object.Object, endIndex-startIndex)
+
+	for i := startIndex; i < endIndex; i++ {
+		elements[i-startIndex] = vm.stack[i]
+	}
+
+	return object.NewArray(elements)
+}
+
+func (vm *VM) buildHash(startIndex, endIndex int) (object.Object, error) {
+	hashedPairs := make(map[object.HashKey]object.HashPair)
+
+	for i := startIndex; i < endIndex; i += 2 {
+		key := vm.stack[i]
+		value := vm.stack[i+1]
+
+		pair := object.HashPair{Key: key, Value: value}
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, object.NewError(object.TypeError, "unusable as hash key: %s", key.Type())
+		}
+
+		hashedPairs[hashKey.HashKey()] = pair
+	}
+
+	return &object.Hash{Pairs: hashedPairs}, nil
+}
+
+// pushIterator pushes an iterator over collection for a for-in loop with
+// numVars variables.
+func (vm *VM) pushIterator(collection object.Object, numVars int) error {
+	if hash, ok := collection.(*object.Hash); ok && numVars == 2 {
+		return vm.push(hash.Items())
+	}
+	iter, err := object.GetIterator(collection, vm.Call)
+	if err != nil {
+		return err
+	}
+	return vm.push(iter)
+}
+
+// spread returns an array of the elements of the iterable of a spread
+// argument.
+func (vm *VM) spread(iterable object.Object) (object.Object, error) {
+	iter, err := object.GetIterator(iterable, vm.Call)
+	if err != nil {
+		return nil, err
+	}
+	elements := []object.Object{}
+	for {
+		element, ok := iter.Next()
+		if !ok {
+			return object.NewArray(elements), nil
+		}
+		if err, ok := element.(*object.Error); ok {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+}
+
+// unpack pushes the numVars elements of the array element, the first one
+// on top, for the variables of a for-in loop.
+func (vm *VM) unpack(element object.Object, numVars int) error {
+	arr, ok := element.(*object.Array)
+	if !ok || len(arr.Elements) != numVars {
+		return object.NewError(object.TypeError, "cannot unpack %s into %d variables",
+			element.Inspect(), numVars)
+	}
+	for i := numVars - 1; i >= 0; i-- {
+		if err := vm.push(arr.Elements[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// module makes the module called name of the variables of the current
+// frame, which runs the statements of the module.
+func (vm *VM) module(name object.Object) *object.Module {
+	literal := &ast.StringLiteral{Value: name.(*object.String).Value}
+	m := object.NewModule(literal, object.NewEnvironment())
+
+	frame := vm.currentFrame()
+	for i, local := range frame.cl.Fn.LocalNames {
+		if val := deref(vm.stack[frame.basePointer+i]); val != nil {
+			m.SetAttr(local, val)
+		}
+	}
+	return m
+}
+
+// catches reports whether a catch clause for cls takes exception.
+func catches(cls, exception object.Object) (bool, error) {
+	c, ok := cls.(*object.Class)
+	if !ok {
+		return false, object.NewError(object.TypeError,
+			"catching classes that do not derive from Exception is not allowed, got %s",
+			cls.Type())
+	}
+	return exception.(*object.Exception).Err.IsInstance(c), nil
+}
+
+func nameError(names []string, index int) *object.Error {
+	name := "<unknown>"
+	if index < len(names) {
+		name = names[index]
+	}
+	return object.NewError(object.NameError, "identifier not found: %s", name)
+}
+
+func stackOverflow() *object.Error {
+	return object.NewError(object.RecursionError, "stack overflow")
+}
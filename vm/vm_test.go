@@ -1,10 +1,15 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/yushyn-andriy/firefly/ast"
+	"github.com/yushyn-andriy/firefly/builtins"
+	"github.com/yushyn-andriy/firefly/code"
 	"github.com/yushyn-andriy/firefly/compiler"
 	"github.com/yushyn-andriy/firefly/lexer"
 	"github.com/yushyn-andriy/firefly/object"
@@ -76,6 +81,75 @@ func testExpectedObject(
 		if err != nil {
 			t.Errorf("testIntegerObject failed: %s", err)
 		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			t.Errorf("object is not Float %f. got=%T (%+v)", expected, actual, actual)
+		}
+	case bool:
+		if actual != nativeBoolToBooleanObject(expected) {
+			t.Errorf("object is not %t. got=%T (%+v)", expected, actual, actual)
+		}
+	case string:
+		result, ok := actual.(*object.String)
+		if !ok || result.Value != expected {
+			t.Errorf("object is not String %q. got=%T (%+v)", expected, actual, actual)
+		}
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			if err := testIntegerObject(int64(el), array.Elements[i]); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case []interface{}:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+		for i, el := range expected {
+			testExpectedObject(t, el, array.Elements[i])
+		}
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. got=%T (%+v)", actual, actual)
+			return
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of pairs. want=%d, got=%d",
+				len(expected), len(hash.Pairs))
+			return
+		}
+		for key, value := range expected {
+			pair, ok := hash.Pairs[key]
+			if !ok {
+				t.Errorf("no pair for given key in pairs")
+				continue
+			}
+			if err := testIntegerObject(value, pair.Value); err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case *object.Null:
+		if actual != NULL {
+			t.Errorf("object is not Null: %T (%+v)", actual, actual)
+		}
 	}
 }
 
@@ -84,7 +158,700 @@ func TestIntegerArithmetic(t *testing.T) {
 		{"1", 1},
 		{"2", 2},
 		{"1 + 2", 3},
+		{"4 / 2 * 3 - 1", 5},
+		{"-5 + 10", 5},
+		{"1.5 + 1.5", 3.0},
+		{"-2.5", -2.5},
+		{"-7 % 3", 2},
+		{"-7 // 2", -4},
+		{"2 ** 3 ** 2", 512},
+		{"2 ** -1", 0.5},
+		{"-7.5 % 2.0", 0.5},
+		{"6 & 3 | 8 ^ 1", 11},
+		{"~5 + +1", -5},
+		{"1 << 4 >> 2", 4},
+		{"1 + 2.5", 3.5},
+		{"9223372036854775807 + 1 - 10", 9223372036854775798},
+		{"let i = 9223372036854775807; i = i + 1; i - 1", 9223372036854775807},
+		{"2 ** 64 // 2 ** 62", 4},
+		{`int(decimal("2.50") * 4)`, 10},
+		{"3 / 2.0", 1.5},
+		{"let i = 0.5; i = i + 1; i", 1.5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 == 1", true},
+		{"1.5 < 2.5", true},
+		{"1 <= 1", true},
+		{"2.5 >= 3.5", false},
+		{"1 == 1.0", true},
+		{"2 ** 64 > 9223372036854775807", true},
+		{`decimal("0.1") + decimal("0.2") == decimal("0.3")`, true},
+		{"if (2 ** 64 == 18446744073709551616) { true }", true},
+		{"if (2 > 1.5) { true }", true},
+		{"true != false", true},
+		{`"a" == "a"`, true},
+		{"!true", false},
+		{"!5", false},
+		{"true and false", false},
+		{"true or 1", true},
+		{"!0", true},
+		{`!""`, true},
+		{"![]", true},
+		{"!{}", true},
+		{"!(if (false) { 5; })", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", NULL},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { let a = 5; }", NULL},
+		{"if (0) { 10 } else { 20 }", 20},
+		{`if ("") { 10 } else { 20 }`, 20},
+		{"if ([]) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", NULL},
+		{"true ? 1 : 2", 1},
+		{"0 ? 1 : 2", 2},
+		{"1 > 2 ? 1 : 2 > 1 ? 3 : 4", 3},
+		{"let f = fn(n) { return n < 0 ? -n : n; }; f(-5) + f(5)", 10},
+		{"let max = fn(a, b) { a > b ? a : b }; max(3, max(7, 4))", 7},
+		{`{"k": 1 < 2 ? 5 : 6}["k"]`, 5},
+		{"let n = 0; let f = fn() { n = n + 1; n }; true ? f() : f(); n", 1},
+		{"1 ? 2 : 1 / 0", 2},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	// calls counts the calls of f, to see which operands are evaluated
+	prelude := "let calls = 0; let f = fn(v) { calls = calls + 1; v };\n"
+	tests := []vmTestCase{
+		{"1 and 2", 2},
+		{"0 and 2", 0},
+		{"1 or 2", 1},
+		{"0 or 2", 2},
+		{`"" or "x"`, "x"},
+		{`"a" and "b"`, "b"},
+		{"[] or 3", 3},
+		{"{} or 4", 4},
+		{"(if (false) { 1 }) or 5", 5},
+		{"(if (false) { 1 }) and 5", NULL},
+		{"0 and f(1); calls", 0},
+		{"1 or f(1); calls", 0},
+		{"1 and f(1); calls", 1},
+		{"0 or f(1); calls", 1},
+		{"f(0) and f(1) and f(2); calls", 1},
+		{"f(0) or f(1) or f(2); calls", 2},
+		{"let x = if (false) { 1 }; x and x.f()", NULL},
+		{"if (0 or []) { 1 } else { 2 }", 2},
+		{`if ("a" and 1) { 1 } else { 2 }`, 1},
+		{"let g = fn(a, b) { a or b }; g(0, 7)", 7},
+	}
+	for i := range tests {
+		tests[i].input = prelude + tests[i].input
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let a = 1; a = a + 1; a", 2},
+		{"let x = 1; for (let x = 10; x < 11; x = x + 1) { x = 20; }; x", 1},
+		{"let x = 1; for (let i = 0; i < 3; i = i + 1) { x = x + i; }; x", 4},
+		{"if (true) { let inner = 7; }; inner", 7},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let n = 0; while (n < 5) { n = n + 1; }; n", 5},
+		{"let n = 0; while (true) { n = n + 1; if (n == 3) { break; } }; n", 3},
+		{"let s = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 2) { continue; } s = s + i; }; s", 43},
+		{"let s = 0; for (;;) { s = s + 1; if (s > 4) { break; } }; s", 5},
+		{`let s = 0;
+		for (let i = 0; i < 3; i = i + 1) {
+			for (let j = 0; j < 3; j = j + 1) {
+				if (j == 1) { break; }
+				s = s + 1;
+			}
+		};
+		s`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestForInLoops(t *testing.T) {
+	tests := []vmTestCase{
+		{"let s = 0; for (x in [1, 2, 3]) { s = s + x; }; s", 6},
+		{`let s = ""; for (c in "abc") { s = c + s; }; s`, "cba"},
+		{"let s = 0; for (x in range(5)) { if (x == 1) { continue; } if (x == 4) { break; } s = s + x; }; s", 5},
+		{"let s = 0; for (k, v in {1: 2, 3: 4}) { s = s + k * v; }; s", 14},
+		{`let s = ""; for (k in {99999999999999999999: 0, 1: 0, 18446744073709551616: 0, -2: 0}) { s = s + string(k) + " "; }; s`, "-2 1 18446744073709551616 99999999999999999999 "},
+		{"let s = 0; for (a, b in [[1, 2], [3, 4]]) { s = s + a - b; }; s", -2},
+		{"let x = 0; for (x in [7, 8]) { }; x", 8},
+		{"fn f() { for (x in [1, 2, 3]) { if (x == 2) { return x; } } }; f()", 2},
+		{"fn f() { let s = 0; for (x in [1, 2]) { for (y in [10, 20]) { if (y == 20) { break; } s = s + x * y; } } s }; f()", 30},
+		{`class R { fn __init__() { self.n = 0; }
+			fn __iter__() { self }
+			fn __next__() { self.n = self.n + 1; if (self.n > 3) { throw StopIteration; } self.n } };
+		let s = 0; for (x in R()) { s = s + x; }; s`, 6},
+		{"let n = 0; for (i in range(5000)) { for (x in [1]) { continue; } n = n + 1; }; n", 5000},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestTryStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let r = 0; try { r = 1; } catch { r = 2; }; r", 1},
+		{"let r = 0; try { 1 / 0; } catch { r = 2; }; r", 2},
+		{`let r = ""; try { throw "oops"; } catch (e) { r = e.message; }; r`, "oops"},
+		{`let r = ""; try { [][1]; } catch (KeyError e) { r = "key"; } catch (LookupError e) { r = e.type; }; r`, "IndexError"},
+		{`class E(Exception) { }; let r = ""; try { throw E("m"); } catch (E e) { r = e.message; }; r`, "m"},
+		{"let r = 0; try { try { 1 / 0; } catch (TypeError e) { r = 1; } } catch (e) { r = 2; }; r", 2},
+		{"let r = 0; try { try { throw 1; } catch (e) { throw e; } } catch (e) { r = e.message; }; r", "1"},
+		{`let r = ""; try { r = r + "1"; } finally { r = r + "2"; }; r`, "12"},
+		{`let r = ""; try { try { throw 1; } finally { r = r + "1"; } } catch { r = r + "2"; }; r`, "12"},
+		{`let r = ""; fn f() { try { return "1"; } finally { r = r + "2"; } }; r + f() + r`, "12"},
+		{"fn f() { try { return 1; } finally { return 2; } }; f()", 2},
+		{"fn f() { try { throw 1; } finally { return 2; } }; f()", 2},
+		{"fn f() { try { 1 / 0; } catch { return 3; } finally { 4; } }; f()", 3},
+		{"let n = 0; while (n < 5) { try { n = n + 1; continue; } finally { n = n + 10; } }; n", 11},
+		{"let n = 0; for (x in [1, 2, 3]) { try { if (x == 2) { break; } } finally { n = n + x; } }; n", 3},
+		{"let n = 0; for (i in range(5000)) { try { throw i; } finally { n = n + 1; continue; } }; n", 5000},
+		{"let n = 0; for (i in range(5000)) { try { throw i; } catch { n = n + 1; } }; n", 5000},
+		{"fn f(n) { if (n == 0) { throw \"done\"; } f(n - 1) }; let r = \"\"; try { f(10); } catch (e) { r = e.message; }; r", "done"},
+		{`class A { fn __len__() { throw "in len"; } }; let r = ""; try { r = len(A()); } catch (e) { r = e.message; }; r`, "in len"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestImport(t *testing.T) {
+	chdir(t, "..")
+
+	tests := []vmTestCase{
+		{`import "math"; math.factorial(5)`, 120},
+		{`import "math"; math.PI > 3`, true},
+		{`import "string"; string.capwords("a b")`, "A B"},
+		{`fn f() { import "math"; math.factorial(3) }; f()`, 6},
+		{`let r = ""; try { import "missing"; } catch (ImportError e) { r = e.type; }; r`, "ImportError"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringsArraysAndHashes(t *testing.T) {
+	tests := []vmTestCase{
+		{`"fire" + "fly"`, "firefly"},
+		{`"ab" * 2`, "abab"},
+		{`2 * "ab"`, "abab"},
+		{`"ab" * -2`, ""},
+		{"[]", []int{}},
+		{"[1 + 2, 3 * 4]", []int{3, 12}},
+		{"{}", map[object.HashKey]int64{}},
+		{"{1: 2, 2 + 2: 3 * 3}", map[object.HashKey]int64{
+			(&object.Integer{Value: 1}).HashKey(): 2,
+			(&object.Integer{Value: 4}).HashKey(): 9,
+		}},
+		{"[1, 2, 3][1]", 2},
+		{`"abc"[2]`, "c"},
+		{"{1: 1, 2: 2}[2]", 2},
+		{"let a = [1, 2]; a[0] = 5; a", []int{5, 2}},
+		{`let h = {}; h["k"] = 3; h["k"]`, 3},
+	}
+
+	// literals larger than the stack are built in chunks
+	elements := make([]string, 3000)
+	pairs := make([]string, 3000)
+	for i := range elements {
+		elements[i] = fmt.Sprint(i)
+		pairs[i] = fmt.Sprintf("%d: %d", i, i)
+	}
+	tests = append(tests,
+		vmTestCase{"let a = [" + strings.Join(elements, ", ") + "]; len(a) + a[0] + a[2999]", 5999},
+		vmTestCase{"let h = {" + strings.Join(pairs, ", ") + "}; h[0] + h[256] + h[2999]", 3255},
+	)
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedClass *object.Class
+		expectedError string
+		expectedLine  int
+	}{
+		{"1 + true", object.TypeError, "type mismatch: INTEGER + BOOLEAN", 1},
+		{"true + false", object.TypeError, "unknown operator: BOOLEAN + BOOLEAN", 1},
+		{"-true", object.TypeError, "unknown operator: -BOOLEAN", 1},
+		{"let a = 1;\n1 / 0", object.ZeroDivisionError, "integer division by zero", 2},
+		{"5 % 0", object.ZeroDivisionError, "integer modulo by zero", 1},
+		{"1.0 / 0", object.ZeroDivisionError, "float division by zero", 1},
+		{"2 ** 64 / 0", object.ZeroDivisionError, "integer division by zero", 1},
+		{"1 << 10000000", object.OverflowError, "integer is too large", 1},
+		{`decimal(1) % 0`, object.ZeroDivisionError, "decimal modulo by zero", 1},
+		{"[1][2 ** 64]", object.IndexError, "index out of range: 18446744073709551616", 1},
+		{"1 >> -1", object.ValueError, "negative shift count", 1},
+		{"~true", object.TypeError, "unknown operator: ~BOOLEAN", 1},
+		{"[1][5]", object.IndexError, "index out of range: 5", 1},
+		{"{}[1]", object.KeyError, "key does not exists: 1", 1},
+		{"{[1]: 2}", object.TypeError, "unusable as hash key: ARRAY", 1},
+		{"1[0]", object.TypeError, "index operator not supported: INTEGER", 1},
+		{"let x = 1;\nfoo", object.NameError, "identifier not found: foo", 2},
+		{"for (;;) { if (true) { break; }; let late = 1; }; late", object.NameError, "identifier not found: late", 1},
+		{"1()", object.TypeError, "not a function: INTEGER", 1},
+		{"let f = fn(a) { a };\nf(1, 2)", object.TypeError, "<anonymous>() takes 1 positional argument but 2 were given", 2},
+		{"fn f(a, b, c = 3) { a };\nf()", object.TypeError, "f() missing 2 required arguments: 'a', 'b'", 2},
+		{"fn() { 1 }(1)", object.TypeError, "<anonymous>() takes 0 positional arguments but 1 was given", 1},
+		{"let f = fn() { y };\nf()", object.NameError, "identifier not found: y", 1},
+		{"let f = fn() { f() };\nf()", object.RecursionError, "stack overflow", 1},
+		{"let f = fn(n) { [n, n, n, n, n, n, n, n, n, n, f(n + 1)] };\nf(1)", object.RecursionError, "stack overflow", 1},
+		{"class B { fn __bool__() { return 1; } };\nif (B()) { 1 }", object.TypeError, "__bool__ should return BOOLEAN, returned INTEGER", 2},
+		{"class E { };\nE() + 1", object.TypeError, "type mismatch: INSTANCE + INTEGER", 2},
+		{"class E { fn __add__(o) { o[1] } };\nE() + []", object.IndexError, "index out of range: 1", 1},
+		{"let f = fn(a) { a };\nf(1, b: 2)", object.TypeError, "<anonymous>() got an unexpected keyword argument 'b'", 2},
+		{"let f = fn(a) { a };\nf(1, a: 2)", object.TypeError, "<anonymous>() got multiple values for argument 'a'", 2},
+		{"len(x: 1)", object.TypeError, "len() takes no keyword arguments", 1},
+		{`"abc".upper(1)`, object.TypeError, "wrong number of arguments. got=1, want=0", 1},
+		{"class E { };\nE(x: 1)", object.TypeError, "E() takes no arguments", 2},
+		{"let f = fn(a) { a };\nf(...1)", object.TypeError, "'INTEGER' object is not iterable", 2},
+		{"class A { };\nA(1)", object.TypeError, "A() takes no arguments", 2},
+		{"class A { fn __init__(a) { } };\nA()", object.TypeError, "__init__() missing 1 required argument: 'a'", 2},
+		{"class A { };\nA().b", object.AttributeError, "type object 'A' has no attribute 'b'", 2},
+		{"class A { fn f() { self } };\nA.f()", object.NameError, "identifier not found: self", 1},
+		{"class B(1) { }", object.TypeError, "class B cannot inherit from INTEGER", 1},
+		{"class P { fn m() { 1 } };\nclass Q(P) { fn m() { let f = fn() { super().m() }; f() } };\nQ().m()",
+			object.RuntimeError, "super(): no arguments outside a method", 2},
+		{"len(1)", object.TypeError, "argument to `len` not supported, got INTEGER", 1},
+		{"class A { fn __len__() { [][0] } };\nlen(A())", object.IndexError, "index out of range: 0", 1},
+		{"for (x in 1) { }", object.TypeError, "'INTEGER' object is not iterable", 1},
+		{"for (a, b in [1]) { }", object.TypeError, "cannot unpack 1 into 2 variables", 1},
+		{"try { 1 / 0; } catch (1 e) { }", object.TypeError,
+			"catching classes that do not derive from Exception is not allowed, got INTEGER", 1},
+		{"try {\n1 / 0;\n} catch (TypeError e) { }", object.ZeroDivisionError, "integer division by zero", 2},
+		{"try { 1; } finally {\nthrow \"f\"; }", object.ExceptionClass, "f", 2},
+		{"try { throw 1; } finally {\n[][0]; }", object.IndexError, "index out of range: 0", 2},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := compiler.New()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Errorf("expected a runtime error for %q, got %v", tt.input, err)
+			continue
+		}
+		if errObj.Class != tt.expectedClass || errObj.Message != tt.expectedError {
+			t.Errorf("wrong error for %q. want=%s: %q, got=%s: %q", tt.input,
+				tt.expectedClass.Name.Value, tt.expectedError, errObj.TypeName(), errObj.Message)
+		}
+		if errObj.Pos.Line != tt.expectedLine {
+			t.Errorf("wrong error line for %q. want=%d, got=%d", tt.input, tt.expectedLine, errObj.Pos.Line)
+		}
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let five = fn() { 5 }; five()", 5},
+		{"let one = fn() { 1 }; let two = fn() { one() + one() }; two()", 2},
+		{"let early = fn() { return 99; 100 }; early()", 99},
+		{"let empty = fn() { }; empty()", NULL},
+		{"let sum = fn(a, b) { let c = a + b; c }; sum(1, 2) + sum(3, 4)", 10},
+		{"let g = 10; let f = fn(a) { let g = a; g * 2 }; f(3) + g", 16},
+		{"fn twice(f, x) { f(f(x)) }; twice(fn(x) { x * 3 }, 2)", 18},
+		{"let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(15)", 610},
 	}
 
 	runVmTests(t, tests)
 }
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{"let f = fn(a, b = 2) { a * 10 + b }; f(1)", 12},
+		{"let f = fn(a, b = 2) { a * 10 + b }; f(1, 5)", 15},
+		{"let d = 4; let f = fn(a = d) { a }; d = 5; f()", 4},
+		{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []int{2, 3}},
+		{"let f = fn(a, b = 7, ...rest) { rest }; f(1)", []int{}},
+		{"let f = fn(a, b = 7, ...rest) { a * 10 + b }; f(1, 2, 3)", 12},
+		{"let f = fn(a, b = 2) { a * 10 + b }; f(b: 5, a: 1)", 15},
+		{"let f = fn(a, b = 2, c = 3) { a * 100 + b * 10 + c }; f(1, c: 9)", 129},
+		{"let f = fn(a, ...rest) { rest }; f(...[1, 2, 3])", []int{2, 3}},
+		{"let f = fn(a, b, ...rest) { a * 10 + b }; f(1, ...[2], ...range(3))", 12},
+		{"let f = fn(a, ...rest) { rest }; f(a: 1, ...[])", []int{}},
+		{"class P { fn __init__(x, y = 0) { self.s = x * 10 + y; } }; P(y: 2, x: 3).s", 32},
+		{"class P { fn m(k = 1) { 2 * k } }; P().m(k: 5)", 10},
+		{`len(...["abc"])`, 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{"let newClosure = fn(a) { fn() { a } }; let closure = newClosure(99); closure()", 99},
+		{"let adder = fn(a) { fn(b) { fn(c) { a + b + c } } }; adder(1)(2)(3)", 6},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1; c } }; let f = counter(); f(); f(); f()", 3},
+		{"let counter = fn() { let c = 0; fn() { c = c + 1; c } }; let f = counter(); let g = counter(); f(); f(); g()", 1},
+		{"let outer = fn() { let x = 1; let get = fn() { x }; x = 5; get() }; outer()", 5},
+		{"let pair = fn() { let n = 0; [fn() { n = n + 1 }, fn() { n }] }; let p = pair(); p[0](); p[0](); p[1]()", 2},
+		{"let fs = [0, 0]; for (let i = 0; i < 2; i = i + 1) { fs[i] = fn() { i }; }; fs[0]()", 2},
+		{"let f = fn() { let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) }; countDown(5) }; f()", 0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFactorial(t *testing.T) {
+	source, err := os.ReadFile("../lib/math.fl")
+	if err != nil {
+		t.Fatalf("could not read lib/math.fl: %s", err)
+	}
+
+	runVmTests(t, []vmTestCase{
+		{string(source) + "\nfactorial(10)", 3628800},
+		{string(source) + "\nfactorial(0)", 1},
+	})
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	input := `fn inner(a) {
+  return a[3];
+}
+fn middle(a) { return inner(a); };
+fn outer() {
+  return middle([1, 2]);
+}
+outer();`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	err := New(comp.Bytecode()).Run()
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", err, err)
+	}
+
+	expected := `Traceback (most recent call last):
+  File "<stdin>", line 8, column 6, in <module>
+  File "<stdin>", line 6, column 16, in outer
+  File "<stdin>", line 4, column 28, in middle
+  File "<stdin>", line 2, column 11, in inner
+IndexError: index out of range: 3
+`
+	if errObj.Traceback() != expected {
+		t.Errorf("wrong traceback.\nwant=%q\ngot=%q", expected, errObj.Traceback())
+	}
+}
+
+func TestClasses(t *testing.T) {
+	class := `class Hello {
+    fn __init__(arg) { self.arg = arg; };
+    fn set_name(name) { self.name = name; };
+    fn get_name() { return self.name; };
+    fn sum(a) { if (a == 0) { return 0; } return a + self.sum(a - 1); };
+};
+`
+	tests := []vmTestCase{
+		{class + `h = Hello("x"); h.set_name("Svitlana"); h.get_name()`, "Svitlana"},
+		{class + `h = Hello("x"); h.sum(5)`, 15},
+		{class + `h = Hello(7); h.arg`, 7},
+		{class + `h = Hello(7); h.__name__`, "Hello"},
+		{class + `h = Hello(7); m = h.sum; m(3)`, 6},
+		{class + `h = Hello(7); h.arg = 8; h.arg`, 8},
+		{"class A { x = 1; fn get() { x } }; A().get()", 1},
+		{"class A { fn f() { 1 } }; class B(A) { fn g() { self.f() + 1 } }; B().g()", 2},
+		{"class A { fn f() { 1 } }; class B(A) { fn f() { 2 } }; B().f()", 2},
+		{"let make = fn(n) { class C { fn get() { n } }; C }; let C = make(4); C().get()", 4},
+		{"class Empty { }; let e = Empty(); e.a = 3; e.a", 3},
+		{`"a-b".split("-")[1]`, "b"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestMagicMethods(t *testing.T) {
+	class := `class Z {
+    fn __init__(v) { self.v = v; };
+    fn __bool__() { return self.v != 0; };
+    fn __add__(o) { return self.v + o; };
+    fn __radd__(o) { return o - self.v; };
+    fn __eq__(o) { return self.v == o; };
+    fn __lt__(o) { return self.v < o; };
+    fn __neg__() { return Z(-self.v); };
+    fn __getitem__(i) { return self.v * i; };
+    fn __setitem__(i, x) { self.v = i + x; };
+};
+`
+	tests := []vmTestCase{
+		{class + "if (Z(0)) { 1 } else { 2 }", 2},
+		{class + "if (Z(3)) { 1 } else { 2 }", 1},
+		{class + "!Z(0)", true},
+		{class + "Z(0) ? 1 : 2", 2},
+		{class + "let n = 0; let z = Z(3); while (z) { z = Z(z.v - 1); n = n + 1; }; n", 3},
+		{class + "Z(2) + 40", 42},
+		{class + "10 + Z(3)", 7},
+		{class + "Z(2) == 2", true},
+		{class + "Z(2) != 2", false},
+		{class + "Z(2) < 3", true},
+		{class + "3 > Z(2)", true},
+		{class + "(-Z(2)).v", -2},
+		{class + "Z(3)[4]", 12},
+		{class + "let z = Z(0); z[1] = 2; z.v", 3},
+		{class + "let z = Z(1); z = z + 1; z", 2},
+		{class + "Z(1) and 5", 5},
+		{class + "Z(0) or 5", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`first([7, 8])`, 7},
+		{`let len = fn(x) { 0 }; len("four")`, 0},
+		{`let f = fn(a) { let b = 2; locals() }; f(1)["b"]`, 2},
+		{`let g = 5; locals()["g"]`, 5},
+		{"class A { fn __len__() { 3 } }; len(A())", 3},
+		{"class A { fn f() { 1 } }; class B(A) { fn f() { super().f() + 1 } }; B().f()", 2},
+		{"class A { }; class B(A) { }; [isinstance(B(), A), issubclass(A, B)]", []interface{}{true, false}},
+		{`class A { fn __str__() { "a" } }; string(A())`, "a"},
+		{`getattr("a-b", "split")("-")[0]`, "a"},
+		{`string(2 ** 64)`, "18446744073709551616"},
+		{`string(decimal("3.30"))`, "3.30"},
+		{`fn f() { }; f.__doc__ = "d"; f.__doc__`, "d"},
+	}
+
+	runVmTests(t, tests)
+}
+
+// TestFunctionType checks that closures are functions to programs, as
+// the functions of the evaluator are.
+func TestFunctionType(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse("type(fn() { })")); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if got := vm.LastPoppedStackElem().Inspect(); got != object.FUNCTION_OBJ {
+		t.Errorf("wrong type. want=%s, got=%s", object.FUNCTION_OBJ, got)
+	}
+}
+
+func TestPrintBuiltins(t *testing.T) {
+	var out bytes.Buffer
+	builtins.SetStd(&out, &out)
+	defer builtins.SetStd(os.Stdout, os.Stderr)
+
+	input := `class P { fn __repr__() { "P()" } };
+println("n:", 1, [P()]);
+fn show(x) { print(x, "") };
+show(2.5);`
+
+	runVmTests(t, []vmTestCase{{input, NULL}})
+
+	expected := "n: 1 [P()]\n2.5 "
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
+
+func TestRunDecodedBytecode(t *testing.T) {
+	input := `class Counter {
+  fn __init__(n) { self.n = n; };
+  fn next(step = 1) { self.n = self.n + step; self.n };
+};
+let c = Counter(40);
+c.next();
+c.next()`
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := comp.Bytecode().Encode(&buf); err != nil {
+		t.Fatalf("encode failed: %s", err)
+	}
+	bytecode, err := compiler.Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode failed: %s", err)
+	}
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 42, vm.LastPoppedStackElem())
+}
+
+// TestLegacyLogicalOperators runs OpAnd and OpOr, which compilers no
+// longer emit but bytecode files of the same version may still hold.
+func TestLegacyLogicalOperators(t *testing.T) {
+	tests := []struct {
+		left, right code.Opcode
+		op          code.Opcode
+		expected    bool
+	}{
+		{code.OpTrue, code.OpTrue, code.OpAnd, true},
+		{code.OpTrue, code.OpFalse, code.OpAnd, false},
+		{code.OpTrue, code.OpConstant, code.OpAnd, false},
+		{code.OpConstant, code.OpConstant, code.OpAnd, false},
+		{code.OpFalse, code.OpTrue, code.OpOr, true},
+		{code.OpFalse, code.OpFalse, code.OpOr, false},
+		{code.OpConstant, code.OpFalse, code.OpOr, false},
+		{code.OpConstant, code.OpConstant, code.OpOr, false},
+	}
+
+	for _, tt := range tests {
+		var ins code.Instructions
+		for _, operand := range []code.Opcode{tt.left, tt.right} {
+			if operand == code.OpConstant {
+				ins = append(ins, code.Make(operand, 0)...)
+			} else {
+				ins = append(ins, code.Make(operand)...)
+			}
+		}
+		ins = append(ins, code.Make(tt.op)...)
+		ins = append(ins, code.Make(code.OpPop)...)
+
+		vm := New(&compiler.Bytecode{
+			Instructions: ins,
+			Constants:    []object.Object{&object.Integer{Value: 1}},
+		})
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+	}
+}
+
+// TestPeephole runs programs with and without the peephole optimizer and
+// checks that they end with the same value or the same traceback.
+func TestPeephole(t *testing.T) {
+	tests := []string{
+		"let s = 0; for (let i = 0; i < 10; i = i + 1) { if (i == 3) { continue; } s = s + i; } s",
+		"let n = 0; while (n != 5) { n = n + 1; } n",
+		"fn f(n) { if (n > 1) { return n * f(n - 1); } return 1; 0 }; f(5)",
+		"fn f(a) { a = a; a = a + 0.5; a }; f(1.0)",
+		"fn f(a) { a = a + 1; a };\nf(\"s\")",
+		"fn f() { if (false) { let i = 0; }\n  i = i + 1; };\nf()",
+		"fn f() { let x = 1; let g = fn() { x = x + 1; }; g(); g(); x }; f()",
+		"let x = 1;\nif (x < \"a\") { 1 }",
+		"fn f(x) { while (x > \"a\") { } };\nf(1)",
+		"1; 2; 3",
+		"fn f() { let s = 0; for (x in [1, 2, 3]) { if (x == 2) { continue; } s = s + x; } s }; f()",
+		"fn f() { try { return 1; } finally { 2; } }; f()",
+		"let n = 0; for (i in range(3)) { try { throw i; } catch (e) { n = n + len(e.message); } finally { n = n + 1; } }; n",
+		"try { [][0]; } catch (KeyError e) { 1 }",
+	}
+
+	for _, input := range tests {
+		expected := runPeephole(t, input, false)
+		if got := runPeephole(t, input, true); got != expected {
+			t.Errorf("%q: optimized run differs.\nwant=%q\ngot=%q", input, expected, got)
+		}
+	}
+}
+
+func runPeephole(t testing.TB, input string, optimize bool) string {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	if optimize {
+		compiler.Peephole(bytecode)
+	}
+
+	vm := New(bytecode)
+	if err := vm.Run(); err != nil {
+		return err.(*object.Error).Traceback()
+	}
+	return vm.LastPoppedStackElem().Inspect()
+}
+
+var loopBenchmarks = []struct {
+	name  string
+	input string
+}{
+	{"for", "let s = 0; for (let i = 0; i < 10000; i = i + 1) { s = s + i; } s"},
+	{"while", "fn f() { let n = 0; while (n < 10000) { n = n + 1; } n }; f()"},
+	{"nested", `fn f() {
+  let s = 0;
+  for (let i = 0; i < 100; i = i + 1) {
+    for (let j = 0; j < 100; j = j + 1) { if (i == j) { s = s + 1; } }
+  }
+  s
+}; f()`},
+	{"fib", "fn fib(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(18)"},
+}
+
+// BenchmarkLoops compares loop-heavy programs before and after the
+// peephole optimizer.
+func BenchmarkLoops(b *testing.B) {
+	for _, bench := range loopBenchmarks {
+		for _, optimize := range []bool{false, true} {
+			name := bench.name
+			if optimize {
+				name += "-peephole"
+			}
+
+			comp := compiler.New()
+			if err := comp.Compile(parse(bench.input)); err != nil {
+				b.Fatalf("compiler error: %s", err)
+			}
+			bytecode := comp.Bytecode()
+			if optimize {
+				compiler.Peephole(bytecode)
+			}
+
+			b.Run(name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if err := New(bytecode).Run(); err != nil {
+						b.Fatalf("vm error: %s", err)
+					}
+				}
+			})
+		}
+	}
+}